@@ -0,0 +1,651 @@
+// Package asm assembles 6502 source, for the tests of the emulator and the patches of the debugger.
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"go-nes/nes"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var ErrAssembly = errors.New("assembly error")
+
+// Assembly is the output of Assemble: the bytes from Origin on and the address of every label.
+type Assembly struct {
+	Origin uint16
+	Code   []uint8
+	Labels map[string]uint16
+}
+
+// Assembler assembles the documented opcodes of nes.CPU_OPS_CODES, and the undocumented ones spelled like "*LAX".
+//
+// The syntax follows ca65: "label:", "name = expr", ".org", ".byte" (numbers and "strings") and ".word",
+// ";" comments, "#<expr" and "#>expr" for the low and high bytes, and "a:" or "z:" to force the operand size.
+// Expressions take numbers ($hex, %binary, decimal or 'c'), labels, * for the current address
+// and the operators + - * / & | ^ << >> ~ with parentheses.
+type Assembler struct {
+	Origin  uint16           // address of the code before any .org
+	Symbols *nes.SymbolTable // resolves the names the source doesn't define, may be nil
+}
+
+// Assemble assembles source placed at origin.
+func Assemble(source string, origin uint16) (*Assembly, error) {
+	return (&Assembler{Origin: origin}).Assemble(source)
+}
+
+// asmOpcodes indexes nes.CPU_OPS_CODES by mnemonic and mode, preferring the lowest opcode among duplicates.
+var asmOpcodes = func() map[string]map[nes.AddressingMode]uint8 {
+	codes := make([]int, 0, len(nes.CPU_OPS_CODES))
+	for code := range nes.CPU_OPS_CODES {
+		codes = append(codes, int(code))
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(codes)))
+	opcodes := map[string]map[nes.AddressingMode]uint8{}
+	for _, code := range codes {
+		op := nes.CPU_OPS_CODES[uint8(code)]
+		if opcodes[op.Mnemonic] == nil {
+			opcodes[op.Mnemonic] = map[nes.AddressingMode]uint8{}
+		}
+		opcodes[op.Mnemonic][op.Mode] = uint8(code)
+	}
+	return opcodes
+}()
+
+type asmStatement struct {
+	line      int
+	addr      int
+	directive string // ".byte" or ".word", "" for instructions
+	opcode    uint8
+	mode      nes.AddressingMode
+	operand   asmExpr
+	values    []asmExpr // a nil entry is followed by a string in text
+	text      []string
+}
+
+type asmEnv struct {
+	labels  map[string]int
+	symbols *nes.SymbolTable
+	pc      int    // can reach $10000 after the last byte
+	missing string // the first unknown name
+}
+
+type asmExpr func(env *asmEnv) int
+
+// Assemble assembles source in two passes: the first one sizes the instructions and places the labels,
+// the second one encodes them. Operands referring to labels defined later take the absolute modes.
+func (a *Assembler) Assemble(source string) (*Assembly, error) {
+	env := &asmEnv{labels: map[string]int{}, symbols: a.Symbols, pc: int(a.Origin)}
+	origin, started := int(a.Origin), false
+	var statements []*asmStatement
+
+	for n, line := range strings.Split(source, "\n") {
+		n++
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%w: line %d: %s", ErrAssembly, n, fmt.Sprintf(format, args...))
+		}
+		line = stripComment(line)
+
+		// labels
+		for {
+			name, rest, found := strings.Cut(line, ":")
+			name = strings.TrimSpace(name)
+			if !found || !isAsmName(name) {
+				break
+			}
+			if _, defined := env.labels[name]; defined {
+				return nil, errorf("%s is already defined", name)
+			}
+			env.labels[name] = env.pc
+			line = rest
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// constants
+		if name, value, found := strings.Cut(line, "="); found && isAsmName(strings.TrimSpace(name)) {
+			name = strings.TrimSpace(name)
+			if _, defined := env.labels[name]; defined {
+				return nil, errorf("%s is already defined", name)
+			}
+			v, err := env.evalNow(value)
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+			env.labels[name] = v
+			continue
+		}
+
+		word, operand := line, ""
+		if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+			word, operand = line[:i], strings.TrimSpace(line[i:])
+		}
+		s := &asmStatement{line: n, addr: env.pc}
+		switch directive := strings.ToLower(word); directive {
+		case ".org":
+			v, err := env.evalNow(operand)
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+			if v < 0 || v > 0xffff {
+				return nil, errorf(".org %d out of range", v)
+			}
+			if !started {
+				origin = v
+			} else if v < env.pc {
+				return nil, errorf(".org $%04X is before the current address $%04X", v, env.pc)
+			}
+			env.pc = v
+			continue
+		case ".byte", ".word":
+			s.directive = directive
+			size := 0
+			for _, item := range splitOperands(operand) {
+				if directive == ".byte" && strings.HasPrefix(item, `"`) {
+					text, err := strconv.Unquote(item)
+					if err != nil {
+						return nil, errorf("invalid string %s", item)
+					}
+					s.values = append(s.values, nil)
+					s.text = append(s.text, text)
+					size += len(text)
+					continue
+				}
+				expr, err := parseAsmExpr(item)
+				if err != nil {
+					return nil, errorf("%v", err)
+				}
+				s.values = append(s.values, expr)
+				size += map[string]int{".byte": 1, ".word": 2}[directive]
+			}
+			if size == 0 {
+				return nil, errorf("%s without values", directive)
+			}
+			env.pc += size
+		default:
+			if strings.HasPrefix(word, ".") {
+				return nil, errorf("unknown directive %s", word)
+			}
+			if err := env.parseInstruction(s, strings.ToUpper(word), operand); err != nil {
+				return nil, errorf("%v", err)
+			}
+			env.pc += int(nes.CPU_OPS_CODES[s.opcode].Length)
+		}
+		if env.pc > 0x10000 {
+			return nil, errorf("code beyond $FFFF")
+		}
+		started = true
+		statements = append(statements, s)
+	}
+
+	code := make([]uint8, env.pc-origin)
+	for _, s := range statements {
+		env.pc = s.addr
+		out := code[s.addr-origin:]
+		if err := env.encode(s, out); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrAssembly, s.line, err)
+		}
+	}
+
+	labels := make(map[string]uint16, len(env.labels))
+	for name, v := range env.labels {
+		labels[name] = uint16(v)
+	}
+	return &Assembly{Origin: uint16(origin), Code: code, Labels: labels}, nil
+}
+
+// stripComment removes a ";" comment, unless it is in a string or a character.
+func stripComment(line string) string {
+	quote := rune(0)
+	for i, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitOperands splits on the commas outside of strings and characters.
+func splitOperands(s string) []string {
+	var items []string
+	quote, start := rune(0), 0
+	for i, c := range s {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" || len(items) > 0 {
+		items = append(items, last)
+	}
+	return items
+}
+
+func isAsmName(s string) bool {
+	for i, c := range s {
+		if c != '_' && !unicode.IsLetter(c) && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// lookup returns the value of a label, constant or symbol, recording the first unknown name.
+func (env *asmEnv) lookup(name string) int {
+	if v, ok := env.labels[name]; ok {
+		return v
+	}
+	if env.symbols != nil {
+		if s, ok := env.symbols.Lookup(name); ok {
+			return int(s.Address)
+		}
+	}
+	if env.missing == "" {
+		env.missing = name
+	}
+	return 0
+}
+
+// eval evaluates expr, reporting whether every name it uses is known.
+func (env *asmEnv) eval(expr asmExpr) (int, bool) {
+	env.missing = ""
+	v := expr(env)
+	return v, env.missing == ""
+}
+
+// evalNow evaluates an expression which can't refer to labels defined later, like the ones of .org.
+func (env *asmEnv) evalNow(source string) (int, error) {
+	expr, err := parseAsmExpr(source)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := env.eval(expr)
+	if !ok {
+		return 0, fmt.Errorf("unknown name %s", env.missing)
+	}
+	return v, nil
+}
+
+// parseInstruction picks the opcode from the operand syntax, taking zero page modes
+// when the operand is known to fit and there is no "a:" prefix.
+func (env *asmEnv) parseInstruction(s *asmStatement, mnemonic string, operand string) error {
+	modes, ok := asmOpcodes[mnemonic]
+	if !ok {
+		return fmt.Errorf("unknown instruction %s", mnemonic)
+	}
+	choose := func(candidates ...nes.AddressingMode) error {
+		for _, mode := range candidates {
+			if code, ok := modes[mode]; ok {
+				s.opcode, s.mode = code, mode
+				return nil
+			}
+		}
+		if operand == "" {
+			return fmt.Errorf("%s needs an operand", mnemonic)
+		}
+		return fmt.Errorf("%s %s: addressing mode not available", mnemonic, operand)
+	}
+	expression := func(source string) error {
+		expr, err := parseAsmExpr(source)
+		s.operand = expr
+		return err
+	}
+
+	compact := strings.ReplaceAll(operand, " ", "")
+	upper := strings.ToUpper(compact)
+	switch {
+	case operand == "":
+		return choose(nes.IMPLIED, nes.ACCUMULATOR)
+	case upper == "A":
+		return choose(nes.ACCUMULATOR)
+	case strings.HasPrefix(compact, "#"):
+		if err := expression(compact[1:]); err != nil {
+			return err
+		}
+		return choose(nes.IMMEDIATE)
+	case strings.HasPrefix(compact, "(") && strings.HasSuffix(upper, ",X)"):
+		if err := expression(compact[1 : len(compact)-3]); err != nil {
+			return err
+		}
+		return choose(nes.INDIRECT_X)
+	case strings.HasPrefix(compact, "(") && strings.HasSuffix(upper, "),Y") && closingParen(compact) == len(compact)-3:
+		if err := expression(compact[1 : len(compact)-3]); err != nil {
+			return err
+		}
+		return choose(nes.INDIRECT_Y)
+	case strings.HasPrefix(compact, "(") && closingParen(compact) == len(compact)-1 && modes[nes.INDIRECT] != 0:
+		if err := expression(compact[1 : len(compact)-1]); err != nil {
+			return err
+		}
+		return choose(nes.INDIRECT)
+	}
+
+	if _, ok := modes[nes.RELATIVE]; ok {
+		if err := expression(compact); err != nil {
+			return err
+		}
+		return choose(nes.RELATIVE)
+	}
+
+	index := ""
+	if strings.HasSuffix(upper, ",X") || strings.HasSuffix(upper, ",Y") {
+		index = upper[len(upper)-1:]
+		compact = compact[:len(compact)-2]
+	}
+	force := ""
+	if prefix := strings.ToLower(compact); strings.HasPrefix(prefix, "a:") || strings.HasPrefix(prefix, "z:") {
+		force, compact = prefix[:1], compact[2:]
+	}
+	if err := expression(compact); err != nil {
+		return err
+	}
+	v, known := env.eval(s.operand)
+	zeroPage := force == "z" || (force == "" && known && v >= 0 && v < 0x100)
+
+	candidates := map[string][]nes.AddressingMode{
+		"":  {nes.ABSOLUTE},
+		"X": {nes.ABSOLUTE_X},
+		"Y": {nes.ABSOLUTE_Y},
+	}[index]
+	if zeroPage {
+		candidates = append([]nes.AddressingMode{map[string]nes.AddressingMode{"": nes.ZERO_PAGE, "X": nes.ZERO_PAGE_X, "Y": nes.ZERO_PAGE_Y}[index]}, candidates...)
+		if force == "z" {
+			candidates = candidates[:1]
+		}
+	}
+	return choose(candidates...)
+}
+
+// closingParen returns the index of the parenthesis closing the one at the start of s, -1 if there is none.
+func closingParen(s string) int {
+	depth := 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// encode writes the bytes of s to out, all the labels being known.
+func (env *asmEnv) encode(s *asmStatement, out []uint8) error {
+	value := func(expr asmExpr, min, max int) (int, error) {
+		v, ok := env.eval(expr)
+		if !ok {
+			return 0, fmt.Errorf("unknown name %s", env.missing)
+		}
+		if v < min || v > max {
+			return 0, fmt.Errorf("value %d out of range", v)
+		}
+		return v, nil
+	}
+
+	switch s.directive {
+	case ".byte", ".word":
+		i, text := 0, s.text
+		for _, expr := range s.values {
+			if expr == nil {
+				i += copy(out[i:], text[0])
+				text = text[1:]
+				continue
+			}
+			if s.directive == ".byte" {
+				v, err := value(expr, -0x80, 0xff)
+				if err != nil {
+					return err
+				}
+				out[i] = uint8(v)
+				i++
+				continue
+			}
+			v, err := value(expr, -0x8000, 0xffff)
+			if err != nil {
+				return err
+			}
+			out[i], out[i+1] = uint8(v), uint8(v>>8)
+			i += 2
+		}
+		return nil
+	}
+
+	out[0] = s.opcode
+	switch nes.CPU_OPS_CODES[s.opcode].Length {
+	case 2:
+		if s.mode == nes.RELATIVE {
+			target, err := value(s.operand, 0, 0xffff)
+			if err != nil {
+				return err
+			}
+			offset := target - (s.addr + 2)
+			if offset < -0x80 || offset > 0x7f {
+				return fmt.Errorf("branch to $%04X out of range", target)
+			}
+			out[1] = uint8(offset)
+			return nil
+		}
+		min := -0x80
+		if s.mode != nes.IMMEDIATE {
+			min = 0
+		}
+		v, err := value(s.operand, min, 0xff)
+		if err != nil {
+			return err
+		}
+		out[1] = uint8(v)
+	case 3:
+		v, err := value(s.operand, 0, 0xffff)
+		if err != nil {
+			return err
+		}
+		out[1], out[2] = uint8(v), uint8(v>>8)
+	}
+	return nil
+}
+
+// parseAsmExpr compiles an operand expression.
+func parseAsmExpr(source string) (asmExpr, error) {
+	p := &asmParser{source: source}
+	p.next()
+	expr, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "" {
+		return nil, p.errorf("unexpected %q", p.token)
+	}
+	return expr, nil
+}
+
+type asmParser struct {
+	source string
+	pos    int
+	token  string
+}
+
+func (p *asmParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %q: %s", nes.ErrInvalidExpression, p.source, fmt.Sprintf(format, args...))
+}
+
+// next reads the following token into p.token, "" at the end.
+func (p *asmParser) next() {
+	for p.pos < len(p.source) && p.source[p.pos] == ' ' {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.source) {
+		p.token = ""
+		return
+	}
+
+	c := rune(p.source[p.pos])
+	switch {
+	case c == '$' || c == '%' || c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+		p.pos++
+		for p.pos < len(p.source) {
+			c := rune(p.source[p.pos])
+			if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				break
+			}
+			p.pos++
+		}
+	case c == '\'':
+		p.pos++
+		if end := strings.IndexByte(p.source[p.pos:], '\''); end >= 0 {
+			p.pos += end + 1
+		} else {
+			p.pos = len(p.source)
+		}
+	default:
+		p.pos++
+		for _, op := range []string{"<<", ">>"} {
+			if strings.HasPrefix(p.source[start:], op) {
+				p.pos = start + 2
+				break
+			}
+		}
+	}
+	p.token = p.source[start:p.pos]
+}
+
+var asmOperators = map[string]operator{
+	"|":  {1, func(a, b int) int { return a | b }},
+	"^":  {2, func(a, b int) int { return a ^ b }},
+	"&":  {3, func(a, b int) int { return a & b }},
+	"<<": {4, func(a, b int) int { return a << b }},
+	">>": {4, func(a, b int) int { return a >> b }},
+	"+":  {5, func(a, b int) int { return a + b }},
+	"-":  {5, func(a, b int) int { return a - b }},
+	"*":  {6, func(a, b int) int { return a * b }},
+	"/": {6, func(a, b int) int {
+		if b == 0 {
+			return 0
+		}
+		return a / b
+	}},
+}
+
+// parseBinary parses operators binding tighter than minPrecedence by precedence climbing.
+func (p *asmParser) parseBinary(minPrecedence int) (asmExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := asmOperators[p.token]
+		if !ok || op.precedence <= minPrecedence {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(op.precedence)
+		if err != nil {
+			return nil, err
+		}
+		l, apply := left, op.apply
+		left = func(env *asmEnv) int { return apply(l(env), right(env)) }
+	}
+}
+
+func (p *asmParser) parseUnary() (asmExpr, error) {
+	switch p.token {
+	case "-", "~", "<", ">":
+		op := p.token
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "-":
+			return func(env *asmEnv) int { return -operand(env) }, nil
+		case "~":
+			return func(env *asmEnv) int { return ^operand(env) }, nil
+		case "<":
+			return func(env *asmEnv) int { return operand(env) & 0xff }, nil
+		default:
+			return func(env *asmEnv) int { return operand(env) >> 8 & 0xff }, nil
+		}
+	}
+	return p.parsePrimary()
+}
+
+func (p *asmParser) parsePrimary() (asmExpr, error) {
+	token := p.token
+	switch token {
+	case "":
+		return nil, p.errorf("unexpected end")
+	case "(":
+		p.next()
+		inner, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.token != ")" {
+			return nil, p.errorf("expected \")\"")
+		}
+		p.next()
+		return inner, nil
+	case "*":
+		p.next()
+		return func(env *asmEnv) int { return env.pc }, nil
+	}
+	p.next()
+
+	if strings.HasPrefix(token, "'") {
+		if len(token) != 3 || token[2] != '\'' {
+			return nil, p.errorf("invalid character %s", token)
+		}
+		c := int(token[1])
+		return func(*asmEnv) int { return c }, nil
+	}
+	if n, ok := parseNumber(token); ok {
+		return func(*asmEnv) int { return n }, nil
+	}
+	if isAsmName(token) {
+		return func(env *asmEnv) int { return env.lookup(token) }, nil
+	}
+	return nil, p.errorf("unknown operand %q", token)
+}
+
+type operator struct {
+	precedence int
+	apply      func(a, b int) int
+}
+
+// parseNumber parses $hex, %binary and decimal numbers.
+func parseNumber(token string) (int, bool) {
+	var n uint64
+	var err error
+	switch {
+	case strings.HasPrefix(token, "$"):
+		n, err = strconv.ParseUint(token[1:], 16, 32)
+	case strings.HasPrefix(token, "%"):
+		n, err = strconv.ParseUint(token[1:], 2, 32)
+	case token[0] >= '0' && token[0] <= '9':
+		n, err = strconv.ParseUint(token, 10, 32)
+	default:
+		return 0, false
+	}
+	return int(n), err == nil
+}
@@ -0,0 +1,180 @@
+package asm
+
+import (
+	"fmt"
+	"go-nes/nes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []uint8
+	}{
+		{"implied", "NOP", []uint8{0xea}},
+		{"accumulator", "ASL A\nlsr", []uint8{0x0a, 0x4a}},
+		{"immediate", "LDA #$05", []uint8{0xa9, 0x05}},
+		{"negative immediate", "LDA #-1", []uint8{0xa9, 0xff}},
+		{"zero page", "STA $10", []uint8{0x85, 0x10}},
+		{"zero page x", "lda $10, x", []uint8{0xb5, 0x10}},
+		{"zero page y", "LDX $10,Y", []uint8{0xb6, 0x10}},
+		{"absolute", "STA $2000", []uint8{0x8d, 0x00, 0x20}},
+		{"forced absolute", "LDA a:$10", []uint8{0xad, 0x10, 0x00}},
+		{"absolute x", "LDA $0300,X", []uint8{0xbd, 0x00, 0x03}},
+		{"absolute y", "LDA $0300,Y", []uint8{0xb9, 0x00, 0x03}},
+		{"zero page y without the mode", "LDA $10,Y", []uint8{0xb9, 0x10, 0x00}},
+		{"indirect", "JMP ($FFFC)", []uint8{0x6c, 0xfc, 0xff}},
+		{"indirect x", "LDA ($20,X)", []uint8{0xa1, 0x20}},
+		{"indirect y", "LDA ($20),Y", []uint8{0xb1, 0x20}},
+		{"expression in parentheses", "LDA ($10+2)*2", []uint8{0xa5, 0x24}},
+		{"undocumented", "*LAX $10", []uint8{0xa7, 0x10}},
+		{"branch backward", "loop: DEX\nBNE loop", []uint8{0xca, 0xd0, 0xfd}},
+		{"branch forward", "BEQ done\nNOP\ndone: RTS", []uint8{0xf0, 0x01, 0xea, 0x60}},
+		{"constant", "ptr = $10\nLDA (ptr),Y\nSTA ptr+1", []uint8{0xb1, 0x10, 0x85, 0x11}},
+		{"low and high bytes", "LDA #<target\nLDX #>target\ntarget:", []uint8{0xa9, 0x04, 0xa2, 0x80}},
+		{"current address", "JMP *", []uint8{0x4c, 0x00, 0x80}},
+		{"operators", ".byte 1 << 4 | 3, $f0 & $3c ^ 1, 7 / 2 - 1, ~0 & $ff", []uint8{0x13, 0x31, 0x02, 0xff}},
+		{"decimal with leading zeros", ".byte 010, 0", []uint8{0x0a, 0x00}},
+		{"bytes", `.byte $01, 'A', "hi"`, []uint8{0x01, 0x41, 0x68, 0x69}},
+		{"words", ".word $1234, label\nlabel:", []uint8{0x34, 0x12, 0x04, 0x80}},
+		{"comments", "; setup\nLDA #';' ; load\n", []uint8{0xa9, 0x3b}},
+		{"org", "NOP\n.org $8004\nRTS", []uint8{0xea, 0x00, 0x00, 0x00, 0x60}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assembly, err := Assemble(tt.source, 0x8000)
+			assert.NoError(t, err)
+			assert.Equal(t, uint16(0x8000), assembly.Origin)
+			assert.Equal(t, tt.want, assembly.Code)
+		})
+	}
+}
+
+func TestAssembleForwardReference(t *testing.T) {
+	// the operand size is picked before value is known
+	assembly, err := Assemble("LDA value\nvalue = $10", 0x8000)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint8{0xad, 0x10, 0x00}, assembly.Code)
+	assert.Equal(t, uint16(0x10), assembly.Labels["value"])
+}
+
+func TestAssembleVectors(t *testing.T) {
+	source := `
+		.org $C000
+	reset:
+		SEI
+	nmi:
+		RTI
+		.org $FFFA
+		.word nmi, reset, nmi
+	`
+	assembly, err := Assemble(source, 0x8000)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0xc000), assembly.Origin)
+	assert.Len(t, assembly.Code, 0x4000)
+	assert.Equal(t, []uint8{0x78, 0x40}, assembly.Code[:2])
+	assert.Equal(t, []uint8{0x01, 0xc0, 0x00, 0xc0, 0x01, 0xc0}, assembly.Code[0x3ffa:])
+	assert.Equal(t, uint16(0xc001), assembly.Labels["nmi"])
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"unknown instruction", "FOO"},
+		{"unknown directive", ".foo 1"},
+		{"missing operand", "LDA"},
+		{"unavailable mode", "STA #$10"},
+		{"unknown name", "JMP nowhere"},
+		{"duplicate label", "a: NOP\na: NOP"},
+		{"byte out of range", ".byte 256"},
+		{"branch out of range", "BNE far\n.org $8100\nfar:"},
+		{"org backward", "NOP\n.org $7000"},
+		{"beyond the address space", ".org $FFFF\nJMP $8000"},
+		{"invalid expression", "LDA #(1+"},
+		{"C radix prefix", "LDA #0x10"},
+		{"digit out of the radix", "LDA #%102"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Assemble(tt.source, 0x8000)
+			assert.ErrorIs(t, err, ErrAssembly)
+		})
+	}
+}
+
+// TestAssembleOpcodes assembles every documented opcode back from its mnemonic and mode.
+func TestAssembleOpcodes(t *testing.T) {
+	operands := map[nes.AddressingMode]string{
+		nes.IMPLIED:     "",
+		nes.ACCUMULATOR: " A",
+		nes.IMMEDIATE:   " #$12",
+		nes.ZERO_PAGE:   " $12",
+		nes.ZERO_PAGE_X: " $12,X",
+		nes.ZERO_PAGE_Y: " $12,Y",
+		nes.ABSOLUTE:    " $1234",
+		nes.ABSOLUTE_X:  " $1234,X",
+		nes.ABSOLUTE_Y:  " $1234,Y",
+		nes.INDIRECT:    " ($1234)",
+		nes.INDIRECT_X:  " ($12,X)",
+		nes.INDIRECT_Y:  " ($12),Y",
+		nes.RELATIVE:    " *+$14",
+	}
+	for code, op := range nes.CPU_OPS_CODES {
+		if strings.HasPrefix(op.Mnemonic, "*") {
+			continue
+		}
+		source := op.Mnemonic + operands[op.Mode]
+		assembly, err := Assemble(source, 0x8000)
+		if assert.NoError(t, err, source) {
+			want := []uint8{code, 0x12, 0x34}[:op.Length]
+			if op.Length == 3 {
+				want = []uint8{code, 0x34, 0x12}
+			}
+			assert.Equal(t, want, assembly.Code, fmt.Sprintf("%s ($%02X)", source, code))
+		}
+	}
+}
+
+// createTestROM returns an NROM-256 image running program from $8000.
+func createTestROM(t *testing.T, program string) []uint8 {
+	t.Helper()
+	assembly, err := Assemble(program, 0x8000)
+	assert.NoError(t, err)
+	rom := append([]uint8{0x4e, 0x45, 0x53, 0x1a, 0x02, 0x01, 0x01, 0x00}, make([]uint8, 8+0x8000+0x2000)...)
+	copy(rom[16:], assembly.Code)
+	rom[16+0x7ffd] = 0x80
+	return rom
+}
+
+func TestPatch(t *testing.T) {
+	console := nes.NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROM(t, "LDA #$01\nJMP $8000")))
+	console.Symbols.Add(nes.Symbol{Name: "counter", Address: 0x10, ROMOffset: -1})
+
+	n, err := Patch(console.Bus, 0x8000, "INC counter")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, uint8(0xe6), console.Bus.Peek(0x8000))
+	assert.Equal(t, uint8(0x10), console.Bus.Peek(0x8001))
+	assert.Equal(t, uint8(0x4c), console.Bus.Peek(0x8002))
+	assert.NoError(t, console.HardReset())
+	assert.Equal(t, uint8(0xa9), console.Bus.Peek(0x8000))
+
+	_, err = Patch(console.Bus, 0x2000, "NOP")
+	assert.ErrorIs(t, err, ErrAssembly)
+
+	// nothing is written when the last bytes fall on the PPU registers
+	console.Bus.Poke(0x07fe, 0xff)
+	_, err = Patch(console.Bus, 0x1ffe, "JMP $8000")
+	assert.ErrorIs(t, err, ErrAssembly)
+	assert.Equal(t, uint8(0xff), console.Bus.Peek(0x07fe))
+	assert.Equal(t, uint8(0x00), console.Bus.Peek(0x07ff))
+}
@@ -0,0 +1,24 @@
+package asm
+
+import (
+	"fmt"
+	"go-nes/nes"
+)
+
+// Patch assembles source at addr and writes it over RAM or PRG-ROM, resolving names with the loaded symbols.
+// Nothing is written unless every byte can be, and it returns the number of bytes written.
+func Patch(bus *nes.Bus, addr uint16, source string) (int, error) {
+	assembly, err := (&Assembler{Origin: addr, Symbols: bus.Symbols}).Assemble(source)
+	if err != nil {
+		return 0, err
+	}
+	for i := range assembly.Code {
+		if at := assembly.Origin + uint16(i); !bus.CanPoke(at) {
+			return 0, fmt.Errorf("%w: $%04X can't be patched", ErrAssembly, at)
+		}
+	}
+	for i, data := range assembly.Code {
+		bus.Poke(assembly.Origin+uint16(i), data)
+	}
+	return len(assembly.Code), nil
+}
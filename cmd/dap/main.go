@@ -0,0 +1,41 @@
+// Command dap is a Debug Adapter Protocol server for debugging ca65 programs from an editor.
+// It talks DAP on stdin/stdout, or on a loopback TCP address with -listen.
+//
+//	go run ./cmd/dap
+//	go run ./cmd/dap -listen localhost:4711
+package main
+
+import (
+	"errors"
+	"flag"
+	"go-nes/dap"
+	"io"
+	"log"
+	"os"
+)
+
+type stdio struct{}
+
+func (stdio) Read(p []byte) (int, error) {
+	return os.Stdin.Read(p)
+}
+
+func (stdio) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+func main() {
+	listen := flag.String("listen", "", "loopback address to accept DAP connections on, instead of stdin/stdout")
+	flag.Parse()
+
+	if *listen != "" {
+		log.Printf("listening on %s", *listen)
+		if err := dap.ListenAndServe(*listen); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := dap.Serve(stdio{}); err != nil && !errors.Is(err, io.EOF) {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,138 @@
+// Command disasm disassembles a ROM into ca65 source which assembles back to the same file.
+// Code is found by following the execution from the vectors, and from the code logged in a .cdl file;
+// everything else is written as data.
+//
+//	go run ./cmd/disasm -o game.s -cfg game.cfg game.nes
+//	go run ./cmd/disasm -entry '$8123,$9000' -labels game.dbg game.nes
+//	go run ./cmd/disasm -cdl game.cdl game.nes
+//	ca65 game.s && ld65 -C game.cfg -o game.nes game.o
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-nes/disasm"
+	"go-nes/nes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	out := flag.String("o", "", "file to write the source to (default: stdout)")
+	cfg := flag.String("cfg", "", "file to write the ld65 linker configuration to")
+	entries := flag.String("entry", "", "comma separated extra entry points, like $8123")
+	labels := flag.String("labels", "", "comma separated label files: ca65 .dbg, FCEUX .nl or Mesen .mlb")
+	cdl := flag.String("cdl", "", "code/data log of the ROM, as written by the emulator or FCEUX")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("Please specify a file path")
+	}
+	if err := run(flag.Arg(0), *out, *cfg, *entries, *labels, *cdl); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(romPath, out, cfg, entries, labels, cdl string) error {
+	rom, err := os.ReadFile(romPath)
+	if err != nil {
+		return err
+	}
+	program, err := disasm.NewProgram(rom)
+	if err != nil {
+		return err
+	}
+	if labels != "" {
+		console := nes.NewConsole()
+		if err := console.LoadROM(rom); err != nil {
+			return err
+		}
+		for _, path := range strings.Split(labels, ",") {
+			if err := loadLabels(console, path); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		program.Symbols = console.Symbols
+	}
+
+	if cdl != "" {
+		data, err := os.ReadFile(cdl)
+		if err != nil {
+			return err
+		}
+		if err := program.ApplyCodeDataLog(data); err != nil {
+			return fmt.Errorf("%s: %w", cdl, err)
+		}
+	}
+
+	var addrs []uint16
+	if entries != "" {
+		for _, entry := range strings.Split(entries, ",") {
+			entry = strings.TrimSpace(entry)
+			addr, err := strconv.ParseUint(strings.TrimPrefix(entry, "$"), 16, 16)
+			if err != nil {
+				return fmt.Errorf("invalid entry point %q", entry)
+			}
+			addrs = append(addrs, uint16(addr))
+		}
+	}
+	program.Analyze(addrs...)
+
+	if err := write(out, program.WriteSource); err != nil {
+		return err
+	}
+	if cfg != "" {
+		return write(cfg, program.WriteLinkerConfig)
+	}
+	return nil
+}
+
+// loadLabels reads a label file, its format being told by its name: FCEUX's "game.nes.ram.nl" and
+// "game.nes.<bank>.nl", Mesen's "game.mlb" or ld65's "game.dbg".
+func loadLabels(console *nes.Console, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch filepath.Ext(path) {
+	case ".dbg":
+		info, err := nes.ReadDebugInfo(f)
+		if err != nil {
+			return err
+		}
+		console.Symbols.AddDebugInfo(info)
+		return nil
+	case ".nl":
+		bank := -1
+		if ext := filepath.Ext(strings.TrimSuffix(path, ".nl")); ext != ".ram" {
+			if bank, err = strconv.Atoi(strings.TrimPrefix(ext, ".")); err != nil {
+				return fmt.Errorf("no bank number in the file name")
+			}
+		}
+		return console.Symbols.ReadFCEUX(f, bank)
+	case ".mlb":
+		return console.Symbols.ReadMesen(f, console.Bus)
+	}
+	return fmt.Errorf("unknown label file format")
+}
+
+func write(path string, writeTo func(w io.Writer) error) error {
+	if path == "" {
+		return writeTo(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
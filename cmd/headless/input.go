@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go-nes/nes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var buttonNames = map[string]uint8{
+	"A":      1 << nes.JOYPAD_A,
+	"B":      1 << nes.JOYPAD_B,
+	"SELECT": 1 << nes.JOYPAD_SELECT,
+	"START":  1 << nes.JOYPAD_START,
+	"UP":     1 << nes.JOYPAD_UP,
+	"DOWN":   1 << nes.JOYPAD_DOWN,
+	"LEFT":   1 << nes.JOYPAD_LEFT,
+	"RIGHT":  1 << nes.JOYPAD_RIGHT,
+}
+
+// inputEvent sets the buttons held from frame onwards, until the next event.
+type inputEvent struct {
+	frame   uint
+	buttons [2]uint8
+}
+
+// parseInputScript reads lines of "<frame> <player 1 buttons> [<player 2 buttons>]".
+// Buttons are comma separated (e.g. "RIGHT,A") and "." means no button.
+// Frames are counted from 1 and must be in ascending order. "#" starts a comment.
+func parseInputScript(r io.Reader) ([]inputEvent, error) {
+	var events []inputEvent
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: too many fields", lineNumber)
+		}
+
+		frame, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid frame: %w", lineNumber, err)
+		}
+		if len(events) > 0 && uint(frame) < events[len(events)-1].frame {
+			return nil, fmt.Errorf("line %d: frames must be in ascending order", lineNumber)
+		}
+
+		event := inputEvent{frame: uint(frame)}
+		for player, spec := range fields[1:] {
+			event.buttons[player], err = parseButtons(spec)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		}
+		events = append(events, event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func parseButtons(spec string) (uint8, error) {
+	if spec == "." {
+		return 0, nil
+	}
+
+	var mask uint8
+	for _, name := range strings.Split(spec, ",") {
+		button, ok := buttonNames[strings.ToUpper(name)]
+		if !ok {
+			return 0, fmt.Errorf("unknown button: %s", name)
+		}
+		mask |= button
+	}
+	return mask, nil
+}
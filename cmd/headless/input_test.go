@@ -0,0 +1,45 @@
+package main
+
+import (
+	"go-nes/nes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInputScript(t *testing.T) {
+	script := `
+# frame player1 player2
+1   .
+120 START
+125 RIGHT,a  B
+`
+	events, err := parseInputScript(strings.NewReader(script))
+	assert.NoError(t, err)
+	assert.Equal(t, []inputEvent{
+		{frame: 1},
+		{frame: 120, buttons: [2]uint8{1 << nes.JOYPAD_START, 0}},
+		{frame: 125, buttons: [2]uint8{1<<nes.JOYPAD_RIGHT | 1<<nes.JOYPAD_A, 1 << nes.JOYPAD_B}},
+	}, events)
+}
+
+func TestParseInputScriptErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		script string
+	}{
+		{name: "unknown button", script: "1 JUMP"},
+		{name: "invalid frame", script: "x A"},
+		{name: "descending frames", script: "10 A\n5 B"},
+		{name: "too many fields", script: "1 A B C"},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseInputScript(strings.NewReader(tt.script))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,487 @@
+// Command headless runs a ROM without a window and writes PNG screenshots.
+// It only depends on package nes, so it can run on CI machines without a display.
+//
+//	go run ./cmd/headless -frames 600 -screenshot 60,600 -out shots rom.nes
+//	go run ./cmd/headless -frames 600 -movie run.fm2 rom.nes
+//	go run ./cmd/headless -frames 600 -movie run.fm2 -verify run.hashes rom.nes
+//	go run ./cmd/headless -gdb localhost:2345 rom.nes
+//	go run ./cmd/headless -frames 10 -trace trace.log -trace-format mesen -trace-frames 5-6 rom.nes
+//	go run ./cmd/headless -frames 600 -trace crash.log -trace-ring 1000 rom.nes
+//	go run ./cmd/headless -frames 3600 -movie run.fm2 -cdl rom.cdl rom.nes
+//	go run ./cmd/headless -frames 600 -profile rom.pb.gz -profile-report rom.prof rom.nes && go tool pprof -top rom.pb.gz
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"go-nes/gdbstub"
+	"go-nes/nes"
+	"image/png"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	frames := flag.Uint("frames", 60, "number of frames to run")
+	screenshots := flag.String("screenshot", "", "comma separated frames to save as PNG (default: the last frame)")
+	out := flag.String("out", ".", "directory to write screenshots to")
+	inputPath := flag.String("input", "", "input script, see parseInputScript")
+	moviePath := flag.String("movie", "", "FM2 movie to play back")
+	recordPath := flag.String("record", "", "FM2 movie to record the input to")
+	cheatsPath := flag.String("cheats", "", "cheat file, see nes.CheatList.Load")
+	watchPath := flag.String("watch", "", "watch file, see nes.ReadWatches")
+	watchLogPath := flag.String("watchlog", "", "CSV file to log the watches to every frame")
+	hashLogPath := flag.String("hashlog", "", "file to write per frame hashes of RAM, VRAM and the framebuffer to")
+	verifyPath := flag.String("verify", "", "hash log to compare every frame against, stopping at the first divergence or frame missing from it")
+	errorPolicy := flag.String("errors", "halt", "what to do on hardware-benign errors: halt, log or ignore")
+	gdbAddr := flag.String("gdb", "", "loopback address to serve the GDB remote protocol on instead of running the frames")
+	tracePath := flag.String("trace", "", "file to write a trace of the executed instructions to")
+	traceFormat := flag.String("trace-format", "nestest", "trace format: nestest, mesen or fceux")
+	tracePPU := flag.Bool("trace-ppu", false, "add the scanline and dot to the trace")
+	traceCycles := flag.Bool("trace-cycles", false, "add the CPU cycle count to the trace")
+	traceRange := flag.String("trace-range", "", "only trace the instructions at <start>-<end>, like 8000-80FF")
+	traceFrames := flag.String("trace-frames", "", "only trace the frames <first>-<last>, or <first>- for no end, counted from 0")
+	traceRing := flag.Int("trace-ring", 0, "only write the last n instructions, when the emulation fails")
+	profilePath := flag.String("profile", "", "file to write a pprof profile of the cycles spent in every subroutine to")
+	reportPath := flag.String("profile-report", "", "file to write a table of the cycles per frame of every subroutine to")
+	cdlPath := flag.String("cdl", "", "code/data log to update with the bytes used by the frames, FCEUX's .cdl format")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("Please specify a file path")
+	}
+
+	opts := options{
+		frames:       *frames,
+		screenshots:  *screenshots,
+		out:          *out,
+		inputPath:    *inputPath,
+		moviePath:    *moviePath,
+		recordPath:   *recordPath,
+		cheatsPath:   *cheatsPath,
+		watchPath:    *watchPath,
+		watchLogPath: *watchLogPath,
+		hashLogPath:  *hashLogPath,
+		verifyPath:   *verifyPath,
+		errorPolicy:  *errorPolicy,
+		gdbAddr:      *gdbAddr,
+		tracePath:    *tracePath,
+		cdlPath:      *cdlPath,
+		profilePath:  *profilePath,
+		reportPath:   *reportPath,
+	}
+	trace, err := parseTraceOptions(*traceFormat, *traceRange, *traceFrames)
+	if err != nil {
+		log.Fatal(err)
+	}
+	trace.PPU = *tracePPU
+	trace.Cycles = *traceCycles
+	trace.RingSize = *traceRing
+	opts.trace = trace
+
+	if err := run(flag.Arg(0), opts); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type options struct {
+	frames       uint
+	screenshots  string
+	out          string
+	inputPath    string
+	moviePath    string
+	recordPath   string
+	cheatsPath   string
+	watchPath    string
+	watchLogPath string
+	hashLogPath  string
+	verifyPath   string
+	errorPolicy  string
+	gdbAddr      string
+	tracePath    string
+	trace        nes.TraceOptions
+	cdlPath      string
+	profilePath  string
+	reportPath   string
+}
+
+func run(romPath string, opts options) error {
+	data, err := os.ReadFile(romPath)
+	if err != nil {
+		return err
+	}
+
+	console := nes.NewConsole()
+	switch opts.errorPolicy {
+	case "halt":
+		console.SetErrorPolicy(nes.ERROR_POLICY_HALT)
+	case "log":
+		console.SetErrorPolicy(nes.ERROR_POLICY_LOG)
+	case "ignore":
+		console.SetErrorPolicy(nes.ERROR_POLICY_IGNORE)
+	default:
+		return fmt.Errorf("unknown error policy: %s", opts.errorPolicy)
+	}
+	if err := console.LoadROM(data); err != nil {
+		return err
+	}
+
+	shots, err := parseFrameList(opts.screenshots)
+	if err != nil {
+		return err
+	}
+	if len(shots) == 0 {
+		shots[opts.frames] = true
+	}
+
+	var events []inputEvent
+	if opts.inputPath != "" {
+		f, err := os.Open(opts.inputPath)
+		if err != nil {
+			return err
+		}
+		events, err = parseInputScript(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", opts.inputPath, err)
+		}
+	}
+
+	if opts.cheatsPath != "" {
+		f, err := os.Open(opts.cheatsPath)
+		if err != nil {
+			return err
+		}
+		err = console.Cheats.Load(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", opts.cheatsPath, err)
+		}
+	}
+
+	var movie *nes.Movie
+	switch {
+	case opts.moviePath != "" && opts.recordPath != "":
+		return fmt.Errorf("-movie and -record can't be used together")
+	case opts.moviePath != "":
+		f, err := os.Open(opts.moviePath)
+		if err != nil {
+			return err
+		}
+		movie, err = nes.ReadMovie(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", opts.moviePath, err)
+		}
+		if err := console.PlayMovie(movie, true); err != nil {
+			return err
+		}
+	case opts.recordPath != "":
+		if movie, err = console.RecordMovie(filepath.Base(romPath)); err != nil {
+			return err
+		}
+	}
+
+	if opts.tracePath != "" {
+		f, err := os.Create(opts.tracePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		console.SetTraceLogger(nes.NewTraceLogger(w, opts.trace))
+	}
+
+	if opts.cdlPath != "" {
+		if err := readCodeDataLog(console.AttachCodeDataLogger(), opts.cdlPath); err != nil {
+			return err
+		}
+	}
+
+	if opts.profilePath != "" || opts.reportPath != "" {
+		console.AttachProfiler()
+	}
+
+	if opts.gdbAddr != "" {
+		log.Printf("waiting for gdb on %s", opts.gdbAddr)
+		if err := gdbstub.ListenAndServe(opts.gdbAddr, console); err != nil {
+			return err
+		}
+		return writeCodeDataLog(console.CodeDataLogger(), opts.cdlPath)
+	}
+
+	var expected map[uint]nes.FrameHash
+	if opts.verifyPath != "" {
+		f, err := os.Open(opts.verifyPath)
+		if err != nil {
+			return err
+		}
+		expected, err = readExpectedHashes(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", opts.verifyPath, err)
+		}
+	}
+	var hashes []nes.FrameHash
+
+	var watches []nes.Watch
+	if opts.watchPath != "" {
+		f, err := os.Open(opts.watchPath)
+		if err != nil {
+			return err
+		}
+		watches, err = nes.ReadWatches(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", opts.watchPath, err)
+		}
+	}
+	var watchLog *csv.Writer
+	var watchFile *os.File
+	if opts.watchLogPath != "" {
+		watchFile, err = os.Create(opts.watchLogPath)
+		if err != nil {
+			return err
+		}
+		defer watchFile.Close()
+		watchLog = csv.NewWriter(watchFile)
+		defer watchLog.Flush()
+
+		header := []string{"frame"}
+		for _, w := range watches {
+			header = append(header, w.Name)
+		}
+		if err := watchLog.Write(header); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(opts.out, 0o755); err != nil {
+		return err
+	}
+
+	next := 0
+	for frame := uint(1); frame <= opts.frames; frame++ {
+		for next < len(events) && events[next].frame <= frame {
+			console.SetButtons(0, events[next].buttons[0])
+			console.SetButtons(1, events[next].buttons[1])
+			next++
+		}
+
+		if err := console.StepFrame(); err != nil {
+			return fmt.Errorf("frame %d: %w", frame, err)
+		}
+
+		if opts.hashLogPath != "" || opts.verifyPath != "" {
+			h := console.FrameHash()
+			hashes = append(hashes, h)
+			if expected != nil {
+				e, ok := expected[h.Frame]
+				if !ok {
+					return fmt.Errorf("frame %d: missing from %s", h.Frame, opts.verifyPath)
+				}
+				if err := h.Verify(e); err != nil {
+					return err
+				}
+			}
+		}
+
+		if watchLog != nil {
+			row := []string{strconv.FormatUint(uint64(frame), 10)}
+			for _, w := range watches {
+				row = append(row, w.FormatValue(console.Bus))
+			}
+			if err := watchLog.Write(row); err != nil {
+				return err
+			}
+		}
+
+		if shots[frame] {
+			if err := writePNG(console, filepath.Join(opts.out, fmt.Sprintf("frame_%06d.png", frame))); err != nil {
+				return err
+			}
+		}
+	}
+
+	if watchLog != nil {
+		watchLog.Flush()
+		if err := watchLog.Error(); err != nil {
+			return err
+		}
+		if err := watchFile.Close(); err != nil {
+			return err
+		}
+	}
+
+	if opts.recordPath != "" {
+		if err := writeMovie(movie, opts.recordPath); err != nil {
+			return err
+		}
+	}
+	if err := writeCodeDataLog(console.CodeDataLogger(), opts.cdlPath); err != nil {
+		return err
+	}
+	if opts.profilePath != "" {
+		if err := writeFile(opts.profilePath, console.Profiler().WriteProfile); err != nil {
+			return err
+		}
+	}
+	if opts.reportPath != "" {
+		if err := writeFile(opts.reportPath, console.Profiler().WriteReport); err != nil {
+			return err
+		}
+	}
+	if opts.hashLogPath != "" {
+		f, err := os.Create(opts.hashLogPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := nes.WriteHashLog(f, hashes); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	return nil
+}
+
+func writeMovie(movie *nes.Movie, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := movie.Write(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// readCodeDataLog merges the log of a previous run, if any, into cdl.
+func readCodeDataLog(cdl *nes.CodeDataLogger, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := cdl.Read(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func writeCodeDataLog(cdl *nes.CodeDataLogger, path string) error {
+	if cdl == nil {
+		return nil
+	}
+	return writeFile(path, cdl.Write)
+}
+
+// readExpectedHashes reads a hash log to verify the frames against, indexed by frame.
+func readExpectedHashes(r io.Reader) (map[uint]nes.FrameHash, error) {
+	hashes, err := nes.ReadHashLog(r)
+	if err != nil {
+		return nil, err
+	}
+	expected := map[uint]nes.FrameHash{}
+	for _, h := range hashes {
+		if _, ok := expected[h.Frame]; ok {
+			return nil, fmt.Errorf("%w: frame %d is logged twice", nes.ErrInvalidHashLog, h.Frame)
+		}
+		expected[h.Frame] = h
+	}
+	return expected, nil
+}
+
+func writeFile(path string, writeTo func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := writeTo(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func parseFrameList(s string) (map[uint]bool, error) {
+	frames := map[uint]bool{}
+	if s == "" {
+		return frames, nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		frame, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid screenshot frame: %w", err)
+		}
+		frames[uint(frame)] = true
+	}
+	return frames, nil
+}
+
+// parseTraceOptions parses the -trace-format, -trace-range and -trace-frames flags.
+func parseTraceOptions(format, addrRange, frames string) (nes.TraceOptions, error) {
+	var o nes.TraceOptions
+	var err error
+	if o.Format, err = nes.ParseTraceFormat(format); err != nil {
+		return o, err
+	}
+	if addrRange != "" {
+		first, last, _ := strings.Cut(addrRange, "-")
+		start, err := strconv.ParseUint(strings.TrimPrefix(first, "$"), 16, 16)
+		if err != nil {
+			return o, fmt.Errorf("invalid trace range: %s", addrRange)
+		}
+		end, err := strconv.ParseUint(strings.TrimPrefix(last, "$"), 16, 16)
+		if err != nil || end < start {
+			return o, fmt.Errorf("invalid trace range: %s", addrRange)
+		}
+		o.Start, o.End = uint16(start), uint16(end)
+	}
+	if frames != "" {
+		first, last, isRange := strings.Cut(frames, "-")
+		n, err := strconv.ParseUint(first, 10, 32)
+		if err != nil {
+			return o, fmt.Errorf("invalid trace frames: %s", frames)
+		}
+		o.FirstFrame, o.LastFrame = uint(n), uint(n)
+		if isRange {
+			o.LastFrame = 0
+			if last != "" {
+				n, err := strconv.ParseUint(last, 10, 32)
+				if err != nil || uint(n) < o.FirstFrame {
+					return o, fmt.Errorf("invalid trace frames: %s", frames)
+				}
+				o.LastFrame = uint(n)
+			}
+		}
+	}
+	return o, nil
+}
+
+func writePNG(console *nes.Console, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, console.Framebuffer()); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"go-nes/nes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceOptions(t *testing.T) {
+	tests := []struct {
+		format    string
+		addrRange string
+		frames    string
+		want      nes.TraceOptions
+	}{
+		{"nestest", "", "", nes.TraceOptions{}},
+		{"fceux", "8000-80FF", "", nes.TraceOptions{Format: nes.TRACE_FORMAT_FCEUX, Start: 0x8000, End: 0x80ff}},
+		{"mesen", "$C000-$C010", "5", nes.TraceOptions{Format: nes.TRACE_FORMAT_MESEN, Start: 0xc000, End: 0xc010, FirstFrame: 5, LastFrame: 5}},
+		{"nestest", "", "5-7", nes.TraceOptions{FirstFrame: 5, LastFrame: 7}},
+		{"nestest", "", "5-", nes.TraceOptions{FirstFrame: 5}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.format+" "+tt.addrRange+" "+tt.frames, func(t *testing.T) {
+			got, err := parseTraceOptions(tt.format, tt.addrRange, tt.frames)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, args := range [][3]string{{"bizhawk", "", ""}, {"nestest", "80FF-8000", ""}, {"nestest", "8000", ""}, {"nestest", "", "7-5"}} {
+		_, err := parseTraceOptions(args[0], args[1], args[2])
+		assert.Error(t, err, args)
+	}
+}
+
+func TestReadExpectedHashes(t *testing.T) {
+	expected, err := readExpectedHashes(strings.NewReader("1 01 02 03\n2 04 05 06\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, nes.FrameHash{Frame: 2, RAM: 4, VRAM: 5, Framebuffer: 6}, expected[2])
+
+	_, err = readExpectedHashes(strings.NewReader("1 01 02 03\n1 04 05 06\n"))
+	assert.ErrorIs(t, err, nes.ErrInvalidHashLog)
+}
+
+func writeTestROM(t *testing.T, dir string) string {
+	t.Helper()
+	// loop: INC $10, JMP loop
+	rom := append([]uint8{0x4e, 0x45, 0x53, 0x1a, 0x02, 0x01, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}, make([]uint8, 0x8000+0x2000)...)
+	copy(rom[16:], []uint8{0xe6, 0x10, 0x4c, 0x00, 0x80})
+	rom[16+0x7ffd] = 0x80
+	romPath := filepath.Join(dir, "test.nes")
+	assert.NoError(t, os.WriteFile(romPath, rom, 0o644))
+	return romPath
+}
+
+func TestRunVerify(t *testing.T) {
+	dir := t.TempDir()
+	romPath := writeTestROM(t, dir)
+
+	logPath := filepath.Join(dir, "test.hashes")
+	opts := options{frames: 3, out: dir, errorPolicy: "halt", hashLogPath: logPath}
+	assert.NoError(t, run(romPath, opts))
+	hashLog, err := os.ReadFile(logPath)
+	assert.NoError(t, err)
+
+	opts = options{frames: 3, out: dir, errorPolicy: "halt", verifyPath: logPath}
+	assert.NoError(t, run(romPath, opts))
+
+	// a truncated log doesn't verify the frames it lacks
+	lines := strings.SplitAfter(string(hashLog), "\n")
+	assert.NoError(t, os.WriteFile(logPath, []byte(strings.Join(lines[:2], "")), 0o644))
+	err = run(romPath, opts)
+	assert.ErrorContains(t, err, "frame 3: missing")
+}
+
+func TestRunWatchLog(t *testing.T) {
+	dir := t.TempDir()
+	romPath := writeTestROM(t, dir)
+
+	logPath := filepath.Join(dir, "watch.csv")
+	opts := options{frames: 3, out: dir, errorPolicy: "halt", watchLogPath: logPath}
+	assert.NoError(t, run(romPath, opts))
+	watchLog, err := os.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "frame\n1\n2\n3\n", string(watchLog))
+
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full to fail the writes")
+	}
+	opts.watchLogPath = "/dev/full"
+	assert.Error(t, run(romPath, opts))
+}
@@ -0,0 +1,541 @@
+// Package dap is a Debug Adapter Protocol server, so that editors can debug ca65 programs at the source level.
+// See https://microsoft.github.io/debug-adapter-protocol/
+//
+// The launch request takes the ROM path as "program", and optionally "debugInfo" for the ld65 --dbgfile output
+// (default: the ROM path with the .dbg extension), "sourceRoot" for the directory ca65 was run in
+// (default: the debug info's directory) and "stopOnEntry".
+package dap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-nes/internal/loopback"
+	"go-nes/nes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrNotLoopback = loopback.ErrNotLoopback
+
+const (
+	THREAD_ID = 1
+
+	VARIABLES_REGISTERS = 1
+	VARIABLES_ZERO_PAGE = 2
+	VARIABLES_LABELS    = 3
+
+	// a breakpoint on a line without code is moved down to the next line with code, up to this far
+	BREAKPOINT_LINE_SEARCH = 20
+)
+
+// ListenAndServe serves DAP sessions on a loopback TCP address such as "localhost:4711", one at a time.
+func ListenAndServe(addr string) error {
+	l, err := loopback.Listen(addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	return loopback.Serve(l, func(conn net.Conn) (bool, error) {
+		return false, Serve(conn)
+	})
+}
+
+// Serve runs a debugging session on conn until the editor disconnects.
+func Serve(conn io.ReadWriter) error {
+	s := &session{
+		conn:     conn,
+		requests: make(chan request),
+		done:     make(chan struct{}),
+	}
+	go s.readRequests()
+	defer close(s.done)
+
+	return s.run()
+}
+
+type request struct {
+	message *message
+	err     error
+}
+
+type session struct {
+	conn     io.ReadWriter
+	writeMu  sync.Mutex
+	seq      int
+	requests chan request
+	done     chan struct{}
+
+	console     *nes.Console
+	debugger    *nes.Debugger
+	info        *nes.DebugInfo
+	sourceRoot  string
+	breakpoints map[string][]int // source path to breakpoint IDs
+	stopOnEntry bool
+	running     bool
+}
+
+// readRequests forwards the requests, so that pause can be handled while the console runs.
+func (s *session) readRequests() {
+	r := newReader(s.conn)
+	for {
+		m, err := readMessage(r)
+		select {
+		case s.requests <- request{m, err}:
+		case <-s.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *session) send(m *message) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	m.Seq = s.seq
+	return writeMessage(s.conn, m)
+}
+
+func (s *session) event(event string, body any) error {
+	return s.send(&message{Type: "event", Event: event, Body: body})
+}
+
+func (s *session) stopped(reason string, text string) error {
+	return s.event("stopped", map[string]any{
+		"reason":            reason,
+		"text":              text,
+		"threadId":          THREAD_ID,
+		"allThreadsStopped": true,
+	})
+}
+
+func (s *session) run() error {
+	for {
+		var r request
+		if s.running {
+			select {
+			case r = <-s.requests:
+			default:
+				if err := s.runFrame(); err != nil {
+					return err
+				}
+				continue
+			}
+		} else {
+			r = <-s.requests
+		}
+		if r.err != nil {
+			return r.err
+		}
+		if r.message.Type != "request" {
+			continue
+		}
+
+		body, failure := s.handle(r.message)
+		response := &message{
+			Type:       "response",
+			RequestSeq: r.message.Seq,
+			Command:    r.message.Command,
+			Success:    failure == nil,
+			Body:       body,
+		}
+		if failure != nil {
+			response.Message = failure.Error()
+		}
+		if err := s.send(response); err != nil {
+			return err
+		}
+
+		var err error
+		switch {
+		case failure != nil:
+		case r.message.Command == "launch":
+			err = s.event("initialized", nil)
+		case r.message.Command == "configurationDone" && s.stopOnEntry:
+			err = s.stopped("entry", "")
+		case r.message.Command == "pause":
+			err = s.stopped("pause", "")
+		case r.message.Command == "disconnect":
+			return nil
+		case r.message.Command == "terminate":
+			err = s.event("terminated", nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// runFrame runs up to the end of the frame, and reports where it stopped.
+func (s *session) runFrame() error {
+	stop, err := s.debugger.Run(1)
+	if err != nil {
+		s.running = false
+		if err := s.event("output", map[string]string{"category": "stderr", "output": err.Error() + "\n"}); err != nil {
+			return err
+		}
+		return s.stopped("exception", err.Error())
+	}
+	if stop == nil {
+		return nil
+	}
+
+	s.running = false
+	switch stop.Reason {
+	case nes.STOP_BREAKPOINT:
+		if stop.Breakpoint.Kind == nes.BREAK_EXECUTE {
+			return s.stopped("breakpoint", "")
+		}
+		return s.stopped("data breakpoint", stop.Error())
+	case nes.STOP_STEP:
+		return s.stopped("step", "")
+	}
+	return s.stopped("pause", stop.Error())
+}
+
+func (s *session) handle(m *message) (any, error) {
+	if s.console == nil {
+		switch m.Command {
+		case "initialize", "launch", "disconnect":
+		default:
+			return nil, fmt.Errorf("%s before launch", m.Command)
+		}
+	}
+
+	switch m.Command {
+	case "initialize":
+		return map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsConditionalBreakpoints":   true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(m.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(m.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]any{"breakpoints": s.setBreakpoints(args)}, nil
+	case "setExceptionBreakpoints":
+		return nil, nil
+	case "configurationDone":
+		s.running = !s.stopOnEntry
+		return nil, nil
+	case "threads":
+		return map[string]any{"threads": []thread{{ID: THREAD_ID, Name: "CPU"}}}, nil
+	case "stackTrace":
+		frames := s.stackTrace()
+		return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		return map[string]any{"scopes": []scope{
+			{Name: "Registers", VariablesReference: VARIABLES_REGISTERS},
+			{Name: "Zero page", VariablesReference: VARIABLES_ZERO_PAGE},
+			{Name: "Labels", VariablesReference: VARIABLES_LABELS},
+		}}, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(m.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]any{"variables": s.variables(args.VariablesReference)}, nil
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+		}
+		if err := json.Unmarshal(m.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args.Expression)
+	case "continue":
+		s.debugger.Continue()
+		s.running = true
+		return map[string]bool{"allThreadsContinued": true}, nil
+	case "next":
+		s.debugger.StepOver()
+		s.running = true
+		return nil, nil
+	case "stepIn":
+		s.debugger.StepInto()
+		s.running = true
+		return nil, nil
+	case "stepOut":
+		if err := s.debugger.StepOut(); err != nil {
+			return nil, err
+		}
+		s.running = true
+		return nil, nil
+	case "pause":
+		s.running = false
+		return nil, nil
+	case "disconnect", "terminate":
+		s.running = false
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request %s", m.Command)
+}
+
+func (s *session) launch(args launchArguments) error {
+	data, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+	console := nes.NewConsole()
+	if err := console.LoadROM(data); err != nil {
+		return err
+	}
+
+	path := args.DebugInfo
+	if path == "" {
+		path = strings.TrimSuffix(args.Program, filepath.Ext(args.Program)) + ".dbg"
+	}
+	f, err := os.Open(path)
+	switch {
+	case err == nil:
+		s.info, err = nes.ReadDebugInfo(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case args.DebugInfo != "" || !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	s.sourceRoot = args.SourceRoot
+	if s.sourceRoot == "" {
+		s.sourceRoot = filepath.Dir(path)
+	}
+	s.console = console
+	s.debugger = console.AttachDebugger()
+	s.breakpoints = map[string][]int{}
+	s.stopOnEntry = args.StopOnEntry
+	return nil
+}
+
+// sourcePath returns the path of a file of the debug info
+func (s *session) sourcePath(file string) string {
+	if filepath.IsAbs(file) {
+		return filepath.Clean(file)
+	}
+	return filepath.Join(s.sourceRoot, file)
+}
+
+// debugFile returns the file of the debug info at path
+func (s *session) debugFile(path string) (string, bool) {
+	if s.info == nil {
+		return "", false
+	}
+	path = filepath.Clean(path)
+	for _, file := range s.info.Files {
+		if s.sourcePath(file) == path {
+			return file, true
+		}
+	}
+	// the editor may have opened the sources somewhere else
+	for _, file := range s.info.Files {
+		if strings.HasSuffix(filepath.ToSlash(path), "/"+strings.TrimPrefix(filepath.ToSlash(file), "./")) {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+func (s *session) setBreakpoints(args setBreakpointsArguments) []breakpoint {
+	args.Source.Path = filepath.Clean(args.Source.Path)
+	for _, id := range s.breakpoints[args.Source.Path] {
+		s.debugger.RemoveBreakpoint(id)
+	}
+	delete(s.breakpoints, args.Source.Path)
+
+	file, found := s.debugFile(args.Source.Path)
+	results := make([]breakpoint, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		results[i] = breakpoint{Line: b.Line, Source: args.Source}
+		if !found {
+			results[i].Message = "no debug info for this file"
+			continue
+		}
+
+		line := b.Line
+		addresses := s.info.Addresses(file, line)
+		for len(addresses) == 0 && line < b.Line+BREAKPOINT_LINE_SEARCH {
+			line++
+			addresses = s.info.Addresses(file, line)
+		}
+		if len(addresses) == 0 {
+			results[i].Message = "no code on this line"
+			continue
+		}
+
+		for _, addr := range addresses {
+			bp, err := s.debugger.AddBreakpoint(nes.BREAK_EXECUTE, nes.SPACE_CPU, addr, addr, b.Condition)
+			if err != nil {
+				results[i].Message = err.Error()
+				break
+			}
+			s.breakpoints[args.Source.Path] = append(s.breakpoints[args.Source.Path], bp.ID)
+			results[i].ID = bp.ID
+			results[i].Verified = true
+		}
+		results[i].Line = line
+	}
+	return results
+}
+
+func (s *session) stackTrace() []stackFrame {
+	addresses := []uint16{s.console.CPU.ProgramCounter()}
+	stack := s.debugger.CallStack()
+	for i := len(stack) - 1; i >= 0; i-- {
+		addresses = append(addresses, stack[i].Caller)
+	}
+
+	frames := make([]stackFrame, len(addresses))
+	for i, addr := range addresses {
+		frames[i] = stackFrame{
+			ID:                          i + 1,
+			Name:                        s.symbolize(addr),
+			InstructionPointerReference: fmt.Sprintf("0x%04X", addr),
+		}
+		if s.info == nil {
+			continue
+		}
+		if location, ok := s.info.Location(addr); ok {
+			path := s.sourcePath(location.File)
+			frames[i].Source = &source{Name: filepath.Base(path), Path: path}
+			frames[i].Line = location.Line
+			frames[i].Column = 1
+		}
+	}
+	return frames
+}
+
+// symbolize returns the closest label at or before addr, such as "main+3"
+func (s *session) symbolize(addr uint16) string {
+	name := fmt.Sprintf("$%04X", addr)
+	if s.info == nil {
+		return name
+	}
+	var closest *nes.DebugSymbol
+	for i, sym := range s.info.Symbols {
+		if !sym.Label || sym.Value > addr || sym.Value < 0x8000 {
+			continue
+		}
+		if closest == nil || sym.Value > closest.Value {
+			closest = &s.info.Symbols[i]
+		}
+	}
+	switch {
+	case closest == nil:
+		return name
+	case closest.Value == addr:
+		return closest.Name
+	}
+	return fmt.Sprintf("%s+%d", closest.Name, addr-closest.Value)
+}
+
+func (s *session) variables(reference int) []variable {
+	var variables []variable
+	switch reference {
+	case VARIABLES_REGISTERS:
+		cpu := s.console.CPU.State()
+		flags := []byte("nv-bdizc")
+		for i := range flags {
+			if cpu.P&(0x80>>i) != 0 {
+				flags[i] -= 'a' - 'A'
+			}
+		}
+		variables = []variable{
+			{Name: "A", Value: fmt.Sprintf("$%02X", cpu.A)},
+			{Name: "X", Value: fmt.Sprintf("$%02X", cpu.X)},
+			{Name: "Y", Value: fmt.Sprintf("$%02X", cpu.Y)},
+			{Name: "P", Value: fmt.Sprintf("$%02X %s", cpu.P, flags)},
+			{Name: "SP", Value: fmt.Sprintf("$%02X", cpu.SP)},
+			{Name: "PC", Value: fmt.Sprintf("$%04X", cpu.PC)},
+		}
+	case VARIABLES_ZERO_PAGE:
+		for row := 0; row < 0x100; row += 0x10 {
+			values := make([]string, 0x10)
+			for i := range values {
+				values[i] = fmt.Sprintf("%02X", s.console.Bus.Peek(uint16(row+i)))
+			}
+			variables = append(variables, variable{Name: fmt.Sprintf("$%02X", row), Value: strings.Join(values, " ")})
+		}
+	case VARIABLES_LABELS:
+		if s.info == nil {
+			break
+		}
+		for _, sym := range s.info.Symbols {
+			inRAM := sym.Value < 0x0800 || (sym.Value >= 0x6000 && sym.Value < 0x8000)
+			if !sym.Label || !inRAM {
+				continue
+			}
+			size := sym.Size
+			if size < 1 {
+				size = 1
+			}
+			if size > 16 {
+				size = 16
+			}
+			values := make([]string, size)
+			for i := range values {
+				values[i] = fmt.Sprintf("$%02X", s.console.Bus.Peek(sym.Value+uint16(i)))
+			}
+			variables = append(variables, variable{Name: sym.Name, Value: strings.Join(values, " ")})
+		}
+		sort.Slice(variables, func(i, j int) bool {
+			return variables[i].Name < variables[j].Name
+		})
+	}
+	return variables
+}
+
+// evaluate computes a debugger expression, or reads the RAM at a label
+func (s *session) evaluate(source string) (any, error) {
+	if s.info != nil {
+		for _, sym := range s.info.Symbols {
+			if sym.Name == source && !sym.Label {
+				return map[string]any{
+					"result":             fmt.Sprintf("$%X (%d)", sym.Value, sym.Value),
+					"variablesReference": 0,
+				}, nil
+			}
+			if sym.Name == source {
+				value := s.console.Bus.Peek(sym.Value)
+				return map[string]any{
+					"result":             fmt.Sprintf("$%02X (%d) at $%04X", value, value, sym.Value),
+					"variablesReference": 0,
+				}, nil
+			}
+		}
+	}
+
+	expr, err := nes.ParseExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	value := expr.Value(s.console)
+	result := fmt.Sprintf("$%X (%d)", value, value)
+	if value < 0 {
+		result = fmt.Sprint(value)
+	}
+	return map[string]any{
+		"result":             result,
+		"variablesReference": 0,
+	}, nil
+}
@@ -0,0 +1,268 @@
+package dap
+
+import (
+	"encoding/json"
+	"go-nes/nes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testDebugInfo is the debug info of src/main.s
+//
+//	 1 .segment "CODE"
+//	 2 reset:  ldx #$00
+//	 3 loop:
+//	 4         jsr bump
+//	 5         jmp loop
+//	 6 bump:
+//	 7         inc counter
+//	 8         rts
+//	 9 .segment "ZEROPAGE"
+//	10 counter: .res 1
+const testDebugInfo = `version	major=2,minor=0
+file	id=0,name="src/main.s",size=120,mtime=0x65A1B2C3,mod=0
+line	id=0,file=0,line=2,span=0
+line	id=1,file=0,line=4,span=1
+line	id=2,file=0,line=5,span=2
+line	id=3,file=0,line=7,span=3
+line	id=4,file=0,line=8,span=4
+line	id=5,file=0,line=10,span=5
+seg	id=0,name="CODE",start=0x008000,size=0x000B,addrsize=absolute,type=ro,oname="main.nes",ooffs=16
+seg	id=1,name="ZEROPAGE",start=0x000010,size=0x0001,addrsize=zeropage,type=rw
+span	id=0,seg=0,start=0,size=2
+span	id=1,seg=0,start=2,size=3
+span	id=2,seg=0,start=5,size=3
+span	id=3,seg=0,start=8,size=2
+span	id=4,seg=0,start=10,size=1
+span	id=5,seg=1,start=0,size=1
+sym	id=0,name="reset",addrsize=absolute,scope=0,def=0,val=0x8000,seg=0,type=lab
+sym	id=1,name="loop",addrsize=absolute,scope=0,def=1,val=0x8002,seg=0,type=lab
+sym	id=2,name="bump",addrsize=absolute,scope=0,def=2,val=0x8008,seg=0,type=lab
+sym	id=3,name="counter",addrsize=zeropage,scope=0,def=3,size=1,val=0x10,seg=1,type=lab
+sym	id=4,name="PPUCTRL",addrsize=absolute,scope=0,def=4,val=0x2000,type=equ
+`
+
+func createTestROMForServerTest(t *testing.T) string {
+	programRom := make([]uint8, 2*nes.PROGRAM_ROM_PAGE_SIZE)
+	copy(programRom, []uint8{
+		0xa2, 0x00, // reset: LDX #$00
+		0x20, 0x08, 0x80, // loop: JSR bump
+		0x4c, 0x02, 0x80, // JMP loop
+		0xe6, 0x10, // bump: INC counter
+		0x60, // RTS
+	})
+	programRom[0x7ffc] = 0x00
+	programRom[0x7ffd] = 0x80
+
+	rom := []uint8{0x4E, 0x45, 0x53, 0x1A, 0x02, 0x01, 0x31, 00, 00, 00, 00, 00, 00, 00, 00, 00}
+	rom = append(rom, programRom...)
+	rom = append(rom, make([]uint8, nes.CHARACTER_ROM_PAGE_SIZE)...)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.nes")
+	assert.NoError(t, os.WriteFile(path, rom, 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.dbg"), []byte(testDebugInfo), 0o644))
+	return path
+}
+
+type testClient struct {
+	t        *testing.T
+	conn     net.Conn
+	seq      int
+	messages chan *message
+	events   []*message
+}
+
+func startTestServer(t *testing.T) (*testClient, chan error) {
+	server, client := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(server)
+		server.Close()
+	}()
+	c := &testClient{t: t, conn: client, messages: make(chan *message, 100)}
+	go func() {
+		r := newReader(client)
+		for {
+			m, err := readMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			c.messages <- m
+		}
+	}()
+	return c, done
+}
+
+// request sends a request and returns its response, keeping the events received meanwhile
+func (c *testClient) request(command string, arguments any) *message {
+	c.seq++
+	data, err := json.Marshal(arguments)
+	assert.NoError(c.t, err)
+	assert.NoError(c.t, writeMessage(c.conn, &message{Seq: c.seq, Type: "request", Command: command, Arguments: data}))
+	for m := range c.messages {
+		if m.Type == "event" {
+			c.events = append(c.events, m)
+			continue
+		}
+		assert.Equal(c.t, c.seq, m.RequestSeq)
+		assert.Equal(c.t, command, m.Command)
+		return m
+	}
+	c.t.Fatalf("connection closed waiting for %s", command)
+	return nil
+}
+
+// event waits for an event and returns its body
+func (c *testClient) event(name string) map[string]any {
+	for {
+		for i, m := range c.events {
+			if m.Event == name {
+				c.events = append(c.events[:i], c.events[i+1:]...)
+				body, _ := m.Body.(map[string]any)
+				return body
+			}
+		}
+		m, ok := <-c.messages
+		if !ok {
+			c.t.Fatalf("connection closed waiting for %s", name)
+		}
+		c.events = append(c.events, m)
+	}
+}
+
+func body[T any](t *testing.T, m *message) T {
+	assert.True(t, m.Success, m.Message)
+	data, err := json.Marshal(m.Body)
+	assert.NoError(t, err)
+	var v T
+	assert.NoError(t, json.Unmarshal(data, &v))
+	return v
+}
+
+type testStackTrace struct {
+	StackFrames []stackFrame `json:"stackFrames"`
+}
+
+type testVariables struct {
+	Variables []variable `json:"variables"`
+}
+
+func TestServerSession(t *testing.T) {
+	rom := createTestROMForServerTest(t)
+	source := filepath.Join(filepath.Dir(rom), "src", "main.s")
+	client, done := startTestServer(t)
+
+	assert.True(t, client.request("initialize", map[string]string{"adapterID": "go-nes"}).Success)
+	assert.True(t, client.request("launch", map[string]any{"program": rom}).Success)
+	client.event("initialized")
+
+	breakpoints := body[struct {
+		Breakpoints []breakpoint `json:"breakpoints"`
+	}](t, client.request("setBreakpoints", map[string]any{
+		"source":      map[string]string{"path": source},
+		"breakpoints": []map[string]int{{"line": 3}, {"line": 7}, {"line": 40}},
+	})).Breakpoints
+	assert.Len(t, breakpoints, 3)
+	// line 3 has no code, the breakpoint moves to the JSR
+	assert.True(t, breakpoints[0].Verified)
+	assert.Equal(t, 4, breakpoints[0].Line)
+	assert.True(t, breakpoints[1].Verified)
+	assert.Equal(t, 7, breakpoints[1].Line)
+	assert.False(t, breakpoints[2].Verified)
+
+	assert.True(t, client.request("configurationDone", nil).Success)
+	assert.Equal(t, "breakpoint", client.event("stopped")["reason"])
+	frames := body[testStackTrace](t, client.request("stackTrace", map[string]int{"threadId": THREAD_ID})).StackFrames
+	assert.Len(t, frames, 1)
+	assert.Equal(t, "loop", frames[0].Name)
+	assert.Equal(t, source, frames[0].Source.Path)
+	assert.Equal(t, 4, frames[0].Line)
+
+	assert.True(t, client.request("continue", map[string]int{"threadId": THREAD_ID}).Success)
+	assert.Equal(t, "breakpoint", client.event("stopped")["reason"])
+	frames = body[testStackTrace](t, client.request("stackTrace", map[string]int{"threadId": THREAD_ID})).StackFrames
+	assert.Len(t, frames, 2)
+	assert.Equal(t, "bump", frames[0].Name)
+	assert.Equal(t, 7, frames[0].Line)
+	assert.Equal(t, "loop", frames[1].Name)
+	assert.Equal(t, 4, frames[1].Line)
+
+	assert.True(t, client.request("next", map[string]int{"threadId": THREAD_ID}).Success)
+	assert.Equal(t, "step", client.event("stopped")["reason"])
+	registers := body[testVariables](t, client.request("variables", map[string]int{"variablesReference": VARIABLES_REGISTERS})).Variables
+	assert.Equal(t, variable{Name: "PC", Value: "$800A"}, registers[5])
+	labels := body[testVariables](t, client.request("variables", map[string]int{"variablesReference": VARIABLES_LABELS})).Variables
+	assert.Equal(t, []variable{{Name: "counter", Value: "$01"}}, labels)
+	zeroPage := body[testVariables](t, client.request("variables", map[string]int{"variablesReference": VARIABLES_ZERO_PAGE})).Variables
+	assert.Len(t, zeroPage, 16)
+	assert.Equal(t, variable{Name: "$10", Value: "01 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00"}, zeroPage[1])
+
+	assert.True(t, client.request("stepOut", map[string]int{"threadId": THREAD_ID}).Success)
+	assert.Equal(t, "step", client.event("stopped")["reason"])
+	frames = body[testStackTrace](t, client.request("stackTrace", map[string]int{"threadId": THREAD_ID})).StackFrames
+	assert.Equal(t, 5, frames[0].Line)
+	assert.False(t, client.request("stepOut", map[string]int{"threadId": THREAD_ID}).Success)
+
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"counter", "$01 (1) at $0010"},
+		{"PPUCTRL", "$2000 (8192)"},
+		{"[$10] + 1", "$2 (2)"},
+		{"-1", "-1"},
+	}
+	for _, tt := range tests {
+		result := body[map[string]any](t, client.request("evaluate", map[string]string{"expression": tt.expression}))
+		assert.Equal(t, tt.expected, result["result"], tt.expression)
+	}
+	assert.False(t, client.request("evaluate", map[string]string{"expression": "1 +"}).Success)
+
+	// without breakpoints the program runs until paused
+	client.request("setBreakpoints", map[string]any{"source": map[string]string{"path": source}})
+	assert.True(t, client.request("continue", map[string]int{"threadId": THREAD_ID}).Success)
+	assert.True(t, client.request("pause", map[string]int{"threadId": THREAD_ID}).Success)
+	assert.Equal(t, "pause", client.event("stopped")["reason"])
+
+	assert.True(t, client.request("disconnect", nil).Success)
+	assert.NoError(t, <-done)
+}
+
+func TestServerStopOnEntry(t *testing.T) {
+	rom := createTestROMForServerTest(t)
+	client, done := startTestServer(t)
+
+	assert.False(t, client.request("threads", nil).Success)
+	assert.True(t, client.request("launch", map[string]any{"program": rom, "stopOnEntry": true}).Success)
+	client.event("initialized")
+	assert.True(t, client.request("configurationDone", nil).Success)
+	assert.Equal(t, "entry", client.event("stopped")["reason"])
+
+	frames := body[testStackTrace](t, client.request("stackTrace", map[string]int{"threadId": THREAD_ID})).StackFrames
+	assert.Equal(t, "reset", frames[0].Name)
+	assert.Equal(t, 2, frames[0].Line)
+
+	assert.True(t, client.request("disconnect", nil).Success)
+	assert.NoError(t, <-done)
+}
+
+func TestServerLaunchErrors(t *testing.T) {
+	rom := createTestROMForServerTest(t)
+	client, done := startTestServer(t)
+
+	assert.False(t, client.request("launch", map[string]any{"program": rom + ".missing"}).Success)
+	assert.False(t, client.request("launch", map[string]any{"program": rom, "debugInfo": rom + ".dbg"}).Success)
+
+	assert.True(t, client.request("disconnect", nil).Success)
+	assert.NoError(t, <-done)
+}
+
+func TestListenAndServeLoopbackOnly(t *testing.T) {
+	assert.ErrorIs(t, ListenAndServe("0.0.0.0:0"), ErrNotLoopback)
+}
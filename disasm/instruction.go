@@ -0,0 +1,69 @@
+// Package disasm disassembles 6502 code from byte slices, and whole NES ROMs into ca65 source.
+package disasm
+
+import (
+	"fmt"
+	"go-nes/nes"
+)
+
+var (
+	ErrUnknownOpcode = nes.ErrIllegalOpcode
+	ErrTruncated     = nes.ErrTruncatedInstruction
+)
+
+// Instruction is a decoded 2A03 instruction, with what the disassembler needs on top of nes.Instruction.
+type Instruction struct {
+	nes.Instruction
+}
+
+// Decode decodes the 2A03 instruction at the start of data, which is mapped at addr.
+func Decode(data []uint8, addr uint16) (Instruction, error) {
+	i, err := nes.DecodeInstruction(data, addr, nes.CPU_VARIANT_2A03)
+	return Instruction{i}, err
+}
+
+// Flow reports how the execution goes on after the instruction: whether it can continue with the next one,
+// and whether it jumps to Target.
+func (i Instruction) Flow() (next bool, jump bool) {
+	switch i.Op.Mnemonic {
+	case "JMP":
+		return false, i.Op.Mode == nes.ABSOLUTE
+	case "JSR":
+		return true, true
+	case "RTS", "RTI", "BRK":
+		return false, false
+	}
+	if i.Op.Mode == nes.RELATIVE {
+		return true, true
+	}
+	return true, false
+}
+
+func (i Instruction) String() string {
+	return i.Format(nil)
+}
+
+// Format formats the instruction in ca65 syntax, undocumented ones being marked with "*".
+// label names target addresses, it can be nil.
+func (i Instruction) Format(label func(addr uint16) (string, bool)) string {
+	operand := i.FormatOperand(func(addr uint16, digits int) string {
+		s := fmt.Sprintf("$%0*X", digits, addr)
+		if label != nil {
+			if name, ok := label(addr); ok {
+				s = name
+			}
+		}
+		// ca65 would pick zero page addressing for absolute operands below $100
+		switch i.Op.Mode {
+		case nes.ABSOLUTE, nes.ABSOLUTE_X, nes.ABSOLUTE_Y:
+			if i.Operand < 0x100 {
+				s = "a:" + s
+			}
+		}
+		return s
+	})
+	if operand == "" {
+		return i.Op.Mnemonic
+	}
+	return i.Op.Mnemonic + " " + operand
+}
@@ -0,0 +1,103 @@
+package disasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data []uint8
+		addr uint16
+		want string
+	}{
+		{"implied", []uint8{0xea}, 0x8000, "NOP"},
+		{"accumulator", []uint8{0x0a}, 0x8000, "ASL A"},
+		{"immediate", []uint8{0xa9, 0x05}, 0x8000, "LDA #$05"},
+		{"zero page", []uint8{0x85, 0x10}, 0x8000, "STA $10"},
+		{"zero page x", []uint8{0xb5, 0x10}, 0x8000, "LDA $10,X"},
+		{"zero page y", []uint8{0xb6, 0x10}, 0x8000, "LDX $10,Y"},
+		{"absolute", []uint8{0x8d, 0x00, 0x20}, 0x8000, "STA $2000"},
+		{"absolute in zero page", []uint8{0xad, 0x10, 0x00}, 0x8000, "LDA a:$0010"},
+		{"absolute x", []uint8{0xbd, 0x00, 0x03}, 0x8000, "LDA $0300,X"},
+		{"absolute y", []uint8{0xb9, 0x00, 0x03}, 0x8000, "LDA $0300,Y"},
+		{"indirect", []uint8{0x6c, 0xfc, 0xff}, 0x8000, "JMP ($FFFC)"},
+		{"indirect x", []uint8{0xa1, 0x20}, 0x8000, "LDA ($20,X)"},
+		{"indirect y", []uint8{0xb1, 0x20}, 0x8000, "LDA ($20),Y"},
+		{"branch forward", []uint8{0xd0, 0x02}, 0x8000, "BNE $8004"},
+		{"branch backward", []uint8{0xd0, 0xfe}, 0x8000, "BNE $8000"},
+		{"undocumented", []uint8{0xa7, 0x10}, 0x8000, "*LAX $10"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i, err := Decode(tt.data, tt.addr)
+			assert.NoError(t, err)
+			assert.Equal(t, len(tt.data), i.Length())
+			assert.Equal(t, tt.want, i.String())
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, err := Decode(nil, 0x8000)
+	assert.ErrorIs(t, err, ErrTruncated)
+	_, err = Decode([]uint8{0x8d, 0x00}, 0x8000)
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestFormatLabels(t *testing.T) {
+	labels := map[uint16]string{0x8004: "loop", 0x0010: "counter"}
+	label := func(addr uint16) (string, bool) {
+		name, ok := labels[addr]
+		return name, ok
+	}
+
+	tests := []struct {
+		data []uint8
+		want string
+	}{
+		{[]uint8{0xd0, 0x02}, "BNE loop"},
+		{[]uint8{0x20, 0x04, 0x80}, "JSR loop"},
+		{[]uint8{0xe6, 0x10}, "INC counter"},
+		{[]uint8{0xee, 0x10, 0x00}, "INC a:counter"},
+		{[]uint8{0xa9, 0x10}, "LDA #$10"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.want, func(t *testing.T) {
+			i, err := Decode(tt.data, 0x8000)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, i.Format(label))
+		})
+	}
+}
+
+func TestFlow(t *testing.T) {
+	tests := []struct {
+		name string
+		data []uint8
+		next bool
+		jump bool
+	}{
+		{"load", []uint8{0xa9, 0x00}, true, false},
+		{"jump", []uint8{0x4c, 0x00, 0x80}, false, true},
+		{"indirect jump", []uint8{0x6c, 0x00, 0x03}, false, false},
+		{"subroutine", []uint8{0x20, 0x00, 0x80}, true, true},
+		{"return", []uint8{0x60}, false, false},
+		{"interrupt return", []uint8{0x40}, false, false},
+		{"branch", []uint8{0xf0, 0x10}, true, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i, err := Decode(tt.data, 0x8000)
+			assert.NoError(t, err)
+			next, jump := i.Flow()
+			assert.Equal(t, tt.next, next)
+			assert.Equal(t, tt.jump, jump)
+		})
+	}
+}
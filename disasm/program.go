@@ -0,0 +1,284 @@
+package disasm
+
+import (
+	"fmt"
+	"go-nes/nes"
+	"regexp"
+	"sort"
+)
+
+type ByteKind uint8
+
+const (
+	BYTE_UNKNOWN ByteKind = iota // not reached by the analysis, output as data
+	BYTE_CODE                    // first byte of an instruction
+	BYTE_OPERAND                 // operand byte of an instruction
+	BYTE_DATA                    // known to be data, such as the vectors
+)
+
+// the vectors at the end of the address space
+const (
+	VECTOR_NMI   uint16 = 0xfffa
+	VECTOR_RESET uint16 = 0xfffc
+	VECTOR_IRQ   uint16 = 0xfffe
+)
+
+// Bank is a part of PRG-ROM mapped at Origin.
+type Bank struct {
+	Number    int
+	Origin    uint16
+	ROMOffset int
+	Data      []uint8
+	Fixed     bool // mapped at all times, so reachable from the other banks
+	Kinds     []ByteKind
+
+	labels map[uint16]string
+}
+
+func (b *Bank) contains(addr uint16) bool {
+	return addr >= b.Origin && int(addr)-int(b.Origin) < len(b.Data)
+}
+
+// Program is a ROM split in banks as the mapper places them.
+// NROM and CNROM are mapped as a whole; other mappers are assumed to switch 16KB banks at $8000
+// with the last one fixed at $C000.
+type Program struct {
+	Header  []uint8 // iNES header, and trainer if any
+	Banks   []*Bank
+	CHR     []uint8
+	Symbols *nes.SymbolTable // names labels and RAM addresses, may be nil
+
+	mirrored bool       // a 16KB NROM is mapped at both $8000 and $C000
+	pending  []location // entry points of the next Analyze
+}
+
+// location is an address in a bank.
+type location struct {
+	bank *Bank
+	addr uint16
+}
+
+// NewProgram splits an iNES image in banks. Nothing is marked as code until Analyze.
+func NewProgram(rom []uint8) (*Program, error) {
+	cartridge, err := nes.NewCartridge(rom)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := 16
+	if rom[6]&0b100 != 0 {
+		headerSize += 512
+	}
+	p := &Program{Header: rom[:headerSize], CHR: cartridge.CharacterRom}
+
+	prg := cartridge.ProgramRom
+	addBank := func(origin uint16, offset, size int, fixed bool) {
+		p.Banks = append(p.Banks, &Bank{
+			Number:    len(p.Banks),
+			Origin:    origin,
+			ROMOffset: offset,
+			Data:      prg[offset : offset+size],
+			Fixed:     fixed,
+			Kinds:     make([]ByteKind, size),
+			labels:    map[uint16]string{},
+		})
+	}
+	// only CHR-ROM is switched by CNROM
+	unbanked := (cartridge.Mapper == 0 || cartridge.Mapper == 3) && len(prg) <= 0x8000
+	switch {
+	case unbanked && len(prg) == 0x4000:
+		addBank(0xc000, 0, 0x4000, true)
+		p.mirrored = true
+	case unbanked:
+		addBank(0x8000, 0, len(prg), true)
+	default:
+		for offset := 0; offset < len(prg); offset += 0x4000 {
+			last := offset+0x4000 >= len(prg)
+			origin := uint16(0x8000)
+			if last {
+				origin = 0xc000
+			}
+			addBank(origin, offset, 0x4000, last)
+		}
+	}
+	return p, nil
+}
+
+// resolve returns the bank addr is in as seen from the code of bank from, nil if it is not mapped for sure.
+func (p *Program) resolve(from *Bank, addr uint16) *Bank {
+	if p.mirrored && addr >= 0x8000 && addr < 0xc000 {
+		addr += 0x4000
+	}
+	if from != nil && from.contains(addr) {
+		return from
+	}
+	for _, b := range p.Banks {
+		if b.Fixed && b.contains(addr) {
+			return b
+		}
+	}
+	return nil
+}
+
+func (p *Program) mirror(addr uint16) uint16 {
+	if p.mirrored && addr >= 0x8000 && addr < 0xc000 {
+		return addr + 0x4000
+	}
+	return addr
+}
+
+// Analyze marks the code reachable from the vectors and the extra entry points by recursive descent.
+// Entry points outside of the fixed banks are looked up in the first bank containing them.
+func (p *Program) Analyze(entries ...uint16) {
+	queue := p.pending
+	p.pending = nil
+
+	vectors := p.resolve(nil, VECTOR_NMI)
+	if vectors != nil && vectors.contains(VECTOR_IRQ+1) {
+		names := map[uint16]string{VECTOR_NMI: "nmi", VECTOR_RESET: "reset", VECTOR_IRQ: "irq"}
+		for _, vector := range []uint16{VECTOR_NMI, VECTOR_RESET, VECTOR_IRQ} {
+			i := int(vector - vectors.Origin)
+			vectors.Kinds[i] = BYTE_DATA
+			vectors.Kinds[i+1] = BYTE_DATA
+			target := uint16(vectors.Data[i]) | uint16(vectors.Data[i+1])<<8
+			if b := p.resolve(vectors, target); b != nil {
+				target = p.mirror(target)
+				if _, ok := b.labels[target]; !ok {
+					b.labels[target] = names[vector]
+				}
+				queue = append(queue, location{b, target})
+			}
+		}
+	}
+	for _, entry := range entries {
+		b := p.resolve(nil, entry)
+		if b == nil {
+			for _, bank := range p.Banks {
+				if bank.contains(entry) {
+					b = bank
+					break
+				}
+			}
+		}
+		if b != nil {
+			queue = append(queue, location{b, p.mirror(entry)})
+		}
+	}
+
+	for len(queue) > 0 {
+		l := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		b, addr := l.bank, l.addr
+		if _, ok := b.labels[addr]; !ok {
+			b.labels[addr] = ""
+		}
+
+		for b.contains(addr) {
+			offset := int(addr - b.Origin)
+			if b.Kinds[offset] != BYTE_UNKNOWN {
+				// already disassembled, or jumping in the middle of an instruction or into data
+				break
+			}
+			i, err := Decode(b.Data[offset:], addr)
+			if err != nil || !i.Legal() {
+				break
+			}
+			free := true
+			for n := 1; n < i.Length(); n++ {
+				free = free && b.Kinds[offset+n] == BYTE_UNKNOWN
+			}
+			if !free {
+				break
+			}
+			b.Kinds[offset] = BYTE_CODE
+			for n := 1; n < i.Length(); n++ {
+				b.Kinds[offset+n] = BYTE_OPERAND
+			}
+
+			next, jump := i.Flow()
+			if target, ok := i.Target(); ok && i.Op.Mode != nes.INDIRECT_X && i.Op.Mode != nes.INDIRECT_Y {
+				if tb := p.resolve(b, target); tb != nil {
+					target = p.mirror(target)
+					if _, ok := tb.labels[target]; !ok {
+						tb.labels[target] = ""
+					}
+					if jump {
+						queue = append(queue, location{tb, target})
+					}
+				}
+			}
+			if !next {
+				break
+			}
+			addr += uint16(i.Length())
+		}
+	}
+}
+
+// ApplyCodeDataLog uses a .cdl file of the Code/Data Logger, of which only the PRG-ROM part matters, for the next Analyze:
+// the bytes only logged as data are marked as data, and every run of bytes logged as code is an entry point.
+func (p *Program) ApplyCodeDataLog(cdl []uint8) error {
+	size := 0
+	for _, b := range p.Banks {
+		size += len(b.Data)
+	}
+	if len(cdl) < size {
+		return fmt.Errorf("%w: %d bytes for %d bytes of PRG-ROM", nes.ErrInvalidCodeDataLog, len(cdl), size)
+	}
+	for _, b := range p.Banks {
+		code := false
+		for i := range b.Data {
+			flags := cdl[b.ROMOffset+i]
+			switch {
+			case flags&nes.CDL_CODE != 0:
+				if !code {
+					p.pending = append(p.pending, location{b, b.Origin + uint16(i)})
+				}
+			case flags&nes.CDL_DATA != 0 && b.Kinds[i] == BYTE_UNKNOWN:
+				b.Kinds[i] = BYTE_DATA
+			}
+			code = flags&nes.CDL_CODE != 0
+		}
+	}
+	return nil
+}
+
+var labelPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// nameLabels gives every label a unique name, from the symbols when possible.
+func (p *Program) nameLabels() {
+	used := map[string]bool{}
+	for _, b := range p.Banks {
+		for _, name := range b.labels {
+			if name != "" {
+				used[name] = true
+			}
+		}
+	}
+	for _, b := range p.Banks {
+		addrs := make([]uint16, 0, len(b.labels))
+		for addr := range b.labels {
+			addrs = append(addrs, addr)
+		}
+		sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+		for _, addr := range addrs {
+			if b.labels[addr] != "" {
+				continue
+			}
+			if p.Symbols != nil {
+				name, ok := p.Symbols.NameAt(addr, b.ROMOffset+int(addr-b.Origin))
+				if ok && labelPattern.MatchString(name) && !used[name] {
+					b.labels[addr] = name
+					used[name] = true
+					continue
+				}
+			}
+			name := fmt.Sprintf("L%04X", addr)
+			if len(p.Banks) > 1 {
+				name = fmt.Sprintf("B%d_%04X", b.Number, addr)
+			}
+			b.labels[addr] = name
+			used[name] = true
+		}
+	}
+}
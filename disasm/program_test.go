@@ -0,0 +1,145 @@
+package disasm
+
+import (
+	"go-nes/nes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestROM(program []uint8) []uint8 {
+	programRom := make([]uint8, 2*nes.PROGRAM_ROM_PAGE_SIZE)
+	copy(programRom, program)
+	programRom[0x7ffa] = 0x0d // nmi
+	programRom[0x7ffb] = 0x80
+	programRom[0x7ffc] = 0x00 // reset
+	programRom[0x7ffd] = 0x80
+	programRom[0x7ffe] = 0x0d // irq
+	programRom[0x7fff] = 0x80
+
+	rom := []uint8{0x4E, 0x45, 0x53, 0x1A, 0x02, 0x01, 0x31, 00, 00, 00, 00, 00, 00, 00, 00, 00}
+	rom = append(rom, programRom...)
+	rom = append(rom, make([]uint8, nes.CHARACTER_ROM_PAGE_SIZE)...)
+	return rom
+}
+
+var testProgram = []uint8{
+	0xa2, 0x00, // $8000 reset: LDX #$00
+	0x20, 0x08, 0x80, // $8002 loop: JSR bump
+	0x4c, 0x02, 0x80, // $8005 JMP loop
+	0xe6, 0x10, // $8008 bump: INC $10
+	0x60,       // $800A RTS
+	0x01, 0x02, // $800B data
+	0xbd, 0x00, 0x03, // $800D nmi: LDA $0300,X
+	0x40,       // $8010 RTI
+	0xa7, 0x10, // $8011 *LAX $10, only reached from the extra entry point
+}
+
+func TestAnalyze(t *testing.T) {
+	program, err := NewProgram(createTestROM(testProgram))
+	assert.NoError(t, err)
+	assert.Len(t, program.Banks, 1)
+	program.Analyze(0x8011)
+
+	b := program.Banks[0]
+	assert.Equal(t, uint16(0x8000), b.Origin)
+	want := []ByteKind{
+		BYTE_CODE, BYTE_OPERAND,
+		BYTE_CODE, BYTE_OPERAND, BYTE_OPERAND,
+		BYTE_CODE, BYTE_OPERAND, BYTE_OPERAND,
+		BYTE_CODE, BYTE_OPERAND,
+		BYTE_CODE,
+		BYTE_UNKNOWN, BYTE_UNKNOWN,
+		BYTE_CODE, BYTE_OPERAND, BYTE_OPERAND,
+		BYTE_CODE,
+		BYTE_UNKNOWN, BYTE_UNKNOWN,
+	}
+	assert.Equal(t, want, b.Kinds[:len(want)])
+	assert.Equal(t, BYTE_DATA, b.Kinds[0x7ffa])
+	assert.Equal(t, BYTE_DATA, b.Kinds[0x7fff])
+	assert.Equal(t, "reset", b.labels[0x8000])
+	assert.Equal(t, "nmi", b.labels[0x800d])
+}
+
+func TestAnalyzeMirrored(t *testing.T) {
+	rom := createTestROM(testProgram)
+	// 16KB PRG-ROM, the vectors pointing to the $8000 mirror
+	rom[4] = 0x01
+	copy(rom[16+0x3ffa:], rom[16+0x7ffa:16+0x8000])
+	rom = append(rom[:16+0x4000], rom[16+0x8000:]...)
+
+	program, err := NewProgram(rom)
+	assert.NoError(t, err)
+	assert.Len(t, program.Banks, 1)
+	program.Analyze()
+
+	b := program.Banks[0]
+	assert.Equal(t, uint16(0xc000), b.Origin)
+	assert.Equal(t, BYTE_CODE, b.Kinds[0])
+	assert.Equal(t, BYTE_CODE, b.Kinds[8])
+	assert.Equal(t, "reset", b.labels[0xc000])
+}
+
+func TestApplyCodeDataLog(t *testing.T) {
+	// INX, RTS only reached through a jump table
+	program, err := NewProgram(createTestROM(append(append([]uint8{}, testProgram...), 0xe8, 0x60)))
+	assert.NoError(t, err)
+	cdl := make([]uint8, 0x8000)
+	cdl[0x0b], cdl[0x0c] = nes.CDL_DATA, nes.CDL_DATA
+	cdl[0x13], cdl[0x14] = nes.CDL_CODE, nes.CDL_CODE
+	assert.NoError(t, program.ApplyCodeDataLog(cdl))
+	program.Analyze()
+
+	b := program.Banks[0]
+	assert.Equal(t, []ByteKind{BYTE_DATA, BYTE_DATA}, b.Kinds[0x0b:0x0d])
+	assert.Equal(t, []ByteKind{BYTE_CODE, BYTE_CODE}, b.Kinds[0x13:0x15])
+
+	err = program.ApplyCodeDataLog(cdl[:0x4000])
+	assert.ErrorIs(t, err, nes.ErrInvalidCodeDataLog)
+}
+
+func TestWriteSource(t *testing.T) {
+	program, err := NewProgram(createTestROM(testProgram))
+	assert.NoError(t, err)
+	program.Symbols = nes.NewSymbolTable()
+	program.Symbols.Add(nes.Symbol{Name: "counter", Address: 0x10, ROMOffset: -1})
+	program.Symbols.Add(nes.Symbol{Name: "buffer", Address: 0x300, Size: 0x100, ROMOffset: -1})
+	program.Symbols.Add(nes.Symbol{Name: "bump", Address: 0x8008, ROMOffset: 8})
+	program.Analyze(0x8011)
+
+	var source strings.Builder
+	assert.NoError(t, program.WriteSource(&source))
+	want := strings.Join([]string{
+		"counter = $10",
+		"buffer = $0300",
+		"",
+		".segment \"HEADER\"",
+		"\t.byte $4E,$45,$53,$1A,$02,$01,$31,$00,$00,$00,$00,$00,$00,$00,$00,$00",
+		"",
+		".segment \"BANK0\"",
+		".org $8000",
+		"reset:",
+		"\tLDX #$00",
+		"L8002:",
+		"\tJSR bump",
+		"\tJMP L8002",
+		"bump:",
+		"\tINC counter",
+		"\tRTS",
+		"\t.byte $01,$02",
+		"nmi:",
+		"\tLDA buffer,X",
+		"\tRTI",
+		"L8011:",
+		"\t.byte $A7,$10,$00",
+	}, "\n")
+	assert.Contains(t, source.String(), want)
+	assert.Contains(t, source.String(), "\t.word nmi\n\t.word reset\n\t.word nmi\n")
+	assert.Contains(t, source.String(), ".segment \"CHARS\"\n")
+
+	var cfg strings.Builder
+	assert.NoError(t, program.WriteLinkerConfig(&cfg))
+	assert.Contains(t, cfg.String(), "PRG0: start = $8000, size = $8000, fill = yes, file = %O;")
+	assert.Contains(t, cfg.String(), "BANK0: load = PRG0, type = ro;")
+}
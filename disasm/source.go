@@ -0,0 +1,198 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const BYTES_PER_LINE = 16
+
+// WriteSource writes the program as ca65 source, which assembles back to the same ROM with the
+// linker configuration of WriteLinkerConfig. Call Analyze first to tell code from data.
+func (p *Program) WriteSource(w io.Writer) error {
+	p.nameLabels()
+	s := &sourceWriter{program: p, externs: map[string]uint16{}}
+
+	var body strings.Builder
+	s.bytes(&body, "HEADER", p.Header)
+	for _, b := range p.Banks {
+		fmt.Fprintf(&body, "\n.segment \"BANK%d\"\n.org $%04X\n", b.Number, b.Origin)
+		s.bank(&body, b)
+	}
+	if len(p.CHR) > 0 {
+		body.WriteString("\n")
+		s.bytes(&body, "CHARS", p.CHR)
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "; disassembled by go-nes")
+	fmt.Fprintln(out, `.setcpu "6502"`)
+	if len(s.externs) > 0 {
+		names := make([]string, 0, len(s.externs))
+		for name := range s.externs {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return s.externs[names[i]] < s.externs[names[j]] || (s.externs[names[i]] == s.externs[names[j]] && names[i] < names[j])
+		})
+		fmt.Fprintln(out)
+		for _, name := range names {
+			value := s.externs[name]
+			if value < 0x100 {
+				fmt.Fprintf(out, "%s = $%02X\n", name, value)
+			} else {
+				fmt.Fprintf(out, "%s = $%04X\n", name, value)
+			}
+		}
+	}
+	fmt.Fprintln(out)
+	out.WriteString(body.String())
+	return out.Flush()
+}
+
+// WriteLinkerConfig writes the ld65 configuration placing the segments of WriteSource in a .nes file.
+func (p *Program) WriteLinkerConfig(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "MEMORY {")
+	fmt.Fprintf(out, "    HEADER: start = $0000, size = $%04X, fill = yes, file = %%O;\n", len(p.Header))
+	for _, b := range p.Banks {
+		fmt.Fprintf(out, "    PRG%d: start = $%04X, size = $%04X, fill = yes, file = %%O;\n", b.Number, b.Origin, len(b.Data))
+	}
+	if len(p.CHR) > 0 {
+		fmt.Fprintf(out, "    CHR: start = $0000, size = $%04X, fill = yes, file = %%O;\n", len(p.CHR))
+	}
+	fmt.Fprintln(out, "}")
+	fmt.Fprintln(out, "SEGMENTS {")
+	fmt.Fprintln(out, "    HEADER: load = HEADER, type = ro;")
+	for _, b := range p.Banks {
+		fmt.Fprintf(out, "    BANK%d: load = PRG%d, type = ro;\n", b.Number, b.Number)
+	}
+	if len(p.CHR) > 0 {
+		fmt.Fprintln(out, "    CHARS: load = CHR, type = ro;")
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+type sourceWriter struct {
+	program *Program
+	externs map[string]uint16 // symbols outside of PRG-ROM which are referenced
+}
+
+func (s *sourceWriter) bytes(w *strings.Builder, segment string, data []uint8) {
+	fmt.Fprintf(w, ".segment \"%s\"\n", segment)
+	for i := 0; i < len(data); i += BYTES_PER_LINE {
+		writeBytes(w, data[i:min(i+BYTES_PER_LINE, len(data))])
+	}
+}
+
+func writeBytes(w *strings.Builder, data []uint8) {
+	values := make([]string, len(data))
+	for i, v := range data {
+		values[i] = fmt.Sprintf("$%02X", v)
+	}
+	fmt.Fprintf(w, "\t.byte %s\n", strings.Join(values, ","))
+}
+
+// label names addr as seen from the code of bank from.
+func (s *sourceWriter) label(from *Bank, addr uint16) (string, bool) {
+	p := s.program
+	if b := p.resolve(from, addr); b != nil {
+		if p.mirror(addr) != addr {
+			// the label would assemble to the other mirror
+			return "", false
+		}
+		offset := int(addr - b.Origin)
+		start := offset
+		for start > 0 && b.Kinds[start] == BYTE_OPERAND {
+			start--
+		}
+		name, ok := b.labels[b.Origin+uint16(start)]
+		switch {
+		case !ok:
+			return "", false
+		case start != offset:
+			return fmt.Sprintf("%s+%d", name, offset-start), true
+		}
+		return name, true
+	}
+
+	if p.Symbols == nil || addr >= 0x8000 {
+		return "", false
+	}
+	name, ok := p.Symbols.NameAt(addr, -1)
+	if !ok {
+		return "", false
+	}
+	base, _, _ := strings.Cut(name, "+")
+	symbol, ok := p.Symbols.Lookup(base)
+	if !ok || !labelPattern.MatchString(base) || s.isLabel(base) {
+		return "", false
+	}
+	if value, defined := s.externs[base]; defined && value != symbol.Address {
+		return "", false
+	}
+	s.externs[base] = symbol.Address
+	return name, true
+}
+
+func (s *sourceWriter) isLabel(name string) bool {
+	for _, b := range s.program.Banks {
+		for _, label := range b.labels {
+			if label == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *sourceWriter) bank(w *strings.Builder, b *Bank) {
+	label := func(addr uint16) (string, bool) {
+		return s.label(b, addr)
+	}
+	// data runs stop at labels and code
+	boundary := func(offset int) bool {
+		if b.Kinds[offset] == BYTE_CODE {
+			return true
+		}
+		_, ok := b.labels[b.Origin+uint16(offset)]
+		return ok
+	}
+
+	for offset := 0; offset < len(b.Data); {
+		addr := b.Origin + uint16(offset)
+		if name, ok := b.labels[addr]; ok && b.Kinds[offset] != BYTE_OPERAND {
+			fmt.Fprintf(w, "%s:\n", name)
+		}
+
+		switch {
+		case b.Kinds[offset] == BYTE_CODE:
+			i, _ := Decode(b.Data[offset:], addr)
+			fmt.Fprintf(w, "\t%s\n", i.Format(label))
+			offset += i.Length()
+		case isVector(addr) && offset+1 < len(b.Data) && b.Kinds[offset] == BYTE_DATA && b.Kinds[offset+1] == BYTE_DATA:
+			target := uint16(b.Data[offset]) | uint16(b.Data[offset+1])<<8
+			name, ok := label(target)
+			if !ok {
+				name = fmt.Sprintf("$%04X", target)
+			}
+			fmt.Fprintf(w, "\t.word %s\n", name)
+			offset += 2
+		default:
+			end := offset + 1
+			for end < len(b.Data) && end-offset < BYTES_PER_LINE && !boundary(end) && !isVector(b.Origin+uint16(end)) {
+				end++
+			}
+			writeBytes(w, b.Data[offset:end])
+			offset = end
+		}
+	}
+}
+
+func isVector(addr uint16) bool {
+	return addr == VECTOR_NMI || addr == VECTOR_RESET || addr == VECTOR_IRQ
+}
@@ -0,0 +1,84 @@
+package gdbstub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// interruptByte is sent by GDB outside of any packet to stop the target
+const interruptByte = 0x03
+
+var errInterrupt = errors.New("interrupt")
+
+// readPacket reads the next "$data#checksum" packet and acknowledges it.
+// It returns errInterrupt when the interrupt byte is received instead.
+func readPacket(r *bufio.Reader, w io.Writer) (string, error) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case interruptByte:
+			return "", errInterrupt
+		case '$':
+		default:
+			// acknowledgements and noise between packets
+			continue
+		}
+
+		data, err := r.ReadString('#')
+		if err != nil {
+			return "", err
+		}
+		data = data[:len(data)-1]
+
+		sum := make([]byte, 2)
+		if _, err := io.ReadFull(r, sum); err != nil {
+			return "", err
+		}
+		expected, err := strconv.ParseUint(string(sum), 16, 8)
+		if err != nil || uint8(expected) != checksum(data) {
+			// ask for a retransmission
+			if _, err := w.Write([]byte{'-'}); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if _, err := w.Write([]byte{'+'}); err != nil {
+			return "", err
+		}
+		return unescape(data), nil
+	}
+}
+
+func writePacket(w io.Writer, data string) error {
+	_, err := fmt.Fprintf(w, "$%s#%02x", data, checksum(data))
+	return err
+}
+
+func checksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// unescape undoes the "}" escaping of binary data
+func unescape(data string) string {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			out = append(out, data[i]^0x20)
+			continue
+		}
+		out = append(out, data[i])
+	}
+	return string(out)
+}
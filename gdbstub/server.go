@@ -0,0 +1,461 @@
+// Package gdbstub exposes a Console to debuggers speaking the GDB remote serial protocol.
+// See https://sourceware.org/gdb/current/onlinedocs/gdb.html/Remote-Protocol.html
+//
+// The registers are a, x, y, p, sp (8 bits) and pc (16 bits little endian), in this order.
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"go-nes/internal/loopback"
+	"go-nes/nes"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrNotLoopback = loopback.ErrNotLoopback
+
+const targetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.gnu.gdb.6502.core">
+    <reg name="a" bitsize="8" regnum="0"/>
+    <reg name="x" bitsize="8" regnum="1"/>
+    <reg name="y" bitsize="8" regnum="2"/>
+    <reg name="p" bitsize="8" regnum="3"/>
+    <reg name="sp" bitsize="8" regnum="4"/>
+    <reg name="pc" bitsize="16" regnum="5" type="code_ptr"/>
+  </feature>
+</target>
+`
+
+// Server debugs a Console, one connection at a time.
+type Server struct {
+	Console *nes.Console
+}
+
+// ListenAndServe listens on a loopback TCP address such as "localhost:2345" and serves console.
+func ListenAndServe(addr string, console *nes.Console) error {
+	l, err := loopback.Listen(addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	server := &Server{Console: console}
+	return server.Serve(l)
+}
+
+// Serve handles the connections accepted on l until the debugger kills the target.
+func (s *Server) Serve(l net.Listener) error {
+	return loopback.Serve(l, func(conn net.Conn) (bool, error) {
+		return s.ServeConn(conn)
+	})
+}
+
+// ServeConn runs a debugging session on conn until the debugger detaches, kills the target or disconnects.
+// The breakpoints set during the session are removed when it ends.
+func (s *Server) ServeConn(conn io.ReadWriter) (killed bool, err error) {
+	session := &session{
+		console:     s.Console,
+		debugger:    s.Console.AttachDebugger(),
+		conn:        conn,
+		packets:     make(chan packet),
+		done:        make(chan struct{}),
+		breakpoints: map[string]int{},
+	}
+	go session.readPackets()
+	defer session.close()
+
+	return session.run()
+}
+
+type packet struct {
+	data string
+	err  error
+}
+
+type session struct {
+	console  *nes.Console
+	debugger *nes.Debugger
+	conn     io.ReadWriter
+	writeMu  sync.Mutex // acknowledgements are written by readPackets
+	packets  chan packet
+	done     chan struct{}
+
+	breakpoints map[string]int // "type,addr,kind" of the Z packet to breakpoint ID
+}
+
+// readPackets forwards the packets, so that an interrupt can be noticed while the console runs.
+func (s *session) readPackets() {
+	r := bufio.NewReader(s.conn)
+	w := writerFunc(func(p []byte) (int, error) {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+		return s.conn.Write(p)
+	})
+	for {
+		data, err := readPacket(r, w)
+		select {
+		case s.packets <- packet{data, err}:
+		case <-s.done:
+			return
+		}
+		if err != nil && err != errInterrupt {
+			return
+		}
+	}
+}
+
+func (s *session) close() {
+	close(s.done)
+	for _, id := range s.breakpoints {
+		s.debugger.RemoveBreakpoint(id)
+	}
+	s.debugger.Continue()
+}
+
+func (s *session) reply(data string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return writePacket(s.conn, data)
+}
+
+func (s *session) run() (bool, error) {
+	for {
+		p := <-s.packets
+		if p.err == errInterrupt {
+			// already stopped
+			if err := s.reply("S02"); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if p.err != nil {
+			return false, p.err
+		}
+
+		switch {
+		case p.data == "k":
+			return true, nil
+		case strings.HasPrefix(p.data, "D"):
+			return false, s.reply("OK")
+		}
+
+		response, err := s.handle(p.data)
+		if err != nil {
+			return false, err
+		}
+		if err := s.reply(response); err != nil {
+			return false, err
+		}
+	}
+}
+
+func (s *session) handle(data string) (string, error) {
+	switch {
+	case data == "?":
+		return "S05", nil
+	case strings.HasPrefix(data, "qSupported"):
+		return "PacketSize=1000;qXfer:features:read+;vContSupported+", nil
+	case data == "qAttached":
+		return "1", nil
+	case data == "qC":
+		return "QC1", nil
+	case data == "qfThreadInfo":
+		return "m1", nil
+	case data == "qsThreadInfo":
+		return "l", nil
+	case strings.HasPrefix(data, "qXfer:features:read:target.xml:"):
+		return readXfer(targetXML, strings.TrimPrefix(data, "qXfer:features:read:target.xml:")), nil
+	case strings.HasPrefix(data, "H"), strings.HasPrefix(data, "T"):
+		return "OK", nil
+	case data == "g":
+		return s.readRegisters(), nil
+	case strings.HasPrefix(data, "G"):
+		return s.writeRegisters(data[1:]), nil
+	case strings.HasPrefix(data, "p"):
+		return s.readRegister(data[1:]), nil
+	case strings.HasPrefix(data, "P"):
+		return s.writeRegister(data[1:]), nil
+	case strings.HasPrefix(data, "m"):
+		return s.readMemory(data[1:]), nil
+	case strings.HasPrefix(data, "M"):
+		return s.writeMemory(data[1:]), nil
+	case strings.HasPrefix(data, "Z"):
+		return s.insertBreakpoint(data[1:]), nil
+	case strings.HasPrefix(data, "z"):
+		return s.removeBreakpoint(data[1:]), nil
+	case data == "vCont?":
+		return "vCont;c;s", nil
+	case strings.HasPrefix(data, "vCont;"):
+		action := strings.TrimPrefix(data, "vCont;")
+		if len(action) == 0 {
+			return "E01", nil
+		}
+		switch action[0] {
+		case 'c':
+			return s.resume(false)
+		case 's':
+			return s.resume(true)
+		}
+		return "E01", nil
+	case strings.HasPrefix(data, "c"), strings.HasPrefix(data, "s"):
+		if len(data) > 1 {
+			addr, err := strconv.ParseUint(data[1:], 16, 16)
+			if err != nil {
+				return "E01", nil
+			}
+			s.console.CPU.SetProgramCounter(uint16(addr))
+		}
+		return s.resume(data[0] == 's')
+	}
+	// unsupported packets get an empty response
+	return "", nil
+}
+
+// resume runs the console frame by frame until it stops or the debugger interrupts it.
+func (s *session) resume(step bool) (string, error) {
+	if step {
+		s.debugger.StepInto()
+	} else {
+		s.debugger.Continue()
+	}
+
+	for {
+		select {
+		case p := <-s.packets:
+			if p.err == errInterrupt {
+				return "S02", nil
+			}
+			if p.err != nil {
+				return "", p.err
+			}
+			// nothing else is expected while running
+		default:
+		}
+
+		stop, err := s.debugger.Run(1)
+		if err != nil {
+			// the CPU can't go on, e.g. a KIL opcode
+			return "S04", nil
+		}
+		if stop != nil {
+			return stopReply(stop), nil
+		}
+	}
+}
+
+func stopReply(stop *nes.DebugStop) string {
+	if stop.Reason != nes.STOP_BREAKPOINT || stop.Breakpoint.Kind == nes.BREAK_EXECUTE {
+		return "S05"
+	}
+	reason := "awatch"
+	switch stop.Breakpoint.Kind {
+	case nes.BREAK_WRITE:
+		reason = "watch"
+	case nes.BREAK_READ:
+		reason = "rwatch"
+	}
+	return fmt.Sprintf("T05%s:%04x;", reason, stop.Addr)
+}
+
+func registerBytes(s nes.CPUState) []byte {
+	return []byte{s.A, s.X, s.Y, s.P, s.SP, uint8(s.PC), uint8(s.PC >> 8)}
+}
+
+func (s *session) readRegisters() string {
+	return hex.EncodeToString(registerBytes(s.console.CPU.State()))
+}
+
+func (s *session) writeRegisters(data string) string {
+	b, err := hex.DecodeString(data)
+	if err != nil || len(b) != 7 {
+		return "E01"
+	}
+	s.console.CPU.SetState(nes.CPUState{
+		A:  b[0],
+		X:  b[1],
+		Y:  b[2],
+		P:  b[3],
+		SP: b[4],
+		PC: uint16(b[5]) | uint16(b[6])<<8,
+	})
+	return "OK"
+}
+
+func (s *session) readRegister(data string) string {
+	n, err := strconv.ParseUint(data, 16, 8)
+	if err != nil || n > 5 {
+		return "E01"
+	}
+	b := registerBytes(s.console.CPU.State())
+	if n == 5 {
+		return hex.EncodeToString(b[5:7])
+	}
+	return hex.EncodeToString(b[n : n+1])
+}
+
+func (s *session) writeRegister(data string) string {
+	number, value, ok := strings.Cut(data, "=")
+	n, err := strconv.ParseUint(number, 16, 8)
+	if !ok || err != nil || n > 5 {
+		return "E01"
+	}
+	v, err := hex.DecodeString(value)
+	if err != nil || (n == 5 && len(v) != 2) || (n < 5 && len(v) != 1) {
+		return "E01"
+	}
+
+	state := s.console.CPU.State()
+	switch n {
+	case 0:
+		state.A = v[0]
+	case 1:
+		state.X = v[0]
+	case 2:
+		state.Y = v[0]
+	case 3:
+		state.P = v[0]
+	case 4:
+		state.SP = v[0]
+	case 5:
+		state.PC = uint16(v[0]) | uint16(v[1])<<8
+	}
+	s.console.CPU.SetState(state)
+	return "OK"
+}
+
+// parseRange parses "addr,length"
+func parseRange(data string) (uint16, int, bool) {
+	addr, length, ok := strings.Cut(data, ",")
+	a, err := strconv.ParseUint(addr, 16, 16)
+	if !ok || err != nil {
+		return 0, 0, false
+	}
+	l, err := strconv.ParseUint(length, 16, 16)
+	if err != nil {
+		return 0, 0, false
+	}
+	return uint16(a), int(l), true
+}
+
+func (s *session) readMemory(data string) string {
+	addr, length, ok := parseRange(data)
+	if !ok {
+		return "E01"
+	}
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = s.console.Bus.Peek(addr + uint16(i))
+	}
+	return hex.EncodeToString(b)
+}
+
+func (s *session) writeMemory(data string) string {
+	header, value, ok := strings.Cut(data, ":")
+	addr, length, rangeOK := parseRange(header)
+	b, err := hex.DecodeString(value)
+	if !ok || !rangeOK || err != nil || len(b) != length {
+		return "E01"
+	}
+	for i, v := range b {
+		if !s.console.Bus.Poke(addr+uint16(i), v) {
+			return "E0e"
+		}
+	}
+	return "OK"
+}
+
+// parseBreakpoint parses "type,addr,kind" of Z and z packets, kind being the length for watchpoints.
+func parseBreakpoint(data string) (nes.BreakpointKind, uint16, uint16, bool) {
+	kinds := map[byte]nes.BreakpointKind{
+		'0': nes.BREAK_EXECUTE,
+		'1': nes.BREAK_EXECUTE,
+		'2': nes.BREAK_WRITE,
+		'3': nes.BREAK_READ,
+		'4': nes.BREAK_ACCESS,
+	}
+	if len(data) < 2 || data[1] != ',' {
+		return 0, 0, 0, false
+	}
+	kind, ok := kinds[data[0]]
+	if !ok {
+		return 0, 0, 0, false
+	}
+	addr, length, ok := parseRange(data[2:])
+	if !ok {
+		return 0, 0, 0, false
+	}
+
+	end := addr
+	if kind != nes.BREAK_EXECUTE && length > 1 {
+		end = addr + uint16(length-1)
+		if end < addr {
+			end = 0xffff
+		}
+	}
+	return kind, addr, end, true
+}
+
+func (s *session) insertBreakpoint(data string) string {
+	kind, start, end, ok := parseBreakpoint(data)
+	if !ok {
+		// unsupported breakpoint type
+		return ""
+	}
+	if _, exists := s.breakpoints[data]; exists {
+		return "OK"
+	}
+	b, err := s.debugger.AddBreakpoint(kind, nes.SPACE_CPU, start, end, "")
+	if err != nil {
+		return "E01"
+	}
+	s.breakpoints[data] = b.ID
+	return "OK"
+}
+
+func (s *session) removeBreakpoint(data string) string {
+	if _, _, _, ok := parseBreakpoint(data); !ok {
+		return ""
+	}
+	id, ok := s.breakpoints[data]
+	if !ok {
+		return "E01"
+	}
+	delete(s.breakpoints, data)
+	if err := s.debugger.RemoveBreakpoint(id); err != nil {
+		return "E01"
+	}
+	return "OK"
+}
+
+// readXfer returns the part of document requested by "offset,length"
+func readXfer(document, data string) string {
+	offset, length, ok := strings.Cut(data, ",")
+	o, err := strconv.ParseUint(offset, 16, 32)
+	if !ok || err != nil {
+		return "E01"
+	}
+	l, err := strconv.ParseUint(length, 16, 32)
+	if err != nil {
+		return "E01"
+	}
+	if o >= uint64(len(document)) {
+		return "l"
+	}
+	if o+l >= uint64(len(document)) {
+		return "l" + document[o:]
+	}
+	return "m" + document[o:o+l]
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,221 @@
+package gdbstub
+
+import (
+	"bufio"
+	"bytes"
+	"go-nes/nes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestConsoleForServerTest(t *testing.T) *nes.Console {
+	programRom := make([]uint8, 2*nes.PROGRAM_ROM_PAGE_SIZE)
+	copy(programRom, []uint8{
+		0xa2, 0x05, // LDX #$05
+		0xe8,       // loop: INX
+		0x86, 0x10, // STX $10
+		0xa5, 0x11, // LDA $11
+		0x4c, 0x02, 0x80, // JMP loop
+	})
+	programRom[0x7ffc] = 0x00
+	programRom[0x7ffd] = 0x80
+
+	rom := []uint8{0x4E, 0x45, 0x53, 0x1A, 0x02, 0x01, 0x31, 00, 00, 00, 00, 00, 00, 00, 00, 00}
+	rom = append(rom, programRom...)
+	rom = append(rom, make([]uint8, nes.CHARACTER_ROM_PAGE_SIZE)...)
+
+	console := nes.NewConsole()
+	assert.NoError(t, console.LoadROM(rom))
+	return console
+}
+
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func startTestServer(t *testing.T, console *nes.Console) (*testClient, chan error) {
+	server, client := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := (&Server{Console: console}).ServeConn(server)
+		server.Close()
+		done <- err
+	}()
+	return &testClient{t: t, conn: client, r: bufio.NewReader(client)}, done
+}
+
+// send writes a packet and returns the response
+func (c *testClient) send(data string) string {
+	assert.NoError(c.t, writePacket(c.conn, data))
+	ack, err := c.r.ReadByte()
+	assert.NoError(c.t, err)
+	assert.Equal(c.t, byte('+'), ack)
+	return c.receive()
+}
+
+func (c *testClient) receive() string {
+	// the acknowledgement of the last response fails when the server has already hung up
+	ack := writerFunc(func(p []byte) (int, error) {
+		c.conn.Write(p)
+		return len(p), nil
+	})
+	response, err := readPacket(c.r, ack)
+	assert.NoError(c.t, err)
+	return response
+}
+
+func TestServerRegistersAndMemory(t *testing.T) {
+	console := createTestConsoleForServerTest(t)
+	client, done := startTestServer(t, console)
+
+	assert.Equal(t, "S05", client.send("?"))
+	assert.Contains(t, client.send("qSupported:swbreak+"), "qXfer:features:read+")
+	assert.Contains(t, client.send("qXfer:features:read:target.xml:0,1000"), `name="pc"`)
+
+	s := console.CPU.State()
+	assert.Equal(t, "000000"+"24"+"fd"+"0080", client.send("g"))
+	assert.Equal(t, "0080", client.send("p5"))
+
+	assert.Equal(t, "OK", client.send("P0=42"))
+	assert.Equal(t, "OK", client.send("P5=0280"))
+	s.A = 0x42
+	s.PC = 0x8002
+	assert.Equal(t, s, console.CPU.State())
+
+	assert.Equal(t, "OK", client.send("G01020304ff0080"))
+	assert.Equal(t, nes.CPUState{A: 1, X: 2, Y: 3, P: 4, SP: 0xff, PC: 0x8000}, console.CPU.State())
+
+	assert.Equal(t, "OK", client.send("M300,3:aabbcc"))
+	assert.Equal(t, "aabbcc", client.send("m300,3"))
+	assert.Equal(t, "a205e8", client.send("m8000,3"))
+	assert.Equal(t, "E0e", client.send("M2000,1:00"))
+	assert.Equal(t, "E01", client.send("m300"))
+	assert.Equal(t, "", client.send("qUnknown"))
+
+	assert.Equal(t, "OK", client.send("D"))
+	assert.NoError(t, <-done)
+}
+
+func TestServerBreakpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		insert   string
+		expected string
+		pc       uint16
+	}{
+		{"execute", "Z0,8005,1", "S05", 0x8005},
+		{"write", "Z2,10,1", "T05watch:0010;", 0x8005},
+		{"read", "Z3,11,1", "T05rwatch:0011;", 0x8007},
+		{"access", "Z4,e,3", "T05awatch:0010;", 0x8005},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			console := createTestConsoleForServerTest(t)
+			client, done := startTestServer(t, console)
+
+			assert.Equal(t, "OK", client.send(tt.insert))
+			assert.Equal(t, tt.expected, client.send("c"))
+			assert.Equal(t, tt.pc, console.CPU.ProgramCounter())
+
+			// the same breakpoint is hit on the next iteration of the loop
+			assert.Equal(t, tt.expected, client.send("vCont;c"))
+			assert.Equal(t, tt.pc, console.CPU.ProgramCounter())
+			assert.Equal(t, uint8(7), console.CPU.State().X)
+
+			assert.Equal(t, "OK", client.send("z"+tt.insert[1:]))
+			assert.Equal(t, "E01", client.send("z"+tt.insert[1:]))
+			assert.Empty(t, console.AttachDebugger().Breakpoints())
+
+			assert.Equal(t, "OK", client.send("D"))
+			assert.NoError(t, <-done)
+		})
+	}
+}
+
+func TestServerStep(t *testing.T) {
+	console := createTestConsoleForServerTest(t)
+	client, done := startTestServer(t, console)
+
+	assert.Equal(t, "S05", client.send("s"))
+	assert.Equal(t, uint16(0x8002), console.CPU.ProgramCounter())
+	assert.Equal(t, "S05", client.send("vCont;s:1"))
+	assert.Equal(t, uint16(0x8003), console.CPU.ProgramCounter())
+	assert.Equal(t, uint8(6), console.CPU.State().X)
+	assert.Equal(t, "E01", client.send("vCont;"))
+	assert.Equal(t, uint16(0x8003), console.CPU.ProgramCounter())
+
+	assert.Equal(t, "OK", client.send("D"))
+	assert.NoError(t, <-done)
+}
+
+func TestServerInterrupt(t *testing.T) {
+	console := createTestConsoleForServerTest(t)
+	client, done := startTestServer(t, console)
+
+	assert.NoError(t, writePacket(client.conn, "c"))
+	ack, err := client.r.ReadByte()
+	assert.NoError(t, err)
+	assert.Equal(t, byte('+'), ack)
+
+	_, err = client.conn.Write([]byte{interruptByte})
+	assert.NoError(t, err)
+	assert.Equal(t, "S02", client.receive())
+
+	// breakpoints set during the session are removed when it ends
+	assert.Equal(t, "OK", client.send("Z0,8002,1"))
+	client.conn.Close()
+	assert.Error(t, <-done)
+	assert.Empty(t, console.AttachDebugger().Breakpoints())
+}
+
+func TestServerKill(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- (&Server{Console: createTestConsoleForServerTest(t)}).Serve(l)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.NoError(t, writePacket(conn, "k"))
+	assert.NoError(t, <-served)
+}
+
+func TestListenAndServeLoopbackOnly(t *testing.T) {
+	assert.ErrorIs(t, ListenAndServe("0.0.0.0:0", nil), ErrNotLoopback)
+	assert.ErrorIs(t, ListenAndServe("192.168.0.1:2345", nil), ErrNotLoopback)
+}
+
+func TestReadPacket(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		acks     string
+	}{
+		{"packet", "$g#67", "g", "+"},
+		{"skips acks", "++$g#67", "g", "+"},
+		{"retransmission", "$g#00$g#67", "g", "-+"},
+		{"escaped", "$X}\x03#d8", "X#", "+"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var acks bytes.Buffer
+			data, err := readPacket(bufio.NewReader(strings.NewReader(tt.input)), &acks)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, data)
+			assert.Equal(t, tt.acks, acks.String())
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Package loopback serves the debugger protocols on local TCP connections only.
+package loopback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+var ErrNotLoopback = errors.New("debug servers only listen on loopback addresses")
+
+// Listen listens on a loopback TCP address such as "localhost:2345".
+func Listen(addr string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host != "localhost" {
+		ip := net.ParseIP(host)
+		if ip == nil || !ip.IsLoopback() {
+			return nil, fmt.Errorf("%w: %s", ErrNotLoopback, addr)
+		}
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Serve handles the connections accepted on l one at a time, closing each one after serve,
+// until serve returns done or an error other than io.EOF.
+func Serve(l net.Listener, serve func(conn net.Conn) (done bool, err error)) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		done, err := serve(conn)
+		conn.Close()
+		if done {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+}
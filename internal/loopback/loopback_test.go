@@ -0,0 +1,44 @@
+package loopback
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListen(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:0", "192.168.0.1:2345", "example.com:2345"} {
+		_, err := Listen(addr)
+		assert.ErrorIs(t, err, ErrNotLoopback, addr)
+	}
+	_, err := Listen("2345")
+	assert.Error(t, err)
+
+	l, err := Listen("127.0.0.1:0")
+	assert.NoError(t, err)
+	l.Close()
+}
+
+func TestServe(t *testing.T) {
+	l, err := Listen("localhost:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	done := make(chan error)
+	go func() {
+		done <- Serve(l, func(conn net.Conn) (bool, error) {
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			return line == "quit\n", err
+		})
+	}()
+	for _, line := range []string{"hello\n", "quit\n"} {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		assert.NoError(t, err)
+		_, err = conn.Write([]byte(line))
+		assert.NoError(t, err)
+		conn.Close()
+	}
+	assert.NoError(t, <-done)
+}
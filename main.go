@@ -1,20 +1,36 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"go-nes/nes"
 	"go-nes/ui"
+	"io/fs"
 	"log"
 	"log/slog"
 	"os"
+	"path"
 	"runtime"
+	"strings"
 
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/glfw/v3.2/glfw"
 )
 
 func main() {
-	filepath := os.Args[1]
+	moviePath := flag.String("play", "", "FM2 movie to play back")
+	readOnly := flag.Bool("readonly", false, "keep playing the movie when a state is loaded instead of recording over it")
+	recordPath := flag.String("record", "", "FM2 movie to record the input to")
+	tracePath := flag.String("trace", "", "file to write a trace of the executed instructions to, see the trace command")
+	traceFormat := flag.String("trace-format", "nestest", "trace format: nestest, mesen or fceux")
+	traceRing := flag.Int("trace-ring", 0, "only write the last n instructions, when the emulation fails or on trace dump")
+	profilePath := flag.String("profile", "", "file to write a pprof profile of the cycles spent in every subroutine to, see the profile command")
+	cdlPath := flag.String("cdl", "", "code/data log to update with the bytes used while playing, FCEUX's .cdl format")
+	flag.Parse()
+
+	filepath := flag.Arg(0)
 	if filepath == "" {
 		log.Fatal("Please specify a file path")
 	}
@@ -24,12 +40,61 @@ func main() {
 		log.Fatal(err)
 	}
 
-	c, err := nes.NewCartridge(data)
+	console := nes.NewConsole()
+	if err := console.LoadROM(data); err != nil {
+		log.Fatal(err)
+	}
+	slog.Info(fmt.Sprintf("Program Rom Length: %d", len(console.Cartridge.ProgramRom)))
+	slog.Info(fmt.Sprintf("Charactor Rom Length: %d", len(console.Cartridge.CharacterRom)))
+	if err := loadCheats(console, filepath+".cheats"); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadSymbols(console, filepath); err != nil {
+		log.Fatal(err)
+	}
+	watches, err := loadWatches(filepath + ".watch")
 	if err != nil {
 		log.Fatal(err)
 	}
-	slog.Info(fmt.Sprintf("Program Rom Length: %d", len(c.ProgramRom)))
-	slog.Info(fmt.Sprintf("Charactor Rom Length: %d", len(c.CharacterRom)))
+	if *tracePath != "" {
+		format, err := nes.ParseTraceFormat(*traceFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f, err := os.Create(*tracePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := bufio.NewWriter(f)
+		defer f.Close()
+		defer w.Flush()
+		console.SetTraceLogger(nes.NewTraceLogger(w, nes.TraceOptions{Format: format, RingSize: *traceRing}))
+	}
+	if *cdlPath != "" {
+		if err := loadCodeDataLog(console, *cdlPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *profilePath != "" {
+		console.AttachProfiler()
+	}
+	// snapshot every 10 frames, up to 32MB
+	console.EnableRewind(10, 32<<20)
+
+	switch {
+	case *moviePath != "":
+		movie, err := readMovie(*moviePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := console.PlayMovie(movie, *readOnly); err != nil {
+			log.Fatal(err)
+		}
+	case *recordPath != "":
+		if _, err := console.RecordMovie(path.Base(filepath)); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	runtime.LockOSThread()
 
@@ -52,11 +117,163 @@ func main() {
 	}
 	defer shaderProgram.Delete()
 
-	b := nes.NewBus(c, nil)
-	cpu := nes.NewCPU(b)
-	cpu.Reset()
-
-	if err := ui.Run(cpu, b, window, shaderProgram); err != nil {
+	frame := ui.NewFrame(console, filepath)
+	frame.Watches = watches
+	if err := ui.Run(frame, window, shaderProgram); err != nil {
 		panic(err)
 	}
+
+	// a movie played in read-write mode turns into a recording once a state is loaded
+	if console.MovieMode() == nes.MOVIE_MODE_RECORD {
+		out := *recordPath
+		if out == "" {
+			out = *moviePath
+		}
+		if err := writeMovie(console.Movie(), out); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if p := console.Profiler(); p != nil && *profilePath != "" {
+		if err := ui.WriteFile(*profilePath, p.WriteProfile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cdl := console.CodeDataLogger(); cdl != nil && *cdlPath != "" {
+		if err := ui.WriteFile(*cdlPath, cdl.Write); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// loadCodeDataLog attaches the code/data logger, going on from the log at path if there is one.
+func loadCodeDataLog(console *nes.Console, path string) error {
+	cdl := console.AttachCodeDataLogger()
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := cdl.Read(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// loadCheats loads the cheat file next to the ROM, if there is one.
+func loadCheats(console *nes.Console, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := console.Cheats.Load(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	slog.Info(fmt.Sprintf("Loaded %d cheats from %s", len(console.Cheats.Cheats), path))
+	return nil
+}
+
+// loadSymbols loads the label files next to the ROM: the ld65 debug info "game.dbg",
+// FCEUX's "game.nes.ram.nl" and "game.nes.<bank>.nl", and Mesen's "game.mlb".
+func loadSymbols(console *nes.Console, romPath string) error {
+	base := strings.TrimSuffix(romPath, path.Ext(romPath))
+	load := func(path string, read func(f *os.File) error) error {
+		f, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := read(f); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	}
+
+	err := load(base+".dbg", func(f *os.File) error {
+		info, err := nes.ReadDebugInfo(f)
+		if err != nil {
+			return err
+		}
+		console.Symbols.AddDebugInfo(info)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = load(romPath+".ram.nl", func(f *os.File) error {
+		return console.Symbols.ReadFCEUX(f, -1)
+	})
+	if err != nil {
+		return err
+	}
+	for bank := 0; bank*nes.FCEUX_BANK_SIZE < len(console.Cartridge.ProgramRom); bank++ {
+		err := load(fmt.Sprintf("%s.%d.nl", romPath, bank), func(f *os.File) error {
+			return console.Symbols.ReadFCEUX(f, bank)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = load(base+".mlb", func(f *os.File) error {
+		return console.Symbols.ReadMesen(f, console.Bus)
+	})
+	if err != nil {
+		return err
+	}
+
+	if console.Symbols.Len() > 0 {
+		slog.Info(fmt.Sprintf("Loaded %d symbols", console.Symbols.Len()))
+	}
+	return nil
+}
+
+// loadWatches loads the watch file next to the ROM, if there is one.
+func loadWatches(path string) ([]nes.Watch, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	watches, err := nes.ReadWatches(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return watches, nil
+}
+
+func readMovie(path string) (*nes.Movie, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return nes.ReadMovie(f)
+}
+
+func writeMovie(movie *nes.Movie, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := movie.Write(f); err != nil {
+		return err
+	}
+	return f.Close()
 }
@@ -0,0 +1,16 @@
+package nes_test
+
+import (
+	"go-nes/asm"
+	"testing"
+)
+
+// assemble assembles a test program at $8000.
+func assemble(t *testing.T, source string) []uint8 {
+	t.Helper()
+	assembly, err := asm.Assemble(source, 0x8000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assembly.Code
+}
@@ -35,8 +35,15 @@ type Bus struct {
 	JoyPad1          *Joypad
 	JoyPad2          *Joypad
 	Cycles           uint
+	VblankCount      uint
 	GameLoopCallback func(*PPU)
 	RenderFlag       bool
+	ErrorPolicy      ErrorPolicy
+	Cheats           *CheatList   // patches ROM reads, may be nil
+	Symbols          *SymbolTable // labels for traces and the debugger, may be nil
+
+	faults faultLatch
+	hook   accessHook // sees every CPU access, set by Console.attachHooks
 }
 
 const (
@@ -82,12 +89,61 @@ func (b *Bus) ReadMemory(addr uint16) uint8 {
 	} else if addr >= 0x2008 && addr <= PPU_REGISTERS_MIRRORS_END {
 		mirrorDownAddr := addr & 0b00100000_00000111
 		return b.ReadMemory(mirrorDownAddr)
+	} else if addr >= 0x6000 && addr <= 0x7fff {
+		return b.Cartridge.ProgramRam[addr-0x6000]
 	} else if addr >= 0x8000 && addr <= 0xFFFF {
+		if b.Cheats != nil {
+			return b.Cheats.patchROM(addr, b.ReadProgramRom(addr))
+		}
 		return b.ReadProgramRom(addr)
 	}
 	return 0
 }
 
+// Peek returns what ReadMemory would return, without any of its side effects.
+func (b *Bus) Peek(addr uint16) uint8 {
+	if addr >= 0x2008 && addr <= PPU_REGISTERS_MIRRORS_END {
+		addr &= 0b00100000_00000111
+	}
+	switch addr {
+	case 0x2002:
+		return b.PPU.PeekStatus()
+	case 0x2007:
+		return b.PPU.PeekData()
+	case 0x4016:
+		return b.JoyPad1.Peek()
+	case 0x4017:
+		return b.JoyPad2.Peek()
+	}
+	// every other readable address has no side effect
+	return b.ReadMemory(addr)
+}
+
+// Poke changes RAM, PRG-RAM or PRG-ROM for tools, without the side effects of WriteMemory.
+// PRG-ROM changes last until the next power cycle, which reloads the ROM as it was loaded. It returns false for registers and unmapped addresses.
+func (b *Bus) Poke(addr uint16, data uint8) bool {
+	if addr >= RAM && addr <= RAM_MIRRORS_END {
+		b.CpuVRAM[addr&0b111_1111_1111] = data
+	} else if addr >= 0x6000 && addr <= 0x7fff {
+		b.Cartridge.ProgramRam[addr-0x6000] = data
+	} else if addr >= 0x8000 {
+		b.Cartridge.ProgramRom[b.ProgramRomOffset(addr)] = data
+	} else {
+		return false
+	}
+	return true
+}
+
+// CanPoke tells if Poke can change addr.
+func (b *Bus) CanPoke(addr uint16) bool {
+	return addr >= RAM && addr <= RAM_MIRRORS_END || addr >= 0x6000
+}
+
+// PeekPPU returns the byte at addr in the PPU address space ($0000-$3FFF) without side effects.
+func (b *Bus) PeekPPU(addr uint16) uint8 {
+	return b.PPU.Peek(addr)
+}
+
 func (b *Bus) WriteMemory(addr uint16, data uint8) {
 	if addr >= RAM && addr <= RAM_MIRRORS_END {
 		mirrorDownAddr := addr & 0b111_1111_1111
@@ -122,30 +178,80 @@ func (b *Bus) WriteMemory(addr uint16, data uint8) {
 		b.JoyPad2.Write(data)
 	} else if addr >= 0x2008 && addr <= PPU_REGISTERS_MIRRORS_END {
 		mirrorDownAddr := addr & 0b00100000_00000111
-		b.CpuVRAM[mirrorDownAddr] = data
+		b.WriteMemory(mirrorDownAddr, data)
+	} else if addr >= 0x6000 && addr <= 0x7fff {
+		b.Cartridge.ProgramRam[addr-0x6000] = data
 	} else if addr >= 0x8000 && addr <= 0xFFFF {
-		panic("Attempt to write to Cartridge ROM space")
+		b.faults.fault(&AccessError{Addr: addr, Write: true, Err: ErrCartridgeROMWrite})
 	}
 }
 
+// TakeError returns the first hardware-benign error raised by the bus or the PPU
+// since the last call, filtered through ErrorPolicy.
+func (b *Bus) TakeError() error {
+	busErr := applyErrorPolicy(b.ErrorPolicy, b.faults.take())
+	ppuErr := applyErrorPolicy(b.ErrorPolicy, b.PPU.TakeError())
+	if busErr != nil {
+		return busErr
+	}
+	return ppuErr
+}
+
+// Read implements Memory.
+func (b *Bus) Read(addr uint16) uint8 {
+	value := b.ReadMemory(addr)
+	if b.hook != nil {
+		b.hook.onAccess(SPACE_CPU, addr, value, false)
+	}
+	return value
+}
+
+// Write implements Memory.
+func (b *Bus) Write(addr uint16, data uint8) {
+	if b.hook != nil {
+		b.hook.onAccess(SPACE_CPU, addr, data, true)
+	}
+	b.WriteMemory(addr, data)
+}
+
 func (b *Bus) ReadProgramRom(addr uint16) uint8 {
-	addr -= 0x8000
+	return b.Cartridge.ProgramRom[b.ProgramRomOffset(addr)]
+}
+
+// ProgramRomOffset returns the offset in PRG-ROM mapped at a CPU address in $8000-$FFFF.
+func (b *Bus) ProgramRomOffset(addr uint16) int {
+	offset := int(addr - 0x8000)
 
 	// プログラムROMは16kbまたは32kbのいずれか。なぜならマップアドレススペースが32kbのため、ROMが16kbの場合は上位16kbを下位16kbにミラーする必要がある
-	if len(b.Cartridge.ProgramRom) == 0x4000 && addr >= 0x4000 {
+	if len(b.Cartridge.ProgramRom) == 0x4000 && offset >= 0x4000 {
 		// mirror if needed
-		addr = addr % 0x4000
+		offset = offset % 0x4000
 	}
-	return b.Cartridge.ProgramRom[addr]
+	return offset
+}
+
+// programRomAddress returns the CPU address a PRG-ROM offset is mapped at, the last mirror for 16KB ROMs.
+func (b *Bus) programRomAddress(offset int) (uint16, bool) {
+	size := len(b.Cartridge.ProgramRom)
+	if offset < 0 || offset >= size {
+		return 0, false
+	}
+	return uint16(0x10000 - size + offset), true
 }
 
 func (b *Bus) Tick(cycles uint8) {
 	b.Cycles += uint(cycles)
 
 	nmiBefore := b.PPU.NMIInterrupt
+	scanlineBefore := b.PPU.Scanline
 	b.PPU.Tick(cycles * 3)
 	nmiAfter := b.PPU.NMIInterrupt
 
+	// counted even when NMI is disabled, so that frames can be stepped during loading screens
+	if scanlineBefore < 241 && b.PPU.Scanline >= 241 {
+		b.VblankCount++
+	}
+
 	if !nmiBefore && nmiAfter {
 		b.RenderFlag = true
 	}
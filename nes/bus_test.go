@@ -0,0 +1,140 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestConsoleForPeekTest(t *testing.T, program []uint8) *Console {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(program)))
+	ppu := console.Bus.PPU
+	ppu.flagVblankStarted = 1
+	ppu.w = 1
+	ppu.InternalDataBuffer = 0x42
+	ppu.VRAM[0x0010] = 0x99
+	ppu.PaletteTable[0x01] = 0x21
+	console.Bus.CpuVRAM[0x0005] = 0x77
+	console.SetButtons(0, 1<<JOYPAD_A)
+	console.SetButtons(1, 1<<JOYPAD_B)
+	return console
+}
+
+func TestBusPeek(t *testing.T) {
+	tests := []struct {
+		name   string
+		addr   uint16
+		v      uint16
+		expect uint8
+	}{
+		{"ram mirror", 0x0805, 0, 0x77},
+		{"status", 0x2002, 0, 0x80},
+		{"status mirror", 0x300a, 0, 0x80},
+		{"data is buffered", 0x2007, 0x2010, 0x42},
+		{"palette is not buffered", 0x2007, 0x3f01, 0x21},
+		{"joypad 1", 0x4016, 0, 1},
+		{"joypad 2", 0x4017, 0, 0},
+		{"rom", 0x8000, 0, 0x4c},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			console := createTestConsoleForPeekTest(t, []uint8{0x4c, 0x00, 0x80})
+			console.Bus.PPU.v = tt.v
+			ppu := *console.Bus.PPU
+			joypad1 := *console.Bus.JoyPad1
+
+			assert.Equal(t, tt.expect, console.Bus.Peek(tt.addr))
+			assert.Equal(t, tt.expect, console.Bus.Peek(tt.addr))
+			assert.Equal(t, ppu, *console.Bus.PPU)
+			assert.Equal(t, joypad1, *console.Bus.JoyPad1)
+
+			// a real read sees the same value
+			assert.Equal(t, tt.expect, console.Bus.ReadMemory(tt.addr))
+		})
+	}
+}
+
+func TestBusPeekPPU(t *testing.T) {
+	console := createTestConsoleForPeekTest(t, []uint8{0x4c, 0x00, 0x80})
+	console.Cartridge.CharacterRom[0x0123] = 0x55
+
+	assert.Equal(t, uint8(0x55), console.Bus.PeekPPU(0x0123))
+	assert.Equal(t, uint8(0x99), console.Bus.PeekPPU(0x2010))
+	assert.Equal(t, uint8(0x99), console.Bus.PeekPPU(0x3010))
+	assert.Equal(t, uint8(0x21), console.Bus.PeekPPU(0x3f01))
+	assert.Equal(t, uint8(0x21), console.Bus.PeekPPU(0x7f21))
+	assert.Equal(t, uint8(0x42), console.Bus.PPU.InternalDataBuffer)
+}
+
+func TestTraceHasNoSideEffects(t *testing.T) {
+	// LDA $2002, LDA $4016
+	console := createTestConsoleForPeekTest(t, []uint8{0xad, 0x02, 0x20, 0xad, 0x16, 0x40})
+	ppu := *console.Bus.PPU
+
+	assert.Contains(t, trace(console.CPU), "LDA $2002 = 80")
+	assert.Equal(t, ppu, *console.Bus.PPU)
+
+	assert.NoError(t, console.StepInstruction())
+	assert.Equal(t, uint8(0x80), console.CPU.registerA)
+	assert.Contains(t, trace(console.CPU), "LDA $4016 = 01")
+	assert.Equal(t, uint8(0), console.Bus.JoyPad1.ButtonIndex)
+}
+
+func TestBusPoke(t *testing.T) {
+	console := createTestConsoleForPeekTest(t, []uint8{0x4c, 0x00, 0x80})
+	bus := console.Bus
+
+	assert.True(t, bus.Poke(0x0805, 0x12))
+	assert.Equal(t, uint8(0x12), bus.CpuVRAM[0x0005])
+	assert.True(t, bus.Poke(0x6001, 0x34))
+	assert.Equal(t, uint8(0x34), bus.Peek(0x6001))
+	assert.True(t, bus.Poke(0x8001, 0x56))
+	assert.Equal(t, uint8(0x56), bus.Peek(0x8001))
+	assert.NoError(t, bus.TakeError())
+
+	ppu := *bus.PPU
+	assert.False(t, bus.Poke(0x2000, 0x80))
+	assert.Equal(t, ppu, *bus.PPU)
+}
+
+func TestBusPokeLastsUntilPowerCycle(t *testing.T) {
+	rom := createTestROMForConsoleTest([]uint8{0xe6, 0x10, 0x4c, 0x00, 0x80}) // loop: INC $10, JMP loop
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(rom))
+	console.EnableRewind(1, 1<<20)
+	var state bytes.Buffer
+	assert.NoError(t, console.SaveState(&state))
+	assert.NoError(t, console.StepFrame())
+
+	assert.True(t, console.Bus.Poke(0x8001, 0x11))
+	assert.Equal(t, uint8(0x10), rom[16+1], "the loaded image is not changed")
+
+	// save states don't include the patches, so they still match the ROM
+	assert.NoError(t, console.StepFrame())
+	assert.NoError(t, console.RewindFrame())
+	assert.NoError(t, console.LoadState(bytes.NewReader(state.Bytes())))
+	assert.Equal(t, uint8(0x11), console.Bus.Peek(0x8001))
+
+	assert.NoError(t, console.HardReset())
+	assert.Equal(t, uint8(0x10), console.Bus.Peek(0x8001))
+}
+
+func TestBusWritePPURegisterMirrors(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest([]uint8{0x4c, 0x00, 0x80})))
+	bus := console.Bus
+	ram := bus.CpuVRAM
+
+	// $3FF8 mirrors PPUCTRL, $200E and $3FFF mirror PPUADDR and PPUDATA
+	bus.Write(0x3ff8, 0x80)
+	assert.True(t, bus.PPU.ReadCTRLNMI())
+	bus.Write(0x200e, 0x21)
+	bus.Write(0x200e, 0x08)
+	bus.Write(0x3fff, 0xab)
+	assert.Equal(t, uint8(0xab), bus.PeekPPU(0x2108))
+	assert.Equal(t, ram, bus.CpuVRAM)
+	assert.NoError(t, bus.TakeError())
+}
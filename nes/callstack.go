@@ -0,0 +1,49 @@
+package nes
+
+// callTracker follows the instruction being executed to tell the subroutine calls and interrupts,
+// for the call stacks of the Debugger and the Profiler.
+type callTracker struct {
+	pc          uint16 // the instruction, or the NMI handler when the NMI is taken before it
+	length      uint16
+	sp          uint8
+	opcode      uint8
+	nmi         bool
+	interrupted uint16 // the instruction delayed by the NMI
+}
+
+// before records the instruction cpu is about to execute.
+func (t *callTracker) before(c *Console) {
+	cpu := c.CPU
+	t.nmi = c.Bus.PPU.NMIInterrupt
+	t.pc = cpu.programCounter
+	t.interrupted = cpu.programCounter
+	if t.nmi {
+		t.pc = cpu.peek16(0xfffa)
+	}
+	t.opcode = cpu.Peek(t.pc)
+	t.length = uint16(cpu.instructions[t.opcode].Length)
+	t.sp = cpu.stackPointer
+}
+
+// calls returns the frames entered by the instruction just executed: the NMI taken before it, if any,
+// then the subroutine or BRK handler it called, if any.
+func (t *callTracker) calls(cpu *CPU) (interrupt, call *CallFrame) {
+	sp := t.sp
+	if t.nmi {
+		interrupt = &CallFrame{Kind: CALL_NMI, Caller: t.interrupted, Target: t.pc, SP: sp}
+		sp -= 3
+	}
+	switch {
+	case t.opcode == 0x20:
+		call = &CallFrame{Kind: CALL_JSR, Caller: t.pc, Target: cpu.programCounter, SP: sp}
+	case t.opcode == 0x00 && cpu.variant != CPU_VARIANT_2A03:
+		call = &CallFrame{Kind: CALL_BRK, Caller: t.pc, Target: cpu.programCounter, SP: sp}
+	}
+	return interrupt, call
+}
+
+// returned tells if frame has been left.
+// RTS, RTI and code dropping its return address all bring the stack pointer back up to where it was before the call.
+func returned(cpu *CPU, frame CallFrame) bool {
+	return cpu.stackPointer >= frame.SP
+}
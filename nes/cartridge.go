@@ -14,21 +14,23 @@ const (
 	NES_TAG                 = "NES\x1a"
 	PROGRAM_ROM_PAGE_SIZE   = 0x4000 // 16KB
 	CHARACTER_ROM_PAGE_SIZE = 0x2000 // 8KB
+	PROGRAM_RAM_SIZE        = 0x2000 // 8KB
 )
 
 type Cartridge struct {
 	ProgramRom      []uint8
 	CharacterRom    []uint8
+	ProgramRam      []uint8 // $6000-$7FFF
 	Mapper          uint8
 	ScreenMirroring Mirroring
 }
 
 func NewCartridge(raw []uint8) (*Cartridge, error) {
 	if len(raw) < 16 {
-		return nil, fmt.Errorf("invalid ROM file")
+		return nil, ErrInvalidROM
 	}
 	if string(raw[:4]) != NES_TAG {
-		return nil, fmt.Errorf("invalid ROM file")
+		return nil, ErrInvalidROM
 	}
 	header := raw[:16]
 
@@ -54,17 +56,23 @@ func NewCartridge(raw []uint8) (*Cartridge, error) {
 	charSize := int(header[5]) * CHARACTER_ROM_PAGE_SIZE
 	skipTrainer := header[6]&0b100 != 0
 
-	var prgRomStart uint16
+	var prgRomStart int
 	if skipTrainer {
 		prgRomStart = 16 + 512
 	} else {
 		prgRomStart = 16
 	}
-	charRomStart := prgRomStart + uint16(prgSize)
+	charRomStart := prgRomStart + prgSize
 
+	if prgSize == 0 || len(raw) < charRomStart+charSize {
+		return nil, fmt.Errorf("%w: expected %d bytes of PRG-ROM and %d bytes of CHR-ROM", ErrInvalidROM, prgSize, charSize)
+	}
+
+	// copied, so that tools patching the ROM change neither raw nor the next cartridge made from it
 	return &Cartridge{
-		ProgramRom:      raw[prgRomStart : prgRomStart+uint16(prgSize)],
-		CharacterRom:    raw[charRomStart : charRomStart+uint16(charSize)],
+		ProgramRom:      append([]uint8(nil), raw[prgRomStart:prgRomStart+prgSize]...),
+		CharacterRom:    append([]uint8(nil), raw[charRomStart:charRomStart+charSize]...),
+		ProgramRam:      make([]uint8, PROGRAM_RAM_SIZE),
 		Mapper:          mapper,
 		ScreenMirroring: screenMirroring,
 	}, nil
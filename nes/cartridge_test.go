@@ -97,3 +97,15 @@ func TestCartridgeNES2NotSupported(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, "NES2.0 format is not supported", err.Error())
 }
+
+func TestCartridgeTruncated(t *testing.T) {
+	testRom := createTestCartridge(TestCartridge{
+		header: []uint8{
+			0x4E, 0x45, 0x53, 0x1A, 0x02, 0x01, 0x31, 00, 00, 00, 00, 00, 00, 00, 00, 00,
+		},
+		programRom: createDummyRom(1, PROGRAM_ROM_PAGE_SIZE),
+	})
+
+	_, err := NewCartridge(testRom)
+	assert.ErrorIs(t, err, ErrInvalidROM)
+}
@@ -0,0 +1,200 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrInvalidCodeDataLog = errors.New("invalid code/data log")
+
+// flags of the PRG-ROM bytes in FCEUX's .cdl files
+const (
+	CDL_CODE          uint8 = 0x01 // executed, opcode or operand
+	CDL_DATA          uint8 = 0x02 // read by an instruction
+	CDL_BANK_MASK     uint8 = 0x0c // the 8KB window of $8000-$FFFF the byte was last accessed in
+	CDL_INDIRECT_CODE uint8 = 0x10 // executed after JMP ($nnnn)
+	CDL_INDIRECT_DATA uint8 = 0x20 // read through a pointer, like LDA ($nn),Y
+	CDL_PCM           uint8 = 0x40 // a DPCM sample, set when the DMC is enabled through $4015
+)
+
+// the flags of a PRG-ROM byte, bank bits excepted
+const CDL_PRG_FLAGS = CDL_CODE | CDL_DATA | CDL_INDIRECT_CODE | CDL_INDIRECT_DATA | CDL_PCM
+
+// flags of the CHR-ROM bytes
+const (
+	CDL_RENDERED uint8 = 0x01 // fetched to draw the screen
+	CDL_READ     uint8 = 0x02 // read by the program through $2007
+)
+
+// CodeDataLogger records how every PRG-ROM and CHR-ROM byte has been used since it was attached,
+// indexed by ROM offset like FCEUX's Code/Data Logger.
+type CodeDataLogger struct {
+	PRG []uint8 // CDL_CODE, CDL_DATA... of every PRG-ROM byte
+	CHR []uint8 // CDL_RENDERED and CDL_READ of every CHR-ROM byte
+
+	console *Console
+	// the instruction being executed
+	pc       uint16
+	length   uint16
+	mode     AddressingMode
+	indirect bool // reached by JMP ($nnnn)
+	// the DPCM sample set by $4012 and $4013
+	sampleAddr   uint16
+	sampleLength uint16
+}
+
+// AttachCodeDataLogger returns the code/data logger of the console, attaching one if needed.
+// It is kept by power cycles, and starts over when another ROM is loaded.
+func (c *Console) AttachCodeDataLogger() *CodeDataLogger {
+	if c.cdl == nil {
+		c.cdl = &CodeDataLogger{
+			PRG:     make([]uint8, len(c.Cartridge.ProgramRom)),
+			CHR:     make([]uint8, len(c.Cartridge.CharacterRom)),
+			console: c,
+		}
+		c.attachHooks()
+	}
+	return c.cdl
+}
+
+func (c *Console) DetachCodeDataLogger() {
+	if c.cdl == nil {
+		return
+	}
+	c.cdl = nil
+	c.attachHooks()
+}
+
+func (c *Console) CodeDataLogger() *CodeDataLogger {
+	return c.cdl
+}
+
+// beforeInstruction marks the bytes of the instruction about to be executed as code.
+func (l *CodeDataLogger) beforeInstruction() {
+	cpu := l.console.CPU
+	pc := cpu.programCounter
+	if l.console.Bus.PPU.NMIInterrupt {
+		pc = cpu.peek16(0xfffa)
+	}
+	op := cpu.instructions[cpu.Peek(pc)].OpeCode
+
+	flags := CDL_CODE
+	if l.indirect {
+		flags |= CDL_INDIRECT_CODE
+	}
+	for i := uint16(0); i < uint16(op.Length); i++ {
+		l.logPRG(pc+i, flags)
+	}
+	l.pc, l.length, l.mode = pc, uint16(op.Length), op.Mode
+	l.indirect = op.Mnemonic == "JMP" && op.Mode == INDIRECT
+}
+
+func (l *CodeDataLogger) logPRG(addr uint16, flags uint8) {
+	if addr < 0x8000 {
+		return
+	}
+	offset := l.console.Bus.ProgramRomOffset(addr)
+	l.PRG[offset] = l.PRG[offset]&^CDL_BANK_MASK | flags | uint8((addr-0x8000)>>13)<<2
+}
+
+func (l *CodeDataLogger) onAccess(space AddressSpace, addr uint16, value uint8, write bool) {
+	switch {
+	case write && space == SPACE_CPU:
+		l.onWrite(addr, value)
+	case write:
+		return
+	case space == SPACE_PPU:
+		if int(addr) < len(l.CHR) {
+			l.CHR[addr] |= CDL_READ
+		}
+	case addr-l.pc < l.length:
+		// opcode and operand fetches
+	case l.mode == INDIRECT_X || l.mode == INDIRECT_Y:
+		l.logPRG(addr, CDL_DATA|CDL_INDIRECT_DATA)
+	default:
+		l.logPRG(addr, CDL_DATA)
+	}
+}
+
+// onWrite follows the DMC registers, the APU not being emulated:
+// the whole sample is logged when the DMC is enabled, rather than every byte as it is fetched.
+func (l *CodeDataLogger) onWrite(addr uint16, value uint8) {
+	switch addr {
+	case 0x4012:
+		l.sampleAddr = 0xc000 + uint16(value)*64
+	case 0x4013:
+		l.sampleLength = uint16(value)*16 + 1
+	case 0x4015:
+		if value&0x10 == 0 {
+			return
+		}
+		// the address wraps around to $8000 after $FFFF
+		for i, addr := uint16(0), l.sampleAddr; i < l.sampleLength; i, addr = i+1, addr+1|0x8000 {
+			l.logPRG(addr, CDL_PCM)
+		}
+	}
+}
+
+func (l *CodeDataLogger) logRendered(addr uint16, length int) {
+	for i := int(addr); i < int(addr)+length && i < len(l.CHR); i++ {
+		l.CHR[i] |= CDL_RENDERED
+	}
+}
+
+// Reset forgets everything logged so far.
+func (l *CodeDataLogger) Reset() {
+	clear(l.PRG)
+	clear(l.CHR)
+}
+
+// Counts returns the number of PRG-ROM bytes logged as code and as data, and of CHR-ROM bytes rendered or read.
+func (l *CodeDataLogger) Counts() (code, data, chr int) {
+	for _, flags := range l.PRG {
+		if flags&CDL_CODE != 0 {
+			code++
+		}
+		if flags&CDL_DATA != 0 {
+			data++
+		}
+	}
+	for _, flags := range l.CHR {
+		if flags != 0 {
+			chr++
+		}
+	}
+	return code, data, chr
+}
+
+// Write writes a FCEUX .cdl file: the PRG-ROM flags followed by the CHR-ROM ones.
+func (l *CodeDataLogger) Write(w io.Writer) error {
+	if _, err := w.Write(l.PRG); err != nil {
+		return err
+	}
+	_, err := w.Write(l.CHR)
+	return err
+}
+
+// Read merges a .cdl file of the same ROM into the log, to go on logging where a previous session stopped.
+// The bank bits of the bytes accessed since the logger was attached are kept, those of the file taken otherwise.
+func (l *CodeDataLogger) Read(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) != len(l.PRG)+len(l.CHR) {
+		return fmt.Errorf("%w: %d bytes for a ROM of %d bytes of PRG-ROM and %d bytes of CHR-ROM",
+			ErrInvalidCodeDataLog, len(data), len(l.PRG), len(l.CHR))
+	}
+	for i, flags := range data[:len(l.PRG)] {
+		if l.PRG[i]&CDL_PRG_FLAGS == 0 {
+			l.PRG[i] = flags
+		} else {
+			l.PRG[i] |= flags & CDL_PRG_FLAGS
+		}
+	}
+	for i, flags := range data[len(l.PRG):] {
+		l.CHR[i] |= flags
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package nes_test
+
+import (
+	"bytes"
+	"go-nes/asm"
+	"go-nes/nes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const cdlTestProgram = `
+	LDA table
+	LDA $fffc
+	LDX #<table
+	STX $00
+	LDX #>table
+	STX $01
+	LDY #$01
+	LDA ($00),Y
+	JMP (vector)
+	.byte $ff
+vector:
+	.word target
+target:
+	LDA #$00
+	STA $2006
+	STA $2006
+	LDA $2007
+	LDA $2007
+loop:
+	JMP loop
+table:
+	.byte $12, $34
+`
+
+func createTestConsoleForCDLTest(t *testing.T) (*nes.Console, *asm.Assembly) {
+	t.Helper()
+	assembly, err := asm.Assemble(cdlTestProgram, 0x8000)
+	assert.NoError(t, err)
+	console := nes.NewConsole()
+	assert.NoError(t, console.LoadROM(nes.CreateTestROMForConsoleTest(assembly.Code)))
+	return console, assembly
+}
+
+func TestCodeDataLogger(t *testing.T) {
+	console, assembly := createTestConsoleForCDLTest(t)
+	cdl := console.AttachCodeDataLogger()
+	assert.Len(t, cdl.PRG, 0x8000)
+	assert.Len(t, cdl.CHR, 0x2000)
+	for console.CPU.ProgramCounter() != assembly.Labels["loop"] {
+		assert.NoError(t, console.StepInstruction())
+	}
+
+	offset := func(label string) int { return int(assembly.Labels[label] - 0x8000) }
+	tests := []struct {
+		name   string
+		offset int
+		want   uint8
+	}{
+		{"opcode", 0, nes.CDL_CODE},
+		{"operand", 2, nes.CDL_CODE},
+		{"data", offset("table"), nes.CDL_DATA},
+		{"indirect data", offset("table") + 1, nes.CDL_DATA | nes.CDL_INDIRECT_DATA},
+		{"indirect code", offset("target"), nes.CDL_CODE | nes.CDL_INDIRECT_CODE},
+		{"operand of indirect code", offset("target") + 1, nes.CDL_CODE | nes.CDL_INDIRECT_CODE},
+		{"after indirect code", offset("target") + 2, nes.CDL_CODE},
+		{"pointer", offset("vector"), nes.CDL_DATA},
+		{"unused", offset("vector") - 1, 0},
+		{"bank bits", 0x7ffc, nes.CDL_DATA | 3<<2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, cdl.PRG[tt.offset])
+		})
+	}
+
+	// $2007 reads are buffered: the first one fetches $0000, the second $0001
+	assert.Equal(t, nes.CDL_READ, cdl.CHR[0])
+	assert.Equal(t, nes.CDL_READ, cdl.CHR[1])
+	assert.Zero(t, cdl.CHR[2])
+
+	code, data, chr := cdl.Counts()
+	assert.Equal(t, offset("loop")-3, code) // all but the .byte $ff and the pointer
+	assert.Equal(t, 5, data)
+	assert.Equal(t, 2, chr)
+}
+
+func TestCodeDataLoggerRendering(t *testing.T) {
+	console, _ := createTestConsoleForCDLTest(t)
+	cdl := console.AttachCodeDataLogger()
+	assert.NoError(t, console.StepFrame())
+	// the background of tile 0 has been drawn
+	for i := 0; i < 16; i++ {
+		assert.Equal(t, nes.CDL_RENDERED, cdl.CHR[i]&nes.CDL_RENDERED)
+	}
+	assert.Zero(t, cdl.CHR[0x1000])
+}
+
+func TestCodeDataLoggerWriteRead(t *testing.T) {
+	console, _ := createTestConsoleForCDLTest(t)
+	cdl := console.AttachCodeDataLogger()
+	cdl.PRG[0x10] = nes.CDL_CODE
+	cdl.CHR[0x20] = nes.CDL_RENDERED
+
+	var buf bytes.Buffer
+	assert.NoError(t, cdl.Write(&buf))
+	assert.Equal(t, 0x8000+0x2000, buf.Len())
+
+	cdl.Reset()
+	cdl.PRG[0x10] = nes.CDL_DATA
+	assert.NoError(t, cdl.Read(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, nes.CDL_CODE|nes.CDL_DATA, cdl.PRG[0x10])
+	assert.Equal(t, nes.CDL_RENDERED, cdl.CHR[0x20])
+
+	// the bank bits aren't ORed
+	cdl.Reset()
+	cdl.PRG[0x10] = nes.CDL_CODE | 1<<2
+	cdl.PRG[0x11] = nes.CDL_CODE | 2<<2
+	buf.Reset()
+	assert.NoError(t, cdl.Write(&buf))
+	cdl.Reset()
+	cdl.PRG[0x10] = nes.CDL_DATA | 2<<2
+	assert.NoError(t, cdl.Read(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, nes.CDL_CODE|nes.CDL_DATA|2<<2, cdl.PRG[0x10])
+	assert.Equal(t, nes.CDL_CODE|2<<2, cdl.PRG[0x11])
+
+	err := cdl.Read(bytes.NewReader(buf.Bytes()[:0x8000]))
+	assert.ErrorIs(t, err, nes.ErrInvalidCodeDataLog)
+}
+
+func TestCodeDataLoggerPCM(t *testing.T) {
+	assembly, err := asm.Assemble(`
+	LDA #$ff
+	STA $4012
+	LDA #$04
+	STA $4013
+	LDA #$10
+	STA $4015
+loop:
+	JMP loop
+`, 0x8000)
+	assert.NoError(t, err)
+	console := nes.NewConsole()
+	assert.NoError(t, console.LoadROM(nes.CreateTestROMForConsoleTest(assembly.Code)))
+	cdl := console.AttachCodeDataLogger()
+	for console.CPU.ProgramCounter() != assembly.Labels["loop"] {
+		assert.NoError(t, console.StepInstruction())
+	}
+
+	// 65 bytes from $FFC0, wrapping around to $8000
+	assert.Equal(t, nes.CDL_PCM|3<<2, cdl.PRG[0x7fc0])
+	assert.Equal(t, nes.CDL_PCM|3<<2, cdl.PRG[0x7fff]&^nes.CDL_DATA)
+	assert.Equal(t, nes.CDL_CODE|nes.CDL_PCM, cdl.PRG[0])
+	assert.Zero(t, cdl.PRG[0x7fbf])
+	assert.Zero(t, cdl.PRG[1]&nes.CDL_PCM)
+}
+
+func TestCodeDataLoggerWithDebugger(t *testing.T) {
+	console, assembly := createTestConsoleForCDLTest(t)
+	cdl := console.AttachCodeDataLogger()
+	d := console.AttachDebugger()
+	_, err := d.AddBreakpoint(nes.BREAK_READ, nes.SPACE_CPU, assembly.Labels["table"], assembly.Labels["table"], "")
+	assert.NoError(t, err)
+
+	stop, err := d.Run(1)
+	assert.NoError(t, err)
+	assert.Equal(t, nes.STOP_BREAKPOINT, stop.Reason)
+	assert.Equal(t, nes.CDL_DATA, cdl.PRG[assembly.Labels["table"]-0x8000])
+
+	console.DetachDebugger()
+	assert.NoError(t, console.HardReset())
+	assert.Same(t, cdl, console.CodeDataLogger())
+	console.DetachCodeDataLogger()
+	assert.NoError(t, console.StepFrame())
+}
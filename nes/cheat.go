@@ -0,0 +1,216 @@
+package nes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidCheat = errors.New("invalid cheat code")
+
+// Game Genie letters in the order of the value they encode
+const GAME_GENIE_LETTERS = "APZLGITYEOXUKSVN"
+
+// Cheat replaces the value of an address.
+// ROM addresses ($8000-$FFFF) are patched on every CPU read, optionally only while the ROM holds Compare.
+// RAM addresses ($0000-$1FFF, $6000-$7FFF) are frozen by writing Value at the end of every frame.
+type Cheat struct {
+	Name       string
+	Code       string
+	Address    uint16
+	Value      uint8
+	Compare    uint8
+	HasCompare bool
+	Enabled    bool
+}
+
+// DecodeGameGenie decodes a 6 or 8 letter NES Game Genie code.
+func DecodeGameGenie(code string) (Cheat, error) {
+	code = strings.ToUpper(code)
+	if len(code) != 6 && len(code) != 8 {
+		return Cheat{}, fmt.Errorf("%w: %q: Game Genie codes have 6 or 8 letters", ErrInvalidCheat, code)
+	}
+	n := make([]uint16, len(code))
+	for i := 0; i < len(code); i++ {
+		v := strings.IndexByte(GAME_GENIE_LETTERS, code[i])
+		if v < 0 {
+			return Cheat{}, fmt.Errorf("%w: %q: %q is not a Game Genie letter", ErrInvalidCheat, code, code[i])
+		}
+		n[i] = uint16(v)
+	}
+
+	cheat := Cheat{
+		Code:    code,
+		Enabled: true,
+		Address: 0x8000 |
+			(n[3]&7)<<12 |
+			(n[5]&7)<<8 | (n[4]&8)<<8 |
+			(n[2]&7)<<4 | (n[1]&8)<<4 |
+			n[4]&7 | n[3]&8,
+	}
+	value := (n[1]&7)<<4 | (n[0]&8)<<4 | n[0]&7
+	if len(code) == 6 {
+		cheat.Value = uint8(value | n[5]&8)
+	} else {
+		cheat.Value = uint8(value | n[7]&8)
+		cheat.Compare = uint8((n[7]&7)<<4 | (n[6]&8)<<4 | n[6]&7 | n[5]&8)
+		cheat.HasCompare = true
+	}
+	return cheat, nil
+}
+
+// ParseCheat parses a Game Genie code or a raw code written as AAAA:VV or AAAA?CC:VV in hex.
+func ParseCheat(code string) (Cheat, error) {
+	if !strings.Contains(code, ":") {
+		return DecodeGameGenie(code)
+	}
+
+	addr, value, _ := strings.Cut(code, ":")
+	addr, compare, hasCompare := strings.Cut(addr, "?")
+	cheat := Cheat{Code: code, Enabled: true, HasCompare: hasCompare}
+
+	a, err := strconv.ParseUint(addr, 16, 16)
+	if err != nil {
+		return Cheat{}, fmt.Errorf("%w: %q: %v", ErrInvalidCheat, code, err)
+	}
+	cheat.Address = uint16(a)
+	if cheat.Address >= 0x2000 && cheat.Address < 0x6000 {
+		return Cheat{}, fmt.Errorf("%w: %q: address must be in RAM, PRG-RAM or PRG-ROM", ErrInvalidCheat, code)
+	}
+
+	v, err := strconv.ParseUint(value, 16, 8)
+	if err != nil {
+		return Cheat{}, fmt.Errorf("%w: %q: %v", ErrInvalidCheat, code, err)
+	}
+	cheat.Value = uint8(v)
+
+	if hasCompare {
+		c, err := strconv.ParseUint(compare, 16, 8)
+		if err != nil {
+			return Cheat{}, fmt.Errorf("%w: %q: %v", ErrInvalidCheat, code, err)
+		}
+		cheat.Compare = uint8(c)
+	}
+	return cheat, nil
+}
+
+// CheatList holds the cheats of the loaded ROM. It is shared by the console and every bus it creates.
+type CheatList struct {
+	Cheats []Cheat
+
+	patches map[uint16][]Cheat // enabled ROM cheats
+	freezes []Cheat            // enabled RAM cheats
+}
+
+func NewCheatList() *CheatList {
+	return &CheatList{}
+}
+
+func (l *CheatList) Add(cheat Cheat) {
+	l.Cheats = append(l.Cheats, cheat)
+	l.update()
+}
+
+func (l *CheatList) Remove(i int) {
+	l.Cheats = append(l.Cheats[:i], l.Cheats[i+1:]...)
+	l.update()
+}
+
+func (l *CheatList) SetEnabled(i int, enabled bool) {
+	l.Cheats[i].Enabled = enabled
+	l.update()
+}
+
+func (l *CheatList) Toggle(i int) {
+	l.SetEnabled(i, !l.Cheats[i].Enabled)
+}
+
+func (l *CheatList) Clear() {
+	l.Cheats = nil
+	l.update()
+}
+
+func (l *CheatList) update() {
+	l.patches = nil
+	l.freezes = nil
+	for _, cheat := range l.Cheats {
+		if !cheat.Enabled {
+			continue
+		}
+		if cheat.Address >= 0x8000 {
+			if l.patches == nil {
+				l.patches = map[uint16][]Cheat{}
+			}
+			l.patches[cheat.Address] = append(l.patches[cheat.Address], cheat)
+		} else {
+			l.freezes = append(l.freezes, cheat)
+		}
+	}
+}
+
+// patchROM returns the value the CPU reads from a ROM address holding value.
+func (l *CheatList) patchROM(addr uint16, value uint8) uint8 {
+	for _, cheat := range l.patches[addr] {
+		if !cheat.HasCompare || cheat.Compare == value {
+			return cheat.Value
+		}
+	}
+	return value
+}
+
+func (l *CheatList) freezeRAM(b *Bus) {
+	for _, cheat := range l.freezes {
+		if !cheat.HasCompare || b.Peek(cheat.Address) == cheat.Compare {
+			b.WriteMemory(cheat.Address, cheat.Value)
+		}
+	}
+}
+
+// Load reads a cheat file and appends its cheats. Each line holds a code and an optional name.
+// A line starting with "-" is a disabled cheat, "#" starts a comment.
+//
+//	SXIOPO infinite lives
+//	-0075:09 always 9 coins
+func (l *CheatList) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		enabled := true
+		if strings.HasPrefix(text, "-") {
+			enabled = false
+			text = text[1:]
+		}
+		code, name, _ := strings.Cut(text, " ")
+		cheat, err := ParseCheat(code)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		cheat.Name = strings.TrimSpace(name)
+		cheat.Enabled = enabled
+		l.Cheats = append(l.Cheats, cheat)
+	}
+	l.update()
+	return scanner.Err()
+}
+
+func (l *CheatList) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, cheat := range l.Cheats {
+		if !cheat.Enabled {
+			bw.WriteString("-")
+		}
+		bw.WriteString(cheat.Code)
+		if cheat.Name != "" {
+			bw.WriteString(" " + cheat.Name)
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,105 @@
+package nes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeGameGenie(t *testing.T) {
+	tests := []struct {
+		code   string
+		expect Cheat
+	}{
+		{"GOSSIP", Cheat{Code: "GOSSIP", Address: 0xd1dd, Value: 0x14, Enabled: true}},
+		{"sxiopo", Cheat{Code: "SXIOPO", Address: 0x91d9, Value: 0xad, Enabled: true}},
+		{"ZEXPYGLA", Cheat{Code: "ZEXPYGLA", Address: 0x94a7, Value: 0x02, Compare: 0x03, HasCompare: true, Enabled: true}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.code, func(t *testing.T) {
+			cheat, err := DecodeGameGenie(tt.code)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, cheat)
+		})
+	}
+}
+
+func TestParseCheat(t *testing.T) {
+	cheat, err := ParseCheat("0075:09")
+	assert.NoError(t, err)
+	assert.Equal(t, Cheat{Code: "0075:09", Address: 0x0075, Value: 0x09, Enabled: true}, cheat)
+
+	cheat, err = ParseCheat("C123?A9:EA")
+	assert.NoError(t, err)
+	assert.Equal(t, Cheat{Code: "C123?A9:EA", Address: 0xc123, Value: 0xea, Compare: 0xa9, HasCompare: true, Enabled: true}, cheat)
+
+	for _, code := range []string{"GOSSI", "GOSSIB", "2002:00", "zz:00", "0075:100", "8000?x:00"} {
+		_, err := ParseCheat(code)
+		assert.ErrorIs(t, err, ErrInvalidCheat, code)
+	}
+}
+
+func TestCheatPatchesROM(t *testing.T) {
+	console := NewConsole()
+	// LDA #$01, STA $10, BRK
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest([]uint8{0xa9, 0x01, 0x85, 0x10, 0x00})))
+
+	console.Cheats.Add(Cheat{Address: 0x8001, Value: 0x42, Enabled: true})
+	console.Cheats.Add(Cheat{Address: 0x8003, Value: 0x20, Compare: 0xff, HasCompare: true, Enabled: true})
+	assert.Equal(t, uint8(0x42), console.Bus.ReadMemory(0x8001))
+	assert.Equal(t, uint8(0x10), console.Bus.ReadMemory(0x8003))
+
+	assert.NoError(t, console.StepInstruction())
+	assert.NoError(t, console.StepInstruction())
+	assert.Equal(t, uint8(0x42), console.Bus.CpuVRAM[0x10])
+
+	console.Cheats.Toggle(0)
+	assert.Equal(t, uint8(0x01), console.Bus.ReadMemory(0x8001))
+}
+
+func TestCheatFreezesRAM(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	console.Cheats.Add(Cheat{Address: 0x0010, Value: 0x80, Enabled: true})
+	console.Cheats.Add(Cheat{Address: 0x6000, Value: 0x55, Compare: 0x00, HasCompare: true, Enabled: true})
+
+	// the program increments $10 all the time, but it is written again every frame
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, console.StepFrame())
+		assert.Equal(t, uint8(0x80), console.Bus.CpuVRAM[0x10])
+		assert.Equal(t, uint8(0x55), console.Cartridge.ProgramRam[0])
+	}
+
+	console.Cartridge.ProgramRam[0] = 0x01
+	console.Cheats.SetEnabled(0, false)
+	assert.NoError(t, console.StepFrame())
+	assert.NotEqual(t, uint8(0x80), console.Bus.CpuVRAM[0x10])
+	assert.Equal(t, uint8(0x01), console.Cartridge.ProgramRam[0])
+
+	// a ROM change keeps the list but not its content
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	assert.Empty(t, console.Cheats.Cheats)
+}
+
+func TestCheatListLoad(t *testing.T) {
+	file := `# lives
+SXIOPO infinite lives
+-0075:09 coins
+`
+	list := NewCheatList()
+	assert.NoError(t, list.Load(strings.NewReader(file)))
+	assert.Len(t, list.Cheats, 2)
+	assert.Equal(t, "infinite lives", list.Cheats[0].Name)
+	assert.True(t, list.Cheats[0].Enabled)
+	assert.Equal(t, uint16(0x0075), list.Cheats[1].Address)
+	assert.False(t, list.Cheats[1].Enabled)
+
+	var buf bytes.Buffer
+	assert.NoError(t, list.Write(&buf))
+	assert.Equal(t, "SXIOPO infinite lives\n-0075:09 coins\n", buf.String())
+
+	assert.ErrorIs(t, NewCheatList().Load(strings.NewReader("BADCODE\n")), ErrInvalidCheat)
+}
@@ -0,0 +1,270 @@
+package nes
+
+import (
+	"errors"
+	"image"
+)
+
+// Console owns every component of the NES and is the embedding API shared by
+// frontends, tests and tools.
+type Console struct {
+	Cartridge  *Cartridge
+	Bus        *Bus
+	CPU        *CPU
+	FrameCount uint // frames since the last power cycle
+	Cheats     *CheatList
+	Symbols    *SymbolTable
+
+	rom         []uint8
+	romCRC      uint32 // of PRG-ROM and CHR-ROM as loaded
+	frameOffset uint   // frames emulated before the last power cycle
+	replaying   bool   // re-emulating frames to rewind, hidden from the debugger, the trace and the profiler
+	frame       *Frame
+	errorPolicy ErrorPolicy
+	rewind      *rewindBuffer
+	movie       *moviePlayer
+	command     uint8 // MOVIE_COMMAND_* issued since the last frame
+	debugger    *Debugger
+	tracer      *TraceLogger
+	cdl         *CodeDataLogger
+	profiler    *Profiler
+
+	midFrame    bool // StepFrame returned before the end of the frame
+	frameTarget uint // VblankCount at the end of the current frame
+}
+
+func NewConsole() *Console {
+	return &Console{
+		Cheats:  NewCheatList(),
+		Symbols: NewSymbolTable(),
+		frame:   NewFrame(),
+	}
+}
+
+// LoadROM inserts an iNES image and powers the console on.
+func (c *Console) LoadROM(data []uint8) error {
+	cartridge, err := NewCartridge(data)
+	if err != nil {
+		return err
+	}
+	c.rom = data
+	c.romCRC = cartridgeChecksum(cartridge)
+	c.Cartridge = cartridge
+	c.Cheats.Clear()
+	c.Symbols.Clear()
+	c.movie = nil
+	c.powerCycle(cartridge)
+	c.frameOffset = 0
+	c.command = 0
+	if c.cdl != nil {
+		c.cdl = nil
+		c.AttachCodeDataLogger()
+	}
+	if c.profiler != nil {
+		c.profiler.Reset()
+	}
+	return nil
+}
+
+// Reset emulates pressing the reset button. RAM and most of the CPU registers are kept.
+// It returns ErrNoROM before a ROM is loaded.
+func (c *Console) Reset() error {
+	if c.rom == nil {
+		return ErrNoROM
+	}
+	c.Bus.PPU.Reset()
+	c.CPU.SoftReset()
+	c.command |= MOVIE_COMMAND_RESET
+	return nil
+}
+
+// HardReset emulates a power cycle. Every component is recreated from the loaded cartridge.
+// It returns ErrNoROM before a ROM is loaded.
+func (c *Console) HardReset() error {
+	if c.rom == nil {
+		return ErrNoROM
+	}
+	cartridge, err := NewCartridge(c.rom)
+	if err != nil {
+		return err
+	}
+	c.powerCycle(cartridge)
+	return nil
+}
+
+// powerCycle recreates every component around a freshly parsed cartridge.
+func (c *Console) powerCycle(cartridge *Cartridge) {
+	movieFrame := c.MovieFrame()
+	c.Cartridge = cartridge
+	c.Bus = NewBus(cartridge, nil)
+	c.Bus.ErrorPolicy = c.errorPolicy
+	c.Bus.Cheats = c.Cheats
+	c.Bus.Symbols = c.Symbols
+	c.CPU = NewCPU(c.Bus)
+	c.CPU.Reset()
+	c.frameOffset += c.FrameCount
+	c.FrameCount = 0
+	c.midFrame = false
+	c.frame = NewFrame()
+	if c.debugger != nil {
+		c.debugger.reset()
+	}
+	if c.profiler != nil {
+		c.profiler.reset()
+	}
+	c.attachHooks()
+	if c.rewind != nil {
+		c.EnableRewind(c.rewind.interval, c.rewind.budget)
+	}
+	if c.movie != nil {
+		c.movie.offset = movieFrame
+	}
+	c.command |= MOVIE_COMMAND_POWER
+}
+
+func (c *Console) SetErrorPolicy(policy ErrorPolicy) {
+	c.errorPolicy = policy
+	if c.Bus != nil {
+		c.Bus.ErrorPolicy = policy
+	}
+}
+
+// StepInstruction executes a single CPU instruction.
+// It returns a *DebugStop when an attached Debugger stops the execution.
+func (c *Console) StepInstruction() error {
+	d := c.debugger
+	if d != nil {
+		if err := d.beforeInstruction(); err != nil {
+			return err
+		}
+	}
+
+	if c.cdl != nil {
+		c.cdl.beforeInstruction()
+	}
+	if c.profiler != nil && !c.replaying {
+		c.profiler.beforeInstruction()
+	}
+	if t := c.tracer; t != nil && !c.replaying {
+		t.log(c)
+		defer func() {
+			if r := recover(); r != nil {
+				t.crash(r)
+				panic(r)
+			}
+		}()
+	}
+
+	err := c.CPU.Step()
+	// BRK is not emulated yet, so it is skipped like a NOP
+	if errors.Is(err, ErrBreak) {
+		err = nil
+	}
+	if err != nil && c.tracer != nil && !c.replaying {
+		c.tracer.crash(err)
+	}
+	if c.profiler != nil && !c.replaying && err == nil {
+		c.profiler.afterInstruction()
+	}
+
+	if d != nil && err == nil {
+		return d.afterInstruction()
+	}
+	return err
+}
+
+// StepFrame runs until the PPU enters the next vertical blank, then renders the framebuffer.
+// When it returns an error in the middle of a frame, the next call finishes that frame.
+func (c *Console) StepFrame() error {
+	for {
+		done, err := c.stepFrameInstruction()
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// stepFrameInstruction executes one instruction of the current frame, starting a new frame if needed.
+func (c *Console) stepFrameInstruction() (frameDone bool, err error) {
+	if !c.midFrame {
+		command, err := c.startMovieFrame()
+		if err != nil {
+			return false, err
+		}
+		if c.rewind != nil {
+			if err := c.rewind.record(c, command); err != nil {
+				return false, err
+			}
+		}
+		c.beginFrame()
+	}
+
+	// a debugger stop after the instruction entering vblank still ends the frame, as it would without a debugger
+	err = c.StepInstruction()
+	var stop *DebugStop
+	if err != nil && !errors.As(err, &stop) {
+		return false, err
+	}
+	if c.Bus.VblankCount < c.frameTarget {
+		return false, err
+	}
+	if frameErr := c.endFrame(); frameErr != nil {
+		return true, frameErr
+	}
+	return true, err
+}
+
+// stepFrame runs a whole frame without recording it for movies and rewinding.
+func (c *Console) stepFrame() error {
+	c.beginFrame()
+	for c.Bus.VblankCount < c.frameTarget {
+		if err := c.StepInstruction(); err != nil {
+			return err
+		}
+	}
+	return c.endFrame()
+}
+
+func (c *Console) beginFrame() {
+	c.midFrame = true
+	c.frameTarget = c.Bus.VblankCount + 1
+}
+
+func (c *Console) endFrame() error {
+	c.midFrame = false
+	c.Cheats.freezeRAM(c.Bus)
+	c.Bus.RenderFlag = false
+	c.FrameCount++
+	if c.profiler != nil && !c.replaying {
+		c.profiler.endFrame()
+	}
+	return c.frame.Render(c.Bus.PPU)
+}
+
+// EmulatedFrames returns the number of frames emulated since the ROM was loaded.
+// Unlike FrameCount, it is not reset by power cycles.
+func (c *Console) EmulatedFrames() uint {
+	return c.frameOffset + c.FrameCount
+}
+
+// Framebuffer returns the image rendered by the last StepFrame.
+// It is reused between frames, so copy it if it has to be kept.
+func (c *Console) Framebuffer() *image.RGBA {
+	return c.frame.Front
+}
+
+// AudioSamples returns the audio samples produced since the last call.
+// The APU is not emulated yet, so it is always empty.
+func (c *Console) AudioSamples() []float32 {
+	return nil
+}
+
+// SetButtons sets the pressed buttons of a controller (0 or 1) as a bit mask of 1 << JOYPAD_*.
+func (c *Console) SetButtons(player int, mask uint8) {
+	switch player {
+	case 0:
+		c.Bus.JoyPad1.SetButtons(mask)
+	case 1:
+		c.Bus.JoyPad2.SetButtons(mask)
+	}
+}
@@ -0,0 +1,85 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestROMForConsoleTest(program []uint8) []uint8 {
+	programRom := make([]uint8, 2*PROGRAM_ROM_PAGE_SIZE)
+	copy(programRom, program)
+	programRom[0x7ffc] = 0x00
+	programRom[0x7ffd] = 0x80
+
+	return createTestCartridge(TestCartridge{
+		header: []uint8{
+			0x4E, 0x45, 0x53, 0x1A, 0x02, 0x01, 0x31, 00, 00, 00, 00, 00, 00, 00, 00, 00,
+		},
+		programRom:   programRom,
+		characterRom: createDummyRom(0, 1*CHARACTER_ROM_PAGE_SIZE),
+	})
+}
+
+func TestConsoleStepFrame(t *testing.T) {
+	// loop: INC $10, JMP loop
+	console := NewConsole()
+	err := console.LoadROM(createTestROMForConsoleTest([]uint8{0xe6, 0x10, 0x4c, 0x00, 0x80}))
+	assert.NoError(t, err)
+
+	assert.NoError(t, console.StepFrame())
+	assert.NoError(t, console.StepFrame())
+	assert.Equal(t, uint(2), console.FrameCount)
+	assert.Equal(t, uint16(241), console.Bus.PPU.Scanline)
+	assert.NotZero(t, console.Bus.CpuVRAM[0x10])
+
+	bounds := console.Framebuffer().Bounds()
+	assert.Equal(t, SCREEN_WIDTH, bounds.Dx())
+	assert.Equal(t, SCREEN_HEIGHT, bounds.Dy())
+}
+
+func TestConsoleReset(t *testing.T) {
+	console := NewConsole()
+	err := console.LoadROM(createTestROMForConsoleTest([]uint8{0xe6, 0x10, 0x4c, 0x00, 0x80}))
+	assert.NoError(t, err)
+	assert.NoError(t, console.StepFrame())
+
+	assert.NoError(t, console.Reset())
+	assert.Equal(t, uint16(0x8000), console.CPU.ProgramCounter())
+	assert.NotZero(t, console.Bus.CpuVRAM[0x10])
+
+	assert.NoError(t, console.HardReset())
+	assert.Equal(t, uint16(0x8000), console.CPU.ProgramCounter())
+	assert.Zero(t, console.Bus.CpuVRAM[0x10])
+	assert.Zero(t, console.FrameCount)
+}
+
+func TestConsoleResetWithoutROM(t *testing.T) {
+	console := NewConsole()
+	assert.ErrorIs(t, console.Reset(), ErrNoROM)
+	assert.ErrorIs(t, console.HardReset(), ErrNoROM)
+	_, err := console.RecordMovie("test.nes")
+	assert.ErrorIs(t, err, ErrNoROM)
+	assert.ErrorIs(t, console.PlayMovie(&Movie{}, true), ErrNoROM)
+}
+
+func TestConsoleSetButtons(t *testing.T) {
+	console := NewConsole()
+	err := console.LoadROM(createTestROMForConsoleTest(nil))
+	assert.NoError(t, err)
+
+	console.SetButtons(0, 1<<JOYPAD_A|1<<JOYPAD_START)
+	console.Bus.WriteMemory(0x4016, 1)
+	console.Bus.WriteMemory(0x4016, 0)
+
+	var got []uint8
+	for i := 0; i < 8; i++ {
+		got = append(got, console.Bus.ReadMemory(0x4016))
+	}
+	assert.Equal(t, []uint8{1, 0, 0, 1, 0, 0, 0, 0}, got)
+}
+
+func TestConsoleLoadInvalidROM(t *testing.T) {
+	console := NewConsole()
+	assert.ErrorIs(t, console.LoadROM([]uint8{0x00}), ErrInvalidROM)
+}
@@ -1,6 +1,7 @@
 package nes
 
 import (
+	"errors"
 	"fmt"
 	"os"
 )
@@ -21,6 +22,18 @@ const (
 	ACCUMULATOR
 	RELATIVE
 	IMPLIED
+	// 65C02 only
+	ZERO_PAGE_INDIRECT
+	INDIRECT_ABSOLUTE_X
+	ZERO_PAGE_RELATIVE
+)
+
+type CPUVariant uint8
+
+const (
+	CPU_VARIANT_2A03  CPUVariant = iota // NES (Ricoh 2A03): decimal mode has no effect on arithmetic
+	CPU_VARIANT_6502                    // NMOS 6502 with decimal mode
+	CPU_VARIANT_65C02                   // CMOS 65C02 including the Rockwell/WDC bit instructions
 )
 
 const (
@@ -41,10 +54,22 @@ type CPU struct {
 	status         uint8
 	programCounter uint16
 	stackPointer   uint8
-	bus            *Bus
+	bus            Memory
+	nmi            nmiSource
+	faults         faultSource
+	variant        CPUVariant
+	instructions   *[256]instruction
+	jumped         bool // the instruction being executed loaded the program counter
+}
+
+func NewCPU(bus Memory) *CPU {
+	return NewCPUWithVariant(bus, CPU_VARIANT_2A03)
 }
 
-func NewCPU(bus *Bus) *CPU {
+func NewCPUWithVariant(bus Memory, variant CPUVariant) *CPU {
+	nmi, _ := bus.(nmiSource)
+	faults, _ := bus.(faultSource)
+
 	return &CPU{
 		registerA:      0,
 		registerX:      0,
@@ -53,6 +78,10 @@ func NewCPU(bus *Bus) *CPU {
 		programCounter: 0,
 		stackPointer:   0xfd,
 		bus:            bus,
+		nmi:            nmi,
+		faults:         faults,
+		variant:        variant,
+		instructions:   instructionTable(variant),
 	}
 }
 
@@ -108,6 +137,14 @@ func (cpu *CPU) adc(opsInfo OpeCode) {
 	b := cpu.readMemory(addr)
 	c := cpu.status & CPU_FLAG_CARRY
 
+	if cpu.decimalMode() {
+		cpu.adcDecimal(a, b, c)
+		if pageCrossed && opsInfo.AddCycleIfPageCrossed {
+			cpu.bus.Tick(1)
+		}
+		return
+	}
+
 	cpu.setRegisterA(a + b + c)
 
 	if int(a)+int(b)+int(c) > 0xff {
@@ -128,6 +165,98 @@ func (cpu *CPU) adc(opsInfo OpeCode) {
 	}
 }
 
+// decimalMode reports whether ADC/SBC operate on BCD values.
+// The 2A03 in the NES has the decimal circuit removed, so the D flag is only a status bit there.
+func (c *CPU) decimalMode() bool {
+	return c.variant != CPU_VARIANT_2A03 && c.status&CPU_FLAG_DECIMAL_MODE != 0
+}
+
+// http://www.6502.org/tutorials/decimal_mode.html#A
+func (cpu *CPU) adcDecimal(a, b, c uint8) {
+	lo := int(a&0x0f) + int(b&0x0f) + int(c)
+	if lo >= 0x0a {
+		lo = ((lo + 0x06) & 0x0f) + 0x10
+	}
+	result := int(a&0xf0) + int(b&0xf0) + lo
+
+	// N and V are taken from the intermediate result before the upper nibble is adjusted
+	signed := int(int8(a&0xf0)) + int(int8(b&0xf0)) + lo
+	if signed < -128 || signed > 127 {
+		cpu.status |= CPU_FLAG_OVERFLOW
+	} else {
+		cpu.status &= ^CPU_FLAG_OVERFLOW
+	}
+
+	if result >= 0xa0 {
+		result += 0x60
+	}
+	if result >= 0x100 {
+		cpu.status |= CPU_FLAG_CARRY
+	} else {
+		cpu.status &= ^CPU_FLAG_CARRY
+	}
+
+	cpu.registerA = uint8(result)
+	if cpu.variant == CPU_VARIANT_65C02 {
+		// 65C02 sets N and Z from the decimal result and takes an extra cycle
+		cpu.updateZeroAndNegativeFlags(cpu.registerA)
+		cpu.bus.Tick(1)
+		return
+	}
+
+	// NMOS 6502 sets Z from the binary sum, N from the intermediate result
+	cpu.updateZeroAndNegativeFlags(a + b + c)
+	if uint8(signed)&0x80 != 0 {
+		cpu.status |= CPU_FLAG_NEGATIVE
+	} else {
+		cpu.status &= ^CPU_FLAG_NEGATIVE
+	}
+}
+
+// http://www.6502.org/tutorials/decimal_mode.html#A
+func (cpu *CPU) sbcDecimal(a, b, c uint8) {
+	binary := int(a) - int(b) - int(1-c)
+
+	// C and V behave as in binary mode on both NMOS and CMOS
+	if binary >= 0 {
+		cpu.status |= CPU_FLAG_CARRY
+	} else {
+		cpu.status &= ^CPU_FLAG_CARRY
+	}
+	overflow := (a^b)&0x80 != 0 && (a^uint8(binary))&0x80 != 0
+
+	lo := int(a&0x0f) - int(b&0x0f) - int(1-c)
+	var result int
+	if cpu.variant == CPU_VARIANT_65C02 {
+		result = binary
+		if result < 0 {
+			result -= 0x60
+		}
+		if lo < 0 {
+			result -= 0x06
+		}
+		cpu.setRegisterA(uint8(result))
+		cpu.bus.Tick(1)
+	} else {
+		if lo < 0 {
+			lo = ((lo - 0x06) & 0x0f) - 0x10
+		}
+		result = int(a&0xf0) - int(b&0xf0) + lo
+		if result < 0 {
+			result -= 0x60
+		}
+		// NMOS 6502 sets N and Z from the binary result
+		cpu.updateZeroAndNegativeFlags(uint8(binary))
+		cpu.registerA = uint8(result)
+	}
+
+	if overflow {
+		cpu.status |= CPU_FLAG_OVERFLOW
+	} else {
+		cpu.status &= ^CPU_FLAG_OVERFLOW
+	}
+}
+
 func (c *CPU) and(opsInfo OpeCode) {
 	addr, pageCrossed := c.getOperandAddress(opsInfo)
 	c.setRegisterA(c.registerA & c.readMemory(addr))
@@ -160,32 +289,32 @@ func (c *CPU) asl(opsInfo OpeCode) {
 	c.updateZeroAndNegativeFlags(value)
 }
 
-func (c *CPU) bcc() {
+func (c *CPU) bcc(opsInfo OpeCode) {
 	if c.status&CPU_FLAG_CARRY == 0 {
-		addr, _ := c.getOperandAddress(CPU_OPS_CODES[0x90])
+		addr, _ := c.getOperandAddress(opsInfo)
 		c.addBranchCycles(addr)
-		c.programCounter += addr + 1
+		c.jump(c.programCounter + addr + 1)
 	}
 }
 
-func (c *CPU) bcs() {
+func (c *CPU) bcs(opsInfo OpeCode) {
 	if c.status&CPU_FLAG_CARRY != 0 {
-		addr, _ := c.getOperandAddress(CPU_OPS_CODES[0xb0])
+		addr, _ := c.getOperandAddress(opsInfo)
 		c.addBranchCycles(addr)
-		c.programCounter += addr + 1
+		c.jump(c.programCounter + addr + 1)
 	}
 }
 
-func (c *CPU) beq() {
+func (c *CPU) beq(opsInfo OpeCode) {
 	if c.status&CPU_FLAG_ZERO != 0 {
-		addr, _ := c.getOperandAddress(CPU_OPS_CODES[0xf0])
+		addr, _ := c.getOperandAddress(opsInfo)
 		c.addBranchCycles(addr)
-		c.programCounter += addr + 1
+		c.jump(c.programCounter + addr + 1)
 	}
 }
 
 func (c *CPU) bit(opsInfo OpeCode) {
-	addr, _ := c.getOperandAddress(opsInfo)
+	addr, pageCrossed := c.getOperandAddress(opsInfo)
 	value := c.readMemory(addr)
 	if value&c.registerA == 0 {
 		c.status |= CPU_FLAG_ZERO
@@ -193,6 +322,15 @@ func (c *CPU) bit(opsInfo OpeCode) {
 		c.status &= ^CPU_FLAG_ZERO
 	}
 
+	if pageCrossed && opsInfo.AddCycleIfPageCrossed {
+		c.bus.Tick(1)
+	}
+
+	// 65C02 BIT #imm only affects the Z flag
+	if opsInfo.Mode == IMMEDIATE {
+		return
+	}
+
 	if value&CPU_FLAG_NEGATIVE != 0 {
 		c.status |= CPU_FLAG_NEGATIVE
 	} else {
@@ -206,43 +344,43 @@ func (c *CPU) bit(opsInfo OpeCode) {
 	}
 }
 
-func (c *CPU) bmi() {
+func (c *CPU) bmi(opsInfo OpeCode) {
 	if c.status&CPU_FLAG_NEGATIVE != 0 {
-		addr, _ := c.getOperandAddress(CPU_OPS_CODES[0x30])
+		addr, _ := c.getOperandAddress(opsInfo)
 		c.addBranchCycles(addr)
-		c.programCounter += addr + 1
+		c.jump(c.programCounter + addr + 1)
 	}
 }
 
-func (c *CPU) bne() {
+func (c *CPU) bne(opsInfo OpeCode) {
 	if c.status&CPU_FLAG_ZERO == 0 {
-		addr, _ := c.getOperandAddress(CPU_OPS_CODES[0xd0])
+		addr, _ := c.getOperandAddress(opsInfo)
 		c.addBranchCycles(addr)
-		c.programCounter += addr + 1
+		c.jump(c.programCounter + addr + 1)
 	}
 }
 
-func (c *CPU) bpl() {
+func (c *CPU) bpl(opsInfo OpeCode) {
 	if c.status&CPU_FLAG_NEGATIVE == 0 {
-		addr, _ := c.getOperandAddress(CPU_OPS_CODES[0x10])
+		addr, _ := c.getOperandAddress(opsInfo)
 		c.addBranchCycles(addr)
-		c.programCounter += addr + 1
+		c.jump(c.programCounter + addr + 1)
 	}
 }
 
-func (c *CPU) bvc() {
+func (c *CPU) bvc(opsInfo OpeCode) {
 	if c.status&CPU_FLAG_OVERFLOW == 0 {
-		addr, _ := c.getOperandAddress(CPU_OPS_CODES[0x50])
+		addr, _ := c.getOperandAddress(opsInfo)
 		c.addBranchCycles(addr)
-		c.programCounter += addr + 1
+		c.jump(c.programCounter + addr + 1)
 	}
 }
 
-func (c *CPU) bvs() {
+func (c *CPU) bvs(opsInfo OpeCode) {
 	if c.status&CPU_FLAG_OVERFLOW != 0 {
-		addr, _ := c.getOperandAddress(CPU_OPS_CODES[0x70])
+		addr, _ := c.getOperandAddress(opsInfo)
 		c.addBranchCycles(addr)
-		c.programCounter += addr + 1
+		c.jump(c.programCounter + addr + 1)
 	}
 }
 
@@ -303,6 +441,11 @@ func (c *CPU) cpy(opsInfo OpeCode) {
 }
 
 func (c *CPU) dec(opsInfo OpeCode) {
+	if opsInfo.Mode == ACCUMULATOR {
+		c.setRegisterA(c.registerA - 1)
+		return
+	}
+
 	addr, _ := c.getOperandAddress(opsInfo)
 	value := c.readMemory(addr)
 	value--
@@ -330,6 +473,11 @@ func (c *CPU) eor(opsInfo OpeCode) {
 }
 
 func (c *CPU) inc(opsInfo OpeCode) {
+	if opsInfo.Mode == ACCUMULATOR {
+		c.setRegisterA(c.registerA + 1)
+		return
+	}
+
 	addr, _ := c.getOperandAddress(opsInfo)
 	value := c.readMemory(addr)
 	value++
@@ -351,7 +499,12 @@ func (c *CPU) jmp(opsInfo OpeCode) {
 	addr, _ := c.getOperandAddress(opsInfo)
 
 	if opsInfo.Mode == ABSOLUTE {
-		c.programCounter = addr
+		c.jump(addr)
+		return
+	}
+
+	if c.variant == CPU_VARIANT_65C02 {
+		c.jump(c.readMemory16(addr))
 		return
 	}
 
@@ -369,14 +522,14 @@ func (c *CPU) jmp(opsInfo OpeCode) {
 		indirectAddr = c.readMemory16(addr)
 	}
 
-	c.programCounter = indirectAddr
+	c.jump(indirectAddr)
 }
 
-func (c *CPU) jsr() {
-	addr, _ := c.getOperandAddress(CPU_OPS_CODES[0x20])
+func (c *CPU) jsr(opsInfo OpeCode) {
+	addr, _ := c.getOperandAddress(opsInfo)
 	// 2バイト加算している理由は、JSR命令の次の命令を実行するため
 	c.stackPush16(c.programCounter + 2 - 1)
-	c.programCounter = addr
+	c.jump(addr)
 }
 
 func (c *CPU) lsr(opsInfo OpeCode) {
@@ -484,11 +637,11 @@ func (c *CPU) ror(opsInfo OpeCode) {
 
 func (c *CPU) rti() {
 	c.status = c.stackPop()&^CPU_FLAG_BREAK | CPU_FLAG_BREAK2
-	c.programCounter = c.stackPop16()
+	c.jump(c.stackPop16())
 }
 
 func (c *CPU) rts() {
-	c.programCounter = c.stackPop16() + 1
+	c.jump(c.stackPop16() + 1)
 }
 
 func (cpu *CPU) sbc(opsInfo OpeCode) {
@@ -497,6 +650,14 @@ func (cpu *CPU) sbc(opsInfo OpeCode) {
 	b := cpu.readMemory(addr)
 	c := cpu.status & CPU_FLAG_CARRY
 
+	if cpu.decimalMode() {
+		cpu.sbcDecimal(a, b, c)
+		if pageCrossed && opsInfo.AddCycleIfPageCrossed {
+			cpu.bus.Tick(1)
+		}
+		return
+	}
+
 	cpu.setRegisterA(a - b - (1 - c))
 
 	// 引き算の結果が0未満の場合、キャリーフラグをクリアします。それ以外の場合はキャリーフラグをセットします。
@@ -558,10 +719,109 @@ func (c *CPU) tya() {
 }
 
 func (c *CPU) brk() {
-	c.stackPush16(c.programCounter)
+	// BRK is followed by a padding byte which is skipped on return
+	c.stackPush16(c.programCounter + 1)
 	c.php()
 	c.sei()
-	c.programCounter = c.readMemory16(0xfffe)
+	if c.variant == CPU_VARIANT_65C02 {
+		c.cld()
+	}
+	c.jump(c.readMemory16(0xfffe))
+}
+
+func (c *CPU) bra(opsInfo OpeCode) {
+	addr, _ := c.getOperandAddress(opsInfo)
+	c.addBranchCycles(addr)
+	c.jump(c.programCounter + addr + 1)
+}
+
+func (c *CPU) phx() {
+	c.stackPush(c.registerX)
+}
+
+func (c *CPU) phy() {
+	c.stackPush(c.registerY)
+}
+
+func (c *CPU) plx() {
+	c.registerX = c.stackPop()
+	c.updateZeroAndNegativeFlags(c.registerX)
+}
+
+func (c *CPU) ply() {
+	c.registerY = c.stackPop()
+	c.updateZeroAndNegativeFlags(c.registerY)
+}
+
+func (c *CPU) stz(opsInfo OpeCode) {
+	addr, _ := c.getOperandAddress(opsInfo)
+	c.writeMemory(addr, 0)
+}
+
+func (c *CPU) trb(opsInfo OpeCode) {
+	addr, _ := c.getOperandAddress(opsInfo)
+	value := c.readMemory(addr)
+	if value&c.registerA == 0 {
+		c.status |= CPU_FLAG_ZERO
+	} else {
+		c.status &= ^CPU_FLAG_ZERO
+	}
+	c.writeMemory(addr, value&^c.registerA)
+}
+
+func (c *CPU) tsb(opsInfo OpeCode) {
+	addr, _ := c.getOperandAddress(opsInfo)
+	value := c.readMemory(addr)
+	if value&c.registerA == 0 {
+		c.status |= CPU_FLAG_ZERO
+	} else {
+		c.status &= ^CPU_FLAG_ZERO
+	}
+	c.writeMemory(addr, value|c.registerA)
+}
+
+// RMB0-7, SMB0-7, BBR0-7 and BBS0-7 encode the bit number in the upper nibble of the opcode
+func (c *CPU) rmb(opsInfo OpeCode) {
+	addr, _ := c.getOperandAddress(opsInfo)
+	bit := uint8(1) << (opsInfo.Code >> 4 & 0b111)
+	c.writeMemory(addr, c.readMemory(addr)&^bit)
+}
+
+func (c *CPU) smb(opsInfo OpeCode) {
+	addr, _ := c.getOperandAddress(opsInfo)
+	bit := uint8(1) << (opsInfo.Code >> 4 & 0b111)
+	c.writeMemory(addr, c.readMemory(addr)|bit)
+}
+
+func (c *CPU) bbr(opsInfo OpeCode) {
+	addr, _ := c.getOperandAddress(opsInfo)
+	bit := uint8(1) << (opsInfo.Code >> 4 & 0b111)
+	if c.readMemory(addr)&bit == 0 {
+		c.branchZeroPageRelative()
+	}
+}
+
+func (c *CPU) bbs(opsInfo OpeCode) {
+	addr, _ := c.getOperandAddress(opsInfo)
+	bit := uint8(1) << (opsInfo.Code >> 4 & 0b111)
+	if c.readMemory(addr)&bit != 0 {
+		c.branchZeroPageRelative()
+	}
+}
+
+func (c *CPU) branchZeroPageRelative() {
+	offset, _ := c.getAbsoluteAddress(OpeCode{Mode: RELATIVE}, c.programCounter+1)
+	c.programCounter++
+	c.addBranchCycles(offset)
+	c.jump(c.programCounter + offset + 1)
+}
+
+func (c *CPU) nopRead(opsInfo OpeCode) {
+	addr, pageCrossed := c.getOperandAddress(opsInfo)
+	c.readMemory(addr)
+	if pageCrossed && opsInfo.AddCycleIfPageCrossed {
+		c.bus.Tick(1)
+	}
 }
 
 func (c *CPU) lax(opsInfo OpeCode) {
@@ -619,7 +879,19 @@ func (c *CPU) updateZeroAndNegativeFlags(result uint8) {
 }
 
 func (c *CPU) readMemory(address uint16) uint8 {
-	return c.bus.ReadMemory(address)
+	return c.bus.Read(address)
+}
+
+// Peek reads memory without side effects when the bus implements Peeker, and with a plain read otherwise.
+func (c *CPU) Peek(address uint16) uint8 {
+	if p, ok := c.bus.(Peeker); ok {
+		return p.Peek(address)
+	}
+	return c.bus.Read(address)
+}
+
+func (c *CPU) peek16(address uint16) uint16 {
+	return uint16(c.Peek(address+1))<<8 | uint16(c.Peek(address))
 }
 
 func (c *CPU) readMemory16(address uint16) uint16 {
@@ -629,7 +901,7 @@ func (c *CPU) readMemory16(address uint16) uint16 {
 }
 
 func (c *CPU) writeMemory(address uint16, value uint8) {
-	c.bus.WriteMemory(address, value)
+	c.bus.Write(address, value)
 }
 
 func (c *CPU) writeMemory16(address uint16, value uint16) {
@@ -679,173 +951,59 @@ func (c *CPU) Reset() {
 	c.stackPointer = 0xfd
 }
 
-func (c *CPU) Step() bool {
-	if c.bus.PollNMIStatus() {
+// SoftReset emulates the reset button: A, X and Y are kept,
+// the stack pointer is decremented by 3 and interrupts are disabled.
+func (c *CPU) SoftReset() {
+	c.stackPointer -= 3
+	c.status |= CPU_FLAG_INTERRUPT_DISABLE
+	c.programCounter = c.readMemory16(0xFFFC)
+}
+
+// Step executes a single instruction.
+// It returns ErrBreak when the 2A03 hits BRK, an *IllegalOpcodeError for an opcode which
+// is not implemented, and any error reported by the memory according to its ErrorPolicy.
+func (c *CPU) Step() error {
+	if c.nmi != nil && c.nmi.PollNMIStatus() {
 		c.InterruptNMI()
 	}
 
-	//fmt.Println(trace(c))
 	code := c.readMemory(c.programCounter)
 	c.programCounter++
-	programCounterState := c.programCounter
 
-	var opsInfo OpeCode
-	var ok bool
-	if opsInfo, ok = CPU_OPS_CODES[code]; !ok {
-		panic(fmt.Sprintf("unknown code: %d", code))
+	inst := &c.instructions[code]
+	if inst.execute == nil {
+		c.programCounter--
+		return &IllegalOpcodeError{PC: c.programCounter, Opcode: code}
 	}
-
-	switch opsInfo.Mnemonic {
-	case "BRK":
+	if code == 0x00 && c.variant == CPU_VARIANT_2A03 {
+		// BRK
 		//c.brk()
-		return false
-	case "ADC":
-		c.adc(opsInfo)
-	case "AND":
-		c.and(opsInfo)
-	case "ASL":
-		c.asl(opsInfo)
-	case "BCC":
-		c.bcc()
-	case "BCS":
-		c.bcs()
-	case "BEQ":
-		c.beq()
-	case "BIT":
-		c.bit(opsInfo)
-	case "BMI":
-		c.bmi()
-	case "BNE":
-		c.bne()
-	case "BPL":
-		c.bpl()
-	case "BVC":
-		c.bvc()
-	case "BVS":
-		c.bvs()
-	case "CLC":
-		c.clc()
-	case "CLD":
-		c.cld()
-	case "CLI":
-		c.cli()
-	case "CLV":
-		c.clv()
-	case "CMP":
-		c.cmp(opsInfo)
-	case "CPX":
-		c.cpx(opsInfo)
-	case "CPY":
-		c.cpy(opsInfo)
-	case "DEC":
-		c.dec(opsInfo)
-	case "DEX":
-		c.dex()
-	case "DEY":
-		c.dey()
-	case "EOR":
-		c.eor(opsInfo)
-	case "INC":
-		c.inc(opsInfo)
-	case "INX":
-		c.inx()
-	case "INY":
-		c.iny()
-	case "JMP":
-		c.jmp(opsInfo)
-	case "JSR":
-		c.jsr()
-	case "LDA":
-		c.lda(opsInfo)
-	case "LDX":
-		c.ldx(opsInfo)
-	case "LDY":
-		c.ldy(opsInfo)
-	case "LSR":
-		c.lsr(opsInfo)
-	case "NOP":
-		// 何もしない
-	case "ORA":
-		c.ora(opsInfo)
-	case "PHA":
-		c.pha()
-	case "PHP":
-		c.php()
-	case "PLA":
-		c.pla()
-	case "PLP":
-		c.plp()
-	case "ROL":
-		c.rol(opsInfo)
-	case "ROR":
-		c.ror(opsInfo)
-	case "RTI":
-		c.rti()
-	case "RTS":
-		c.rts()
-	case "SBC", "*SBC":
-		c.sbc(opsInfo)
-	case "SEC":
-		c.sec()
-	case "SED":
-		c.sed()
-	case "SEI":
-		c.sei()
-	case "STA":
-		c.sta(opsInfo)
-	case "STX":
-		c.stx(opsInfo)
-	case "STY":
-		c.sty(opsInfo)
-	case "TAX":
-		c.tax()
-	case "TAY":
-		c.tay()
-	case "TSX":
-		c.tsx()
-	case "TXA":
-		c.txa()
-	case "TXS":
-		c.txs()
-	case "TYA":
-		c.tya()
-	case "*NOP":
-		addr, pageCrossed := c.getOperandAddress(opsInfo)
-		c.readMemory(addr)
-		if pageCrossed && opsInfo.AddCycleIfPageCrossed {
-			c.bus.Tick(1)
-		}
-	case "*LAX":
-		c.lax(opsInfo)
-	case "*SAX":
-		c.sax(opsInfo)
-	case "*DCP":
-		c.dcp(opsInfo)
-	case "*ISB":
-		c.isb(opsInfo)
-	case "*SLO":
-		c.slo(opsInfo)
-	case "*RLA":
-		c.rla(opsInfo)
-	case "*RRA":
-		c.rra(opsInfo)
-	case "*SRE":
-		c.sre(opsInfo)
+		return ErrBreak
 	}
+	opsInfo := inst.OpeCode
+	c.jumped = false
+	inst.execute(c, opsInfo)
 
 	c.bus.Tick(opsInfo.Cycles)
 
-	if programCounterState == c.programCounter {
+	if !c.jumped {
 		c.programCounter += uint16(opsInfo.Length - 1)
 	}
 
-	return true
+	if c.faults != nil {
+		return c.faults.TakeError()
+	}
+	return nil
 }
 
-func (c *CPU) Run() {
+// Run executes instructions until BRK or an error occurs.
+func (c *CPU) Run() error {
 	for {
-		if !c.Step() {
-			break
+		if err := c.Step(); err != nil {
+			if errors.Is(err, ErrBreak) {
+				return nil
+			}
+			return err
 		}
 	}
 }
@@ -908,6 +1066,16 @@ func (c *CPU) getAbsoluteAddress(opsInfo OpeCode, addr uint16) (uint16, bool) {
 		result = address
 	case IMPLIED:
 		result = 0
+	case ZERO_PAGE_INDIRECT:
+		base := c.readMemory(addr)
+		lo := c.readMemory(uint16(base))
+		hi := c.readMemory(uint16(base + 1))
+
+		result = uint16(hi)<<8 | uint16(lo)
+	case INDIRECT_ABSOLUTE_X:
+		result = c.readMemory16(addr) + uint16(c.registerX)
+	case ZERO_PAGE_RELATIVE:
+		result = uint16(c.readMemory(addr))
 	default:
 		panic(fmt.Sprintf("unknown addressing mode: %d", opsInfo.Mode))
 	}
@@ -919,6 +1087,12 @@ func PageDiffer(a, b uint16) bool {
 	return a&0xff00 != b&0xff00
 }
 
+// jump sets the program counter, which Step then doesn't move past the operand of the instruction.
+func (c *CPU) jump(addr uint16) {
+	c.programCounter = addr
+	c.jumped = true
+}
+
 func (c *CPU) addBranchCycles(address uint16) {
 	c.bus.Tick(1)
 	if PageDiffer(c.programCounter+1, c.programCounter+address+1) {
@@ -931,6 +1105,9 @@ func (c *CPU) InterruptNMI() {
 	status := c.status | CPU_FLAG_BREAK | CPU_FLAG_BREAK2
 	c.stackPush(status)
 	c.status |= CPU_FLAG_INTERRUPT_DISABLE
+	if c.variant == CPU_VARIANT_65C02 {
+		c.status &= ^CPU_FLAG_DECIMAL_MODE
+	}
 	c.bus.Tick(2)
 	c.programCounter = c.readMemory16(0xfffa)
 }
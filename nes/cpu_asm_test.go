@@ -0,0 +1,133 @@
+package nes_test
+
+import (
+	"go-nes/nes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestMemory returns the memory of program assembled at $8000, with the reset vector pointing to it.
+func createTestMemory(t *testing.T, program string) *nes.FlatRAM {
+	t.Helper()
+	memory := nes.NewFlatRAM()
+	memory.Load(0x8000, assemble(t, program))
+	memory.Write(0xfffc, 0x00)
+	memory.Write(0xfffd, 0x80)
+	return memory
+}
+
+func TestCPULDA(t *testing.T) {
+	cases := []struct {
+		name            string
+		memory          map[uint16]uint8
+		program         string
+		expectRegisterA uint8
+	}{
+		{
+			name:            "LDA Immediate",
+			program:         "LDA #$05\nBRK",
+			expectRegisterA: uint8(0x05),
+		},
+		{
+			name:            "LDA ZeroPage",
+			memory:          map[uint16]uint8{0x10: 0x05},
+			program:         "LDA $10\nBRK",
+			expectRegisterA: uint8(0x05),
+		},
+		{
+			name:            "LDA ZeroPageX",
+			memory:          map[uint16]uint8{0x10: 0x04, 0x11: 0x05},
+			program:         "LDA #$01\nTAX\nLDA $10,X\nBRK",
+			expectRegisterA: uint8(0x05),
+		},
+		// LDA Absolute
+		{
+			name:            "LDA Absolute",
+			memory:          map[uint16]uint8{0x0010: 0x05},
+			program:         "LDA a:$0010\nBRK",
+			expectRegisterA: uint8(0x05),
+		},
+		// LDA AbsoluteX
+		{
+			name:            "LDA AbsoluteX",
+			memory:          map[uint16]uint8{0x0011: 0x05},
+			program:         "LDA #$01\nTAX\nLDA a:$0010,X\nBRK",
+			expectRegisterA: uint8(0x05),
+		},
+		// LDA IndirectX
+		{
+			name:            "LDA IndirectX",
+			memory:          map[uint16]uint8{0x11: 0x05, 0x12: 0x06, 0x0605: 0x07},
+			program:         "LDA #$01\nTAX\nLDA ($10,X)\nBRK",
+			expectRegisterA: uint8(0x07),
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			memory := createTestMemory(t, tt.program)
+			cpu := nes.NewCPU(memory)
+			for addr, value := range tt.memory {
+				memory.Write(addr, value)
+			}
+			cpu.Reset()
+			cpu.Run()
+			assert.Equal(t, tt.expectRegisterA, cpu.State().A)
+		})
+	}
+}
+
+func TestCPULDX(t *testing.T) {
+	cases := []struct {
+		name            string
+		program         string
+		expectRegisterX uint8
+	}{
+		{
+			name:            "LDX Immediate",
+			program:         "LDX #$05\nBRK",
+			expectRegisterX: uint8(0x05),
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			memory := createTestMemory(t, tt.program)
+			cpu := nes.NewCPU(memory)
+			cpu.Reset()
+			cpu.Run()
+			assert.Equal(t, tt.expectRegisterX, cpu.State().X)
+		})
+	}
+}
+
+func TestCPULDY(t *testing.T) {
+	cases := []struct {
+		name            string
+		program         string
+		expectRegisterY uint8
+	}{
+		{
+			name:            "LDY Immediate",
+			program:         "LDY #$05\nBRK",
+			expectRegisterY: uint8(0x05),
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			memory := createTestMemory(t, tt.program)
+			cpu := nes.NewCPU(memory)
+			cpu.Reset()
+			cpu.Run()
+			assert.Equal(t, tt.expectRegisterY, cpu.State().Y)
+		})
+	}
+}
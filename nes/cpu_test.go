@@ -6,6 +6,14 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+func createTestMemoryForCPUTest(program []uint8) *FlatRAM {
+	memory := NewFlatRAM()
+	memory.Load(0x8000, program)
+	memory.Write(0xfffc, 0x00)
+	memory.Write(0xfffd, 0x80)
+	return memory
+}
+
 func createTestCartridgeForCPUTest(program []uint8) *Cartridge {
 	programRom := make([]uint8, 2*PROGRAM_ROM_PAGE_SIZE)
 	copy(programRom, program)
@@ -26,121 +34,6 @@ func createTestCartridgeForCPUTest(program []uint8) *Cartridge {
 	return cartridge
 }
 
-func TestCPULDA(t *testing.T) {
-	cases := []struct {
-		name            string
-		memory          map[uint16]uint8
-		program         []uint8
-		expectRegisterA uint8
-	}{
-		{
-			name:            "LDA Immediate",
-			program:         []uint8{0xa9, 0x05, 0x00},
-			expectRegisterA: uint8(0x05),
-		},
-		{
-			name:            "LDA ZeroPage",
-			memory:          map[uint16]uint8{0x10: 0x05},
-			program:         []uint8{0xa5, 0x10, 0x00},
-			expectRegisterA: uint8(0x05),
-		},
-		{
-			name:            "LDA ZeroPageX",
-			memory:          map[uint16]uint8{0x10: 0x04, 0x11: 0x05},
-			program:         []uint8{0xa9, 0x01, 0xaa, 0xb5, 0x10, 0x00},
-			expectRegisterA: uint8(0x05),
-		},
-		// LDA Absolute
-		{
-			name:            "LDA Absolute",
-			memory:          map[uint16]uint8{0x0010: 0x05},
-			program:         []uint8{0xad, 0x10, 0x00, 0x00},
-			expectRegisterA: uint8(0x05),
-		},
-		// LDA AbsoluteX
-		{
-			name:            "LDA AbsoluteX",
-			memory:          map[uint16]uint8{0x0011: 0x05},
-			program:         []uint8{0xa9, 0x01, 0xaa, 0xbd, 0x10, 0x00, 0x00},
-			expectRegisterA: uint8(0x05),
-		},
-		// LDA IndirectX
-		{
-			name:            "LDA IndirectX",
-			memory:          map[uint16]uint8{0x11: 0x05, 0x12: 0x06, 0x0605: 0x07},
-			program:         []uint8{0xa9, 0x01, 0xaa, 0xa1, 0x10, 0x00},
-			expectRegisterA: uint8(0x07),
-		},
-	}
-
-	for _, tt := range cases {
-		tt := tt
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
-			for addr, value := range tt.memory {
-				cpu.writeMemory(addr, value)
-			}
-			cpu.Reset()
-			cpu.Run()
-			assert.Equal(t, tt.expectRegisterA, cpu.registerA)
-		})
-	}
-}
-
-func TestCPULDX(t *testing.T) {
-	cases := []struct {
-		name            string
-		program         []uint8
-		expectRegisterX uint8
-	}{
-		{
-			name:            "LDX Immediate",
-			program:         []uint8{0xa2, 0x05, 0x00},
-			expectRegisterX: uint8(0x05),
-		},
-	}
-
-	for _, tt := range cases {
-		tt := tt
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
-			cpu.Reset()
-			cpu.Run()
-			assert.Equal(t, tt.expectRegisterX, cpu.registerX)
-		})
-	}
-}
-
-func TestCPULDY(t *testing.T) {
-	cases := []struct {
-		name            string
-		program         []uint8
-		expectRegisterY uint8
-	}{
-		{
-			name:            "LDY Immediate",
-			program:         []uint8{0xa0, 0x05, 0x00},
-			expectRegisterY: uint8(0x05),
-		},
-	}
-
-	for _, tt := range cases {
-		tt := tt
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
-			cpu.Reset()
-			cpu.Run()
-			assert.Equal(t, tt.expectRegisterY, cpu.registerY)
-		})
-	}
-}
-
 func TestCPUSTA(t *testing.T) {
 	cases := []struct {
 		name         string
@@ -185,8 +78,8 @@ func TestCPUSTA(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -217,8 +110,8 @@ func TestCPUSTX(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -249,8 +142,8 @@ func TestCPUSTY(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -264,8 +157,8 @@ func TestCPUSTY(t *testing.T) {
 }
 
 func TestCPUInterpretLDAImmediateLoad(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa9, 0x05, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa9, 0x05, 0x00})
+	cpu := NewCPU(memory)
 	cpu.Reset()
 	cpu.Run()
 	assert.Equal(t, uint8(0x05), cpu.registerA)
@@ -274,32 +167,32 @@ func TestCPUInterpretLDAImmediateLoad(t *testing.T) {
 }
 
 func TestCPUInterpretLDAZeroFlag(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa9, 0x00, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa9, 0x00, 0x00})
+	cpu := NewCPU(memory)
 	cpu.Reset()
 	cpu.Run()
 	assert.True(t, cpu.status&0b0000_0010 == 0b10)
 }
 
 func TestCPUInterpretaTaxMoveAToX(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa9, 0x0a, 0xaa, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa9, 0x0a, 0xaa, 0x00})
+	cpu := NewCPU(memory)
 	cpu.Reset()
 	cpu.Run()
 	assert.Equal(t, uint8(10), cpu.registerX)
 }
 
 func TestCPUInterpretaTaxMoveAToY(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa9, 0x0a, 0xa8, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa9, 0x0a, 0xa8, 0x00})
+	cpu := NewCPU(memory)
 	cpu.Reset()
 	cpu.Run()
 	assert.Equal(t, uint8(10), cpu.registerY)
 }
 
 func TestCPUINC(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xe6, 0x10, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xe6, 0x10, 0x00})
+	cpu := NewCPU(memory)
 	cpu.writeMemory(0x10, 0x05)
 	cpu.Reset()
 	cpu.Run()
@@ -307,48 +200,48 @@ func TestCPUINC(t *testing.T) {
 }
 
 func TestCPUInterpretInx(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa9, 0x02, 0xaa, 0xe8, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa9, 0x02, 0xaa, 0xe8, 0x00})
+	cpu := NewCPU(memory)
 	cpu.Reset()
 	cpu.Run()
 	assert.Equal(t, uint8(3), cpu.registerX)
 }
 
 func TestCPUInterpretInxOverflow(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa9, 0xff, 0xaa, 0xe8, 0xe8, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa9, 0xff, 0xaa, 0xe8, 0xe8, 0x00})
+	cpu := NewCPU(memory)
 	cpu.Reset()
 	cpu.Run()
 	assert.Equal(t, uint8(1), cpu.registerX)
 }
 
 func TestCPUInterpretIny(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa9, 0x02, 0xa8, 0xc8, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa9, 0x02, 0xa8, 0xc8, 0x00})
+	cpu := NewCPU(memory)
 	cpu.Reset()
 	cpu.Run()
 	assert.Equal(t, uint8(3), cpu.registerY)
 }
 
 func TestCPUInterpretInyOverflow(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa9, 0xff, 0xa8, 0xc8, 0xc8, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa9, 0xff, 0xa8, 0xc8, 0xc8, 0x00})
+	cpu := NewCPU(memory)
 	cpu.Reset()
 	cpu.Run()
 	assert.Equal(t, uint8(1), cpu.registerY)
 }
 
 func TestCPUInterpret5OpsWorkingTogether(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa9, 0xc0, 0xaa, 0xe8, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa9, 0xc0, 0xaa, 0xe8, 0x00})
+	cpu := NewCPU(memory)
 	cpu.Reset()
 	cpu.Run()
 	assert.Equal(t, uint8(0xc1), cpu.registerX)
 }
 
 func TestCPUInterpretLDAFromMemory(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa5, 0x10, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa5, 0x10, 0x00})
+	cpu := NewCPU(memory)
 	cpu.writeMemory(0x10, 0x55)
 	cpu.Reset()
 	cpu.Run()
@@ -385,8 +278,8 @@ func TestCPUADC(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectRegisterA, cpu.registerA)
@@ -421,8 +314,8 @@ func TestCPUAND(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectRegisterA, cpu.registerA)
@@ -456,8 +349,8 @@ func TestCPUASLAccumulator(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectRegisterA, cpu.registerA)
@@ -496,8 +389,8 @@ func TestCPUASL(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -538,8 +431,8 @@ func TestCPUBCC(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectPC, cpu.programCounter)
@@ -574,8 +467,8 @@ func TestCPUBCS(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectPC, cpu.programCounter)
@@ -605,8 +498,8 @@ func TestCPUBEQ(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectPC, cpu.programCounter)
@@ -650,8 +543,8 @@ func TestCPUBIT(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -684,8 +577,8 @@ func TestCPUBMI(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectPC, cpu.programCounter)
@@ -715,8 +608,8 @@ func TestCPUBNE(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectPC, cpu.programCounter)
@@ -746,8 +639,8 @@ func TestCPUBPL(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectPC, cpu.programCounter)
@@ -776,8 +669,8 @@ func TestCPUBVC(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectPC, cpu.programCounter)
@@ -806,8 +699,8 @@ func TestCPUBVS(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectPC, cpu.programCounter)
@@ -831,8 +724,8 @@ func TestCPUCLC(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectStatus, cpu.status)
@@ -856,8 +749,8 @@ func TestCPUCLD(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectStatus, cpu.status)
@@ -881,8 +774,8 @@ func TestCPUSEC(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectStatus, cpu.status)
@@ -906,8 +799,8 @@ func TestCPUSED(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectStatus, cpu.status)
@@ -931,8 +824,8 @@ func TestCPUCLI(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectStatus, cpu.status)
@@ -956,8 +849,8 @@ func TestCPUSEI(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectStatus, cpu.status)
@@ -980,8 +873,8 @@ func TestCPUCLV(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectStatus, cpu.status)
@@ -1018,8 +911,8 @@ func TestCPUCMP(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -1059,8 +952,8 @@ func TestCPUCPX(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -1100,8 +993,8 @@ func TestCPUCPY(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -1113,8 +1006,8 @@ func TestCPUCPY(t *testing.T) {
 }
 
 func TestCPUDEC(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xc6, 0x10, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xc6, 0x10, 0x00})
+	cpu := NewCPU(memory)
 	cpu.writeMemory(0x10, 0x05)
 	cpu.Reset()
 	cpu.Run()
@@ -1122,16 +1015,16 @@ func TestCPUDEC(t *testing.T) {
 }
 
 func TestCPUDEX(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa2, 0x10, 0xca, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa2, 0x10, 0xca, 0x00})
+	cpu := NewCPU(memory)
 	cpu.Reset()
 	cpu.Run()
 	assert.Equal(t, uint8(0x0f), cpu.registerX)
 }
 
 func TestCPUDEY(t *testing.T) {
-	bus := NewBus(createTestCartridgeForCPUTest([]uint8{0xa0, 0x10, 0x88, 0x00}), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest([]uint8{0xa0, 0x10, 0x88, 0x00})
+	cpu := NewCPU(memory)
 	cpu.Reset()
 	cpu.Run()
 	assert.Equal(t, uint8(0x0f), cpu.registerY)
@@ -1156,8 +1049,8 @@ func TestCPUEOR(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectRegisterA, cpu.registerA)
@@ -1185,8 +1078,8 @@ func TestCPUORA(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectRegisterA, cpu.registerA)
@@ -1224,8 +1117,8 @@ func TestCPUJMP(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -1255,8 +1148,8 @@ func TestCPUJSR(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -1288,8 +1181,8 @@ func TestCPURTS(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -1325,8 +1218,8 @@ func TestCPULSRAccumulator(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -1364,8 +1257,8 @@ func TestCPULSR(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -1397,8 +1290,8 @@ func TestCPUPHA(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
@@ -1431,8 +1324,8 @@ func TestCPUPLA(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
@@ -1461,8 +1354,8 @@ func TestCPUPHP(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			for addr, value := range tt.expectStack {
@@ -1488,8 +1381,8 @@ func TestCPUPLP(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectStatus, cpu.status)
@@ -1521,8 +1414,8 @@ func TestCPUROLAccumulator(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectRegisterA, cpu.registerA)
@@ -1556,8 +1449,8 @@ func TestCPUROL(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -1596,8 +1489,8 @@ func TestCPURORAccumulator(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			cpu.Reset()
 			cpu.Run()
 			assert.Equal(t, tt.expectRegisterA, cpu.registerA)
@@ -1631,8 +1524,8 @@ func TestCPUROR(t *testing.T) {
 	for _, tt := range cases {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -1648,8 +1541,8 @@ func TestCPUROR(t *testing.T) {
 
 func TestCPURTI(t *testing.T) {
 	program := []uint8{0x40, 0x00}
-	bus := NewBus(createTestCartridgeForCPUTest(program), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest(program)
+	cpu := NewCPU(memory)
 	cpu.writeMemory(0x01fd, 0x80)
 	cpu.writeMemory(0x01fc, 0x11)
 	cpu.writeMemory(0x01fb, 0b1000_0011)
@@ -1700,8 +1593,8 @@ func TestCPUSBC(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			bus := NewBus(createTestCartridgeForCPUTest(tt.program), nil)
-			cpu := NewCPU(bus)
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPU(memory)
 			for addr, value := range tt.memory {
 				cpu.writeMemory(addr, value)
 			}
@@ -1715,8 +1608,8 @@ func TestCPUSBC(t *testing.T) {
 
 func TestCPUTSX(t *testing.T) {
 	program := []uint8{0xba, 0x00}
-	bus := NewBus(createTestCartridgeForCPUTest(program), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest(program)
+	cpu := NewCPU(memory)
 	cpu.stackPointer = 0x05
 	cpu.programCounter = 0x8000
 	cpu.Run()
@@ -1725,8 +1618,8 @@ func TestCPUTSX(t *testing.T) {
 
 func TestCPUTXA(t *testing.T) {
 	program := []uint8{0x8a, 0x00}
-	bus := NewBus(createTestCartridgeForCPUTest(program), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest(program)
+	cpu := NewCPU(memory)
 	cpu.registerX = 0x05
 	cpu.programCounter = 0x8000
 	cpu.Run()
@@ -1735,8 +1628,8 @@ func TestCPUTXA(t *testing.T) {
 
 func TestCPUTXS(t *testing.T) {
 	program := []uint8{0x9a, 0x00}
-	bus := NewBus(createTestCartridgeForCPUTest(program), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest(program)
+	cpu := NewCPU(memory)
 	cpu.registerX = 0x05
 	cpu.programCounter = 0x8000
 	cpu.Run()
@@ -1745,8 +1638,8 @@ func TestCPUTXS(t *testing.T) {
 
 func TestCPUTYA(t *testing.T) {
 	program := []uint8{0x98, 0x00}
-	bus := NewBus(createTestCartridgeForCPUTest(program), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest(program)
+	cpu := NewCPU(memory)
 	cpu.registerY = 0x05
 	cpu.programCounter = 0x8000
 	cpu.Run()
@@ -1755,11 +1648,270 @@ func TestCPUTYA(t *testing.T) {
 
 func TestCPUSAX(t *testing.T) {
 	program := []uint8{0x87, 0x01, 0x00}
-	bus := NewBus(createTestCartridgeForCPUTest(program), nil)
-	cpu := NewCPU(bus)
+	memory := createTestMemoryForCPUTest(program)
+	cpu := NewCPU(memory)
 	cpu.registerX = 0xaa
 	cpu.registerA = 0x8c
 	cpu.programCounter = 0x8000
 	cpu.Run()
 	assert.Equal(t, uint8(0x88), cpu.readMemory(0x01))
 }
+
+func BenchmarkCPUStep(b *testing.B) {
+	// start: LDX #$00
+	// loop:  INX
+	//        LDA $10
+	//        ADC #$01
+	//        STA $0200,X
+	//        BNE loop
+	//        JMP start
+	program := []uint8{0xa2, 0x00, 0xe8, 0xa5, 0x10, 0x69, 0x01, 0x9d, 0x00, 0x02, 0xd0, 0xf6, 0x4c, 0x00, 0x80}
+	memory := createTestMemoryForCPUTest(program)
+	cpu := NewCPU(memory)
+	cpu.Reset()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cpu.Step()
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "instructions/s")
+}
+
+func TestCPUDecimalADCSBC(t *testing.T) {
+	toBCD := func(v int) uint8 {
+		return uint8(v/10<<4 | v%10)
+	}
+
+	for _, variant := range []CPUVariant{CPU_VARIANT_6502, CPU_VARIANT_65C02} {
+		memory := createTestMemoryForCPUTest(nil)
+		cpu := NewCPUWithVariant(memory, variant)
+
+		for a := 0; a < 100; a++ {
+			for b := 0; b < 100; b++ {
+				for carry := 0; carry < 2; carry++ {
+					cpu.writeMemory(0x10, toBCD(b))
+
+					cpu.registerA = toBCD(a)
+					cpu.status = CPU_FLAG_DECIMAL_MODE | uint8(carry)
+					cpu.programCounter = 0x10
+					cpu.adc(CPU_OPS_CODES[0x69])
+					sum := a + b + carry
+					assert.Equal(t, toBCD(sum%100), cpu.registerA, "%d + %d + %d", a, b, carry)
+					assert.Equal(t, sum >= 100, cpu.status&CPU_FLAG_CARRY != 0, "%d + %d + %d", a, b, carry)
+
+					cpu.registerA = toBCD(a)
+					cpu.status = CPU_FLAG_DECIMAL_MODE | uint8(carry)
+					cpu.programCounter = 0x10
+					cpu.sbc(CPU_OPS_CODES[0xe9])
+					diff := a - b - (1 - carry)
+					assert.Equal(t, toBCD((diff+100)%100), cpu.registerA, "%d - %d - %d", a, b, 1-carry)
+					assert.Equal(t, diff >= 0, cpu.status&CPU_FLAG_CARRY != 0, "%d - %d - %d", a, b, 1-carry)
+				}
+			}
+		}
+	}
+}
+
+func TestCPUDecimalFlagIgnoredOn2A03(t *testing.T) {
+	// SED, LDA #$09, CLC, ADC #$01
+	program := []uint8{0xf8, 0xa9, 0x09, 0x18, 0x69, 0x01, 0x00}
+	memory := createTestMemoryForCPUTest(program)
+	cpu := NewCPU(memory)
+	cpu.Reset()
+	cpu.Run()
+	assert.Equal(t, uint8(0x0a), cpu.registerA)
+}
+
+func TestCPU65C02(t *testing.T) {
+	cases := []struct {
+		name            string
+		memory          map[uint16]uint8
+		program         []uint8
+		steps           int
+		expectRegisterA uint8
+		expectPC        uint16
+		expectMemory    map[uint16]uint8
+	}{
+		{
+			name:            "BRA",
+			program:         []uint8{0x80, 0x02, 0xa9, 0x01, 0xa9, 0x02},
+			steps:           2,
+			expectRegisterA: 0x02,
+			expectPC:        0x8006,
+		},
+		{
+			name:         "STZ ZeroPage",
+			memory:       map[uint16]uint8{0x10: 0xff},
+			program:      []uint8{0x64, 0x10},
+			steps:        1,
+			expectPC:     0x8002,
+			expectMemory: map[uint16]uint8{0x10: 0x00},
+		},
+		{
+			name:            "PHX PLA",
+			program:         []uint8{0xa2, 0x42, 0xda, 0x68},
+			steps:           3,
+			expectRegisterA: 0x42,
+			expectPC:        0x8004,
+		},
+		{
+			name:            "LDA (ZeroPage)",
+			memory:          map[uint16]uint8{0x10: 0x00, 0x11: 0x03, 0x0300: 0x55},
+			program:         []uint8{0xb2, 0x10},
+			steps:           1,
+			expectRegisterA: 0x55,
+			expectPC:        0x8002,
+		},
+		{
+			name:            "INC Accumulator",
+			program:         []uint8{0xa9, 0x41, 0x1a},
+			steps:           2,
+			expectRegisterA: 0x42,
+			expectPC:        0x8003,
+		},
+		{
+			name:            "TSB TRB",
+			memory:          map[uint16]uint8{0x10: 0b1010_0000},
+			program:         []uint8{0xa9, 0b0000_0101, 0x04, 0x10, 0xa9, 0b1000_0000, 0x14, 0x10},
+			steps:           4,
+			expectRegisterA: 0b1000_0000,
+			expectPC:        0x8008,
+			expectMemory:    map[uint16]uint8{0x10: 0b0010_0101},
+		},
+		{
+			name:         "RMB3 SMB4",
+			memory:       map[uint16]uint8{0x10: 0b0000_1000},
+			program:      []uint8{0x37, 0x10, 0xc7, 0x10},
+			steps:        2,
+			expectPC:     0x8004,
+			expectMemory: map[uint16]uint8{0x10: 0b0001_0000},
+		},
+		{
+			name:     "BBS4 taken",
+			memory:   map[uint16]uint8{0x10: 0b0001_0000},
+			program:  []uint8{0xcf, 0x10, 0x10},
+			steps:    1,
+			expectPC: 0x8013,
+		},
+		{
+			name:     "BBR4 taken right after the opcode",
+			program:  []uint8{0x4f, 0x10, 0xfe},
+			steps:    1,
+			expectPC: 0x8001,
+		},
+		{
+			name:     "BNE taken to its operand",
+			program:  []uint8{0xa2, 0x01, 0xd0, 0xff},
+			steps:    2,
+			expectPC: 0x8003,
+		},
+		{
+			name:     "BBR4 not taken",
+			memory:   map[uint16]uint8{0x10: 0b0001_0000},
+			program:  []uint8{0x4f, 0x10, 0x10},
+			steps:    1,
+			expectPC: 0x8003,
+		},
+		{
+			name:     "JMP (Absolute,X)",
+			memory:   map[uint16]uint8{0x0302: 0x34, 0x0303: 0x12},
+			program:  []uint8{0xa2, 0x02, 0x7c, 0x00, 0x03},
+			steps:    2,
+			expectPC: 0x1234,
+		},
+		{
+			name:     "JMP Indirect does not wrap page",
+			memory:   map[uint16]uint8{0x02ff: 0x34, 0x0300: 0x12},
+			program:  []uint8{0x6c, 0xff, 0x02},
+			steps:    1,
+			expectPC: 0x1234,
+		},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			memory := createTestMemoryForCPUTest(tt.program)
+			cpu := NewCPUWithVariant(memory, CPU_VARIANT_65C02)
+			for addr, value := range tt.memory {
+				cpu.writeMemory(addr, value)
+			}
+			cpu.Reset()
+			for i := 0; i < tt.steps; i++ {
+				cpu.Step()
+			}
+			assert.Equal(t, tt.expectRegisterA, cpu.registerA)
+			assert.Equal(t, tt.expectPC, cpu.programCounter)
+			for addr, value := range tt.expectMemory {
+				assert.Equal(t, value, cpu.readMemory(addr))
+			}
+		})
+	}
+}
+
+func TestCPU65C02DefinesAllOpcodes(t *testing.T) {
+	for code, inst := range cmosInstructions {
+		assert.NotNil(t, inst.execute, "opcode 0x%02x", code)
+	}
+}
+
+func TestCPUState(t *testing.T) {
+	cpu := NewCPU(createTestMemoryForCPUTest([]uint8{0xe8, 0x00}))
+	state := CPUState{A: 0x01, X: 0x41, Y: 0x03, SP: 0xf0, PC: 0x8000}
+	state.SetFlag(CPU_FLAG_CARRY, true)
+	cpu.SetState(state)
+	cpu.Run()
+
+	got := cpu.State()
+	assert.Equal(t, uint8(0x42), got.X)
+	assert.Equal(t, uint8(0x01), got.A)
+	assert.Equal(t, uint8(0xf0), got.SP)
+	assert.True(t, got.Flag(CPU_FLAG_CARRY))
+	assert.False(t, got.Flag(CPU_FLAG_ZERO))
+	assert.Equal(t, uint16(0x8002), cpu.ProgramCounter())
+}
+
+func TestCPUIllegalOpcode(t *testing.T) {
+	cpu := NewCPU(createTestMemoryForCPUTest([]uint8{0xe8, 0x02}))
+	cpu.Reset()
+	err := cpu.Run()
+
+	var illegal *IllegalOpcodeError
+	assert.ErrorIs(t, err, ErrIllegalOpcode)
+	assert.ErrorAs(t, err, &illegal)
+	assert.Equal(t, uint16(0x8001), illegal.PC)
+	assert.Equal(t, uint8(0x02), illegal.Opcode)
+	assert.Equal(t, uint16(0x8001), cpu.programCounter)
+}
+
+func TestCPUErrorPolicy(t *testing.T) {
+	// LDA #$01, STA $8000, BRK
+	program := []uint8{0xa9, 0x01, 0x8d, 0x00, 0x80, 0x00}
+	cases := []struct {
+		name   string
+		policy ErrorPolicy
+		expect error
+	}{
+		{name: "halt", policy: ERROR_POLICY_HALT, expect: ErrCartridgeROMWrite},
+		{name: "log", policy: ERROR_POLICY_LOG, expect: nil},
+		{name: "ignore", policy: ERROR_POLICY_IGNORE, expect: nil},
+		{name: "zero value", expect: nil},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewBus(createTestCartridgeForCPUTest(program), nil)
+			bus.ErrorPolicy = tt.policy
+			cpu := NewCPU(bus)
+			cpu.Reset()
+			err := cpu.Run()
+			if tt.expect == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package nes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidDebugInfo = errors.New("invalid debug info")
+
+// SourceLocation is a line of an assembly source file, numbered from 1.
+type SourceLocation struct {
+	File string
+	Line int
+}
+
+// DebugSymbol is a symbol exported by ld65 in the debug info.
+type DebugSymbol struct {
+	Name      string
+	Value     uint16
+	Size      int
+	Label     bool // false for constants defined with =
+	ROMOffset int  // offset in PRG-ROM, -1 outside of it
+}
+
+// DebugInfo maps CPU addresses to the source lines they were assembled from.
+// It is read from the debug info written by ld65 with --dbgfile.
+// See https://cc65.github.io/doc/debugging.html
+type DebugInfo struct {
+	Files   []string // source file names as given to ca65
+	Symbols []DebugSymbol
+
+	lines     map[SourceLocation][]uint16 // start addresses of the code on a line
+	locations map[uint16]SourceLocation
+}
+
+type dbgSegment struct {
+	start      uint16
+	fileOffset int // offset in the .nes file, -1 if not written to it
+}
+
+type dbgSpan struct {
+	segment int
+	start   int
+	size    int
+}
+
+type dbgLine struct {
+	file      int
+	line      int
+	spans     []int
+	fromMacro bool
+}
+
+// ReadDebugInfo reads a ca65/ld65 .dbg file.
+func ReadDebugInfo(r io.Reader) (*DebugInfo, error) {
+	files := map[int]string{}
+	segments := map[int]dbgSegment{}
+	spans := map[int]dbgSpan{}
+	var lines []dbgLine
+	var symbols []DebugSymbol
+	symbolSegments := map[int]int{} // index in symbols to segment id
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		kind, rest, _ := strings.Cut(scanner.Text(), "\t")
+		attributes, err := parseDbgAttributes(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidDebugInfo, n, err)
+		}
+		id, _ := attributes.int("id")
+
+		switch kind {
+		case "version":
+			if major, _ := attributes.int("major"); major != 2 {
+				return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidDebugInfo, major)
+			}
+		case "file":
+			files[id] = attributes["name"]
+		case "seg":
+			start, err := attributes.int("start")
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidDebugInfo, n, err)
+			}
+			fileOffset, err := attributes.int("ooffs")
+			if err != nil {
+				fileOffset = -1
+			}
+			segments[id] = dbgSegment{start: uint16(start), fileOffset: fileOffset}
+		case "span":
+			segment, err1 := attributes.int("seg")
+			start, err2 := attributes.int("start")
+			size, err3 := attributes.int("size")
+			if err := errors.Join(err1, err2, err3); err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidDebugInfo, n, err)
+			}
+			spans[id] = dbgSpan{segment: segment, start: start, size: size}
+		case "line":
+			file, err1 := attributes.int("file")
+			line, err2 := attributes.int("line")
+			if err := errors.Join(err1, err2); err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidDebugInfo, n, err)
+			}
+			ids, err := attributes.ints("span")
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidDebugInfo, n, err)
+			}
+			// type 2 lines are inside macro definitions, the invocation line covers the same code
+			lineType, _ := attributes.int("type")
+			lines = append(lines, dbgLine{file: file, line: line, spans: ids, fromMacro: lineType == 2})
+		case "sym":
+			if attributes["type"] == "imp" {
+				continue
+			}
+			value, err := attributes.int("val")
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidDebugInfo, n, err)
+			}
+			size, _ := attributes.int("size")
+			if segment, err := attributes.int("seg"); err == nil {
+				symbolSegments[len(symbols)] = segment
+			}
+			symbols = append(symbols, DebugSymbol{
+				Name:      attributes["name"],
+				Value:     uint16(value),
+				Size:      size,
+				Label:     attributes["type"] == "lab",
+				ROMOffset: -1,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, id := range symbolSegments {
+		segment, ok := segments[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown segment %d", ErrInvalidDebugInfo, id)
+		}
+		// only code and data mapped at $8000-$FFFF come from PRG-ROM, following the 16 bytes iNES header
+		if segment.fileOffset >= 16 && symbols[i].Value >= 0x8000 {
+			symbols[i].ROMOffset = segment.fileOffset - 16 + int(symbols[i].Value-segment.start)
+		}
+	}
+
+	info := &DebugInfo{
+		Symbols:   symbols,
+		lines:     map[SourceLocation][]uint16{},
+		locations: map[uint16]SourceLocation{},
+	}
+	ids := make([]int, 0, len(files))
+	for id := range files {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		info.Files = append(info.Files, files[id])
+	}
+
+	for _, l := range lines {
+		file, ok := files[l.file]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown file %d", ErrInvalidDebugInfo, l.file)
+		}
+		location := SourceLocation{File: file, Line: l.line}
+		for _, id := range l.spans {
+			span, ok := spans[id]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown span %d", ErrInvalidDebugInfo, id)
+			}
+			segment, ok := segments[span.segment]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown segment %d", ErrInvalidDebugInfo, span.segment)
+			}
+			if l.fromMacro || span.size == 0 {
+				continue
+			}
+			start := segment.start + uint16(span.start)
+			info.lines[location] = append(info.lines[location], start)
+			for i := 0; i < span.size; i++ {
+				if _, ok := info.locations[start+uint16(i)]; !ok {
+					info.locations[start+uint16(i)] = location
+				}
+			}
+		}
+	}
+	return info, nil
+}
+
+// Addresses returns the start addresses of the code assembled from a line, none if it has no code.
+func (d *DebugInfo) Addresses(file string, line int) []uint16 {
+	return d.lines[SourceLocation{File: file, Line: line}]
+}
+
+// Location returns the source line the byte at addr was assembled from.
+func (d *DebugInfo) Location(addr uint16) (SourceLocation, bool) {
+	location, ok := d.locations[addr]
+	return location, ok
+}
+
+type dbgAttributes map[string]string
+
+// parseDbgAttributes parses comma separated key=value pairs, values can be quoted.
+func parseDbgAttributes(s string) (dbgAttributes, error) {
+	attributes := dbgAttributes{}
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing value for %q", s)
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string for %s", key)
+			}
+			value = rest[1 : end+1]
+			rest = rest[end+2:]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		attributes[key] = value
+		s = strings.TrimPrefix(rest, ",")
+	}
+	return attributes, nil
+}
+
+func (a dbgAttributes) int(key string) (int, error) {
+	value, ok := a[key]
+	if !ok {
+		return 0, fmt.Errorf("missing %s", key)
+	}
+	n, err := strconv.ParseInt(value, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", key, value)
+	}
+	return int(n), nil
+}
+
+// ints parses "+" separated lists of ids, missing keys are empty lists
+func (a dbgAttributes) ints(key string) ([]int, error) {
+	value, ok := a[key]
+	if !ok {
+		return nil, nil
+	}
+	var ns []int
+	for _, s := range strings.Split(value, "+") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", key, value)
+		}
+		ns = append(ns, n)
+	}
+	return ns, nil
+}
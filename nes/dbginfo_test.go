@@ -0,0 +1,99 @@
+package nes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testDebugInfo is the debug info of
+//
+//	1 .macro bump
+//	2   inc $10
+//	3 .endmacro
+//	4 counter = $10
+//	5 reset:
+//	6   lda #$01
+//	7 loop:
+//	8   bump
+//	9   jmp loop
+const testDebugInfo = `version	major=2,minor=0
+info	csym=0,file=1,lib=0,line=6,mod=1,scope=1,seg=1,span=3,sym=3,type=0
+file	id=0,name="src/main.s",size=120,mtime=0x65A1B2C3,mod=0
+line	id=0,file=0,line=6,span=0
+line	id=1,file=0,line=8,span=1
+line	id=2,file=0,line=2,type=2,span=1
+line	id=3,file=0,line=9,span=2
+line	id=4,file=0,line=5
+line	id=5,file=0,line=7
+mod	id=0,name="main.o",file=0
+seg	id=0,name="CODE",start=0x008000,size=0x0007,addrsize=absolute,type=ro,oname="main.nes",ooffs=16
+span	id=0,seg=0,start=0,size=2
+span	id=1,seg=0,start=2,size=2
+span	id=2,seg=0,start=4,size=3
+scope	id=0,name="",mod=0,size=7,span=0+1+2
+sym	id=0,name="reset",addrsize=absolute,scope=0,def=4,val=0x8000,seg=0,type=lab
+sym	id=1,name="loop",addrsize=absolute,scope=0,def=5,ref=3,val=0x8002,seg=0,type=lab
+sym	id=2,name="counter",addrsize=zeropage,scope=0,def=1,val=0x10,type=equ
+sym	id=3,name="print",addrsize=absolute,scope=0,exp=4,type=imp
+`
+
+func TestReadDebugInfo(t *testing.T) {
+	info, err := ReadDebugInfo(strings.NewReader(testDebugInfo))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"src/main.s"}, info.Files)
+	assert.Equal(t, []DebugSymbol{
+		{Name: "reset", Value: 0x8000, Label: true, ROMOffset: 0},
+		{Name: "loop", Value: 0x8002, Label: true, ROMOffset: 2},
+		{Name: "counter", Value: 0x10, ROMOffset: -1},
+	}, info.Symbols)
+
+	assert.Equal(t, []uint16{0x8000}, info.Addresses("src/main.s", 6))
+	assert.Equal(t, []uint16{0x8002}, info.Addresses("src/main.s", 8))
+	assert.Equal(t, []uint16{0x8004}, info.Addresses("src/main.s", 9))
+	assert.Empty(t, info.Addresses("src/main.s", 7))
+	// lines inside macro definitions are reported at the invocation
+	assert.Empty(t, info.Addresses("src/main.s", 2))
+
+	tests := []struct {
+		addr     uint16
+		expected SourceLocation
+		ok       bool
+	}{
+		{0x8000, SourceLocation{"src/main.s", 6}, true},
+		{0x8001, SourceLocation{"src/main.s", 6}, true},
+		{0x8003, SourceLocation{"src/main.s", 8}, true},
+		{0x8006, SourceLocation{"src/main.s", 9}, true},
+		{0x8007, SourceLocation{}, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("$%04X", tt.addr), func(t *testing.T) {
+			location, ok := info.Location(tt.addr)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, location)
+		})
+	}
+}
+
+func TestReadDebugInfoErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"version", "version\tmajor=3,minor=0\n"},
+		{"unterminated string", "file\tid=0,name=\"main.s\n"},
+		{"missing attribute", "span\tid=0,seg=0,size=2\n"},
+		{"unknown span", "file\tid=0,name=\"main.s\"\nline\tid=0,file=0,line=1,span=3\n"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadDebugInfo(strings.NewReader(tt.input))
+			assert.ErrorIs(t, err, ErrInvalidDebugInfo)
+		})
+	}
+}
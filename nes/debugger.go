@@ -0,0 +1,429 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrDebugStop         = errors.New("stopped by debugger")
+	ErrNoCaller          = errors.New("not in a subroutine")
+	ErrNoBreakpoint      = errors.New("no such breakpoint")
+	ErrInvalidBreakpoint = errors.New("invalid breakpoint")
+)
+
+type AddressSpace int
+
+const (
+	SPACE_CPU AddressSpace = iota
+	SPACE_PPU
+)
+
+type BreakpointKind uint8
+
+const (
+	BREAK_EXECUTE BreakpointKind = 1 << iota
+	BREAK_READ
+	BREAK_WRITE
+	BREAK_ACCESS = BREAK_READ | BREAK_WRITE
+)
+
+// Breakpoint stops the execution when an address in Start-End is executed, read or written.
+// Read and write watchpoints stop after the instruction doing the access.
+// Opcode and operand fetches don't count as reads.
+type Breakpoint struct {
+	ID        int
+	Kind      BreakpointKind
+	Space     AddressSpace
+	Start     uint16
+	End       uint16      // inclusive
+	Condition *Expression // stops only when true, nil always stops
+	Enabled   bool
+	Symbol    string // label of Start, if any
+}
+
+func (b *Breakpoint) String() string {
+	kinds := map[BreakpointKind]string{
+		BREAK_EXECUTE: "exec",
+		BREAK_READ:    "read",
+		BREAK_WRITE:   "write",
+		BREAK_ACCESS:  "access",
+	}
+	space := "cpu"
+	if b.Space == SPACE_PPU {
+		space = "ppu"
+	}
+	s := fmt.Sprintf("#%d %s %s $%04X", b.ID, kinds[b.Kind], space, b.Start)
+	if b.End != b.Start {
+		s += fmt.Sprintf("-$%04X", b.End)
+	}
+	if b.Symbol != "" {
+		s += " (" + b.Symbol + ")"
+	}
+	if b.Condition != nil {
+		s += " if " + b.Condition.Source
+	}
+	if !b.Enabled {
+		s += " (disabled)"
+	}
+	return s
+}
+
+func (b *Breakpoint) matches(kind BreakpointKind, space AddressSpace, addr uint16) bool {
+	return b.Enabled && b.Kind&kind != 0 && b.Space == space && addr >= b.Start && addr <= b.End
+}
+
+type StopReason int
+
+const (
+	STOP_BREAKPOINT StopReason = iota
+	STOP_STEP
+	STOP_SCANLINE
+)
+
+// DebugStop is returned by Console.StepInstruction and StepFrame when the debugger stops.
+type DebugStop struct {
+	Reason     StopReason
+	Breakpoint *Breakpoint // for STOP_BREAKPOINT
+	PC         uint16      // next instruction
+	Addr       uint16      // accessed address, for watchpoints
+	Value      uint8
+	Write      bool
+}
+
+func (s *DebugStop) Error() string {
+	switch {
+	case s.Reason == STOP_STEP:
+		return fmt.Sprintf("step at $%04X", s.PC)
+	case s.Reason == STOP_SCANLINE:
+		return fmt.Sprintf("scanline reached at $%04X", s.PC)
+	case s.Breakpoint.Kind == BREAK_EXECUTE:
+		return fmt.Sprintf("breakpoint %s at $%04X", s.Breakpoint, s.PC)
+	case s.Write:
+		return fmt.Sprintf("breakpoint %s: wrote $%02X to $%04X, at $%04X", s.Breakpoint, s.Value, s.Addr, s.PC)
+	}
+	return fmt.Sprintf("breakpoint %s: read $%02X from $%04X, at $%04X", s.Breakpoint, s.Value, s.Addr, s.PC)
+}
+
+func (s *DebugStop) Is(target error) bool {
+	return target == ErrDebugStop
+}
+
+type CallKind int
+
+const (
+	CALL_JSR CallKind = iota
+	CALL_NMI
+	CALL_BRK
+)
+
+// CallFrame is a subroutine or interrupt handler being executed.
+type CallFrame struct {
+	Kind   CallKind
+	Caller uint16 // the JSR, BRK or interrupted instruction
+	Target uint16
+	SP     uint8 // stack pointer before the call, the frame is left when it goes back up to it
+}
+
+// accessHook is notified of the memory accesses done by the emulation, not of peeks.
+type accessHook interface {
+	onAccess(space AddressSpace, addr uint16, value uint8, write bool)
+}
+
+// Debugger stops the console on breakpoints and steps through the program.
+// Stops are reported as a *DebugStop error by Console.StepInstruction and StepFrame;
+// call one of the resume methods before stepping again.
+type Debugger struct {
+	console     *Console
+	breakpoints []*Breakpoint
+	nextID      int
+	callStack   []CallFrame
+
+	stop func() *DebugStop // checked after each instruction
+	skip bool              // don't break on the next instruction, which was stopped at
+	hit  *DebugStop        // watchpoint hit by the current instruction
+
+	callTracker // the instruction being executed
+}
+
+// accessHooks notifies several hooks of the same accesses.
+type accessHooks []accessHook
+
+func (h accessHooks) onAccess(space AddressSpace, addr uint16, value uint8, write bool) {
+	for _, hook := range h {
+		hook.onAccess(space, addr, value, write)
+	}
+}
+
+// attachHooks hooks the debugger and the code/data logger to the bus and PPU, which are recreated by a power cycle.
+func (c *Console) attachHooks() {
+	var hooks accessHooks
+	if c.debugger != nil {
+		hooks = append(hooks, c.debugger)
+	}
+	if c.cdl != nil {
+		hooks = append(hooks, c.cdl)
+	}
+	switch len(hooks) {
+	case 0:
+		c.Bus.hook = nil
+	case 1:
+		c.Bus.hook = hooks[0]
+	default:
+		c.Bus.hook = hooks
+	}
+	c.Bus.PPU.hook = c.Bus.hook
+	c.Bus.PPU.cdl = c.cdl
+}
+
+// AttachDebugger returns the debugger of the console, attaching one if needed.
+func (c *Console) AttachDebugger() *Debugger {
+	if c.debugger == nil {
+		c.debugger = &Debugger{console: c, nextID: 1}
+		c.attachHooks()
+	}
+	return c.debugger
+}
+
+func (c *Console) DetachDebugger() {
+	if c.debugger == nil {
+		return
+	}
+	c.debugger = nil
+	c.attachHooks()
+}
+
+// reset forgets the call stack after a power cycle.
+func (d *Debugger) reset() {
+	d.callStack = nil
+}
+
+// AddBreakpoint adds a breakpoint on start-end with an optional condition, see ParseExpression.
+func (d *Debugger) AddBreakpoint(kind BreakpointKind, space AddressSpace, start, end uint16, condition string) (*Breakpoint, error) {
+	if end < start {
+		return nil, fmt.Errorf("%w: $%04X-$%04X is empty", ErrInvalidBreakpoint, start, end)
+	}
+	if kind == BREAK_EXECUTE && space != SPACE_CPU {
+		return nil, fmt.Errorf("%w: only CPU addresses can be executed", ErrInvalidBreakpoint)
+	}
+
+	bp := &Breakpoint{ID: d.nextID, Kind: kind, Space: space, Start: start, End: end, Enabled: true}
+	if space == SPACE_CPU {
+		bp.Symbol, _ = d.console.Bus.SymbolName(start)
+	}
+	if condition != "" {
+		expr, err := ParseExpression(condition)
+		if err != nil {
+			return nil, err
+		}
+		bp.Condition = expr
+	}
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, bp)
+	return bp, nil
+}
+
+// AddBreakpointAtSymbol adds a breakpoint on a label such as "main" or "buffer+2", see Bus.SymbolAddress.
+// Watchpoints cover all the bytes of sized labels.
+func (d *Debugger) AddBreakpointAtSymbol(kind BreakpointKind, name string, condition string) (*Breakpoint, error) {
+	start, err := d.console.Bus.SymbolAddress(name)
+	if err != nil {
+		return nil, err
+	}
+	end := start
+	if s, ok := d.console.Symbols.Lookup(name); ok && kind != BREAK_EXECUTE && s.Size > 1 {
+		end = start + uint16(s.Size-1)
+	}
+	return d.AddBreakpoint(kind, SPACE_CPU, start, end, condition)
+}
+
+func (d *Debugger) RemoveBreakpoint(id int) error {
+	for i, bp := range d.breakpoints {
+		if bp.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: #%d", ErrNoBreakpoint, id)
+}
+
+func (d *Debugger) Breakpoint(id int) (*Breakpoint, error) {
+	for _, bp := range d.breakpoints {
+		if bp.ID == id {
+			return bp, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: #%d", ErrNoBreakpoint, id)
+}
+
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	return d.breakpoints
+}
+
+// CallStack returns the active calls, the innermost last.
+func (d *Debugger) CallStack() []CallFrame {
+	return append([]CallFrame{}, d.callStack...)
+}
+
+// Continue resumes until the next breakpoint.
+func (d *Debugger) Continue() {
+	d.skip = true
+	d.stop = nil
+}
+
+// StepInto stops after the next instruction.
+func (d *Debugger) StepInto() {
+	d.skip = true
+	d.stop = func() *DebugStop {
+		return d.stopped(STOP_STEP)
+	}
+}
+
+// StepOver stops after the next instruction, running whole subroutines and interrupt handlers it enters.
+func (d *Debugger) StepOver() {
+	depth := len(d.callStack)
+	d.skip = true
+	d.stop = func() *DebugStop {
+		if len(d.callStack) > depth {
+			return nil
+		}
+		return d.stopped(STOP_STEP)
+	}
+}
+
+// StepOut stops when the current subroutine or interrupt handler returns.
+func (d *Debugger) StepOut() error {
+	depth := len(d.callStack)
+	if depth == 0 {
+		return ErrNoCaller
+	}
+	d.skip = true
+	d.stop = func() *DebugStop {
+		if len(d.callStack) >= depth {
+			return nil
+		}
+		return d.stopped(STOP_STEP)
+	}
+	return nil
+}
+
+// RunToScanline stops when the PPU starts the scanline.
+func (d *Debugger) RunToScanline(scanline uint16) {
+	last := d.console.Bus.PPU.Scanline
+	d.skip = true
+	d.stop = func() *DebugStop {
+		current := d.console.Bus.PPU.Scanline
+		reached := current == scanline && last != scanline
+		last = current
+		if !reached {
+			return nil
+		}
+		return d.stopped(STOP_SCANLINE)
+	}
+}
+
+// Run executes until the debugger stops or maxFrames frames have been completed, then returns the stop if any.
+func (d *Debugger) Run(maxFrames int) (*DebugStop, error) {
+	for frames := 0; frames < maxFrames; {
+		done, err := d.console.stepFrameInstruction()
+		var stop *DebugStop
+		if errors.As(err, &stop) {
+			return stop, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			frames++
+		}
+	}
+	return nil, nil
+}
+
+func (d *Debugger) stopped(reason StopReason) *DebugStop {
+	return &DebugStop{Reason: reason, PC: d.console.CPU.programCounter}
+}
+
+func (d *Debugger) env(addr uint16, value uint8) *exprEnv {
+	return &exprEnv{console: d.console, addr: addr, value: value}
+}
+
+func (d *Debugger) beforeInstruction() error {
+	if d.console.replaying {
+		return nil
+	}
+	d.before(d.console)
+
+	if d.skip {
+		d.skip = false
+		return nil
+	}
+	for _, bp := range d.breakpoints {
+		if !bp.matches(BREAK_EXECUTE, SPACE_CPU, d.pc) {
+			continue
+		}
+		if bp.Condition == nil || bp.Condition.Eval(d.env(d.pc, d.opcode)) {
+			// the next attempt runs the instruction instead of stopping again
+			d.skip = true
+			return &DebugStop{Reason: STOP_BREAKPOINT, Breakpoint: bp, PC: d.pc}
+		}
+	}
+	return nil
+}
+
+func (d *Debugger) afterInstruction() error {
+	if d.console.replaying {
+		return nil
+	}
+	cpu := d.console.CPU
+
+	interrupt, call := d.calls(cpu)
+	if interrupt != nil {
+		d.callStack = append(d.callStack, *interrupt)
+	}
+	if call != nil {
+		d.callStack = append(d.callStack, *call)
+	}
+	for len(d.callStack) > 0 && returned(cpu, d.callStack[len(d.callStack)-1]) {
+		d.callStack = d.callStack[:len(d.callStack)-1]
+	}
+
+	if d.hit != nil {
+		hit := d.hit
+		d.hit = nil
+		hit.PC = cpu.programCounter
+		d.skip = true
+		return hit
+	}
+	if d.stop != nil {
+		if stop := d.stop(); stop != nil {
+			d.stop = nil
+			d.skip = true
+			return stop
+		}
+	}
+	return nil
+}
+
+func (d *Debugger) onAccess(space AddressSpace, addr uint16, value uint8, write bool) {
+	if d.console.replaying || d.hit != nil {
+		return
+	}
+	if space == SPACE_CPU && !write && addr-d.pc < d.length {
+		// opcode and operand fetches
+		return
+	}
+	kind := BREAK_READ
+	if write {
+		kind = BREAK_WRITE
+	}
+	for _, bp := range d.breakpoints {
+		if !bp.matches(kind, space, addr) {
+			continue
+		}
+		if bp.Condition == nil || bp.Condition.Eval(d.env(addr, value)) {
+			d.hit = &DebugStop{Reason: STOP_BREAKPOINT, Breakpoint: bp, Addr: addr, Value: value, Write: write}
+			return
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestConsoleForDebuggerTest(t *testing.T) *Console {
+	program := make([]uint8, 0x40)
+	copy(program[0x00:], []uint8{
+		0xa9, 0x80, // LDA #$80
+		0x8d, 0x00, 0x20, // STA $2000
+		0x20, 0x10, 0x80, // loop: JSR $8010
+		0xe6, 0x10, // INC $10
+		0x4c, 0x05, 0x80, // JMP loop
+	})
+	copy(program[0x10:], []uint8{
+		0xad, 0x00, 0x03, // LDA $0300
+		0x8d, 0x01, 0x03, // STA $0301
+		0x20, 0x20, 0x80, // JSR $8020
+		0x60, // RTS
+	})
+	copy(program[0x20:], []uint8{
+		0xe8, // INX
+		0x60, // RTS
+	})
+	copy(program[0x30:], []uint8{
+		0xe6, 0x11, // nmi: INC $11
+		0x40, // RTI
+	})
+	rom := createTestROMForConsoleTest(program)
+	rom[16+0x7ffa] = 0x30
+	rom[16+0x7ffb] = 0x80
+
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(rom))
+	return console
+}
+
+func TestDebuggerBreakpoint(t *testing.T) {
+	console := createTestConsoleForDebuggerTest(t)
+	d := console.AttachDebugger()
+	bp, err := d.AddBreakpoint(BREAK_EXECUTE, SPACE_CPU, 0x8010, 0x8010, "")
+	assert.NoError(t, err)
+
+	err = console.StepFrame()
+	var stop *DebugStop
+	assert.ErrorIs(t, err, ErrDebugStop)
+	assert.ErrorAs(t, err, &stop)
+	assert.Equal(t, STOP_BREAKPOINT, stop.Reason)
+	assert.Equal(t, bp, stop.Breakpoint)
+	assert.Equal(t, uint16(0x8010), stop.PC)
+	assert.Equal(t, uint16(0x8010), console.CPU.programCounter)
+	assert.Equal(t, []CallFrame{{Kind: CALL_JSR, Caller: 0x8005, Target: 0x8010, SP: 0xfd}}, d.CallStack())
+
+	// the next loop stops again
+	d.Continue()
+	stop, err = d.Run(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x8010), stop.PC)
+	assert.Equal(t, uint8(1), console.Bus.CpuVRAM[0x10])
+	assert.Len(t, d.CallStack(), 1)
+
+	// frames in progress are finished by StepFrame
+	assert.NoError(t, d.RemoveBreakpoint(bp.ID))
+	d.Continue()
+	assert.NoError(t, console.StepFrame())
+	assert.Equal(t, uint(1), console.FrameCount)
+	assert.ErrorIs(t, d.RemoveBreakpoint(bp.ID), ErrNoBreakpoint)
+}
+
+func TestDebuggerConditionalBreakpoint(t *testing.T) {
+	console := createTestConsoleForDebuggerTest(t)
+	d := console.AttachDebugger()
+	_, err := d.AddBreakpoint(BREAK_EXECUTE, SPACE_CPU, 0x8020, 0x8021, "x == 3 && pc == $8020")
+	assert.NoError(t, err)
+
+	stop, err := d.Run(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x8020), stop.PC)
+	assert.Equal(t, uint8(3), console.CPU.registerX)
+	assert.Equal(t, []CallFrame{
+		{Kind: CALL_JSR, Caller: 0x8005, Target: 0x8010, SP: 0xfd},
+		{Kind: CALL_JSR, Caller: 0x8016, Target: 0x8020, SP: 0xfb},
+	}, d.CallStack())
+}
+
+func TestDebuggerStep(t *testing.T) {
+	console := createTestConsoleForDebuggerTest(t)
+	d := console.AttachDebugger()
+	_, err := d.AddBreakpoint(BREAK_EXECUTE, SPACE_CPU, 0x8016, 0x8016, "")
+	assert.NoError(t, err)
+	stop, err := d.Run(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x8016), stop.PC)
+
+	d.StepInto()
+	stop, err = d.Run(1)
+	assert.NoError(t, err)
+	assert.Equal(t, STOP_STEP, stop.Reason)
+	assert.Equal(t, uint16(0x8020), stop.PC)
+	assert.Len(t, d.CallStack(), 2)
+
+	assert.NoError(t, d.StepOut())
+	stop, _ = d.Run(1)
+	assert.Equal(t, uint16(0x8019), stop.PC)
+	assert.Len(t, d.CallStack(), 1)
+
+	assert.NoError(t, d.StepOut())
+	stop, _ = d.Run(1)
+	assert.Equal(t, uint16(0x8008), stop.PC)
+	assert.Empty(t, d.CallStack())
+	assert.ErrorIs(t, d.StepOut(), ErrNoCaller)
+
+	// JMP, then step over the whole subroutine
+	assert.NoError(t, d.RemoveBreakpoint(1))
+	d.StepOver()
+	d.Run(1)
+	d.StepOver()
+	d.Run(1)
+	assert.Equal(t, uint16(0x8005), console.CPU.programCounter)
+	x := console.CPU.registerX
+	d.StepOver()
+	stop, _ = d.Run(1)
+	assert.Equal(t, uint16(0x8008), stop.PC)
+	assert.Equal(t, x+1, console.CPU.registerX)
+}
+
+func TestDebuggerWatchpoints(t *testing.T) {
+	console := createTestConsoleForDebuggerTest(t)
+	d := console.AttachDebugger()
+	// operand fetches of LDA $0300 don't count as reads of $8011
+	_, err := d.AddBreakpoint(BREAK_READ, SPACE_CPU, 0x8011, 0x8011, "")
+	assert.NoError(t, err)
+	read, err := d.AddBreakpoint(BREAK_READ, SPACE_CPU, 0x0300, 0x0300, "")
+	assert.NoError(t, err)
+	write, err := d.AddBreakpoint(BREAK_WRITE, SPACE_CPU, 0x0301, 0x0301, "value == $42")
+	assert.NoError(t, err)
+
+	stop, err := d.Run(1)
+	assert.NoError(t, err)
+	assert.Equal(t, read, stop.Breakpoint)
+	assert.Equal(t, uint16(0x0300), stop.Addr)
+	assert.False(t, stop.Write)
+	assert.Equal(t, uint16(0x8013), stop.PC)
+
+	// the write of 0 doesn't match the condition
+	read.Enabled = false
+	console.Bus.CpuVRAM[0x0300] = 0x42
+	d.Continue()
+	stop, err = d.Run(1)
+	assert.NoError(t, err)
+	assert.Equal(t, write, stop.Breakpoint)
+	assert.True(t, stop.Write)
+	assert.Equal(t, uint8(0x42), stop.Value)
+	assert.Equal(t, uint16(0x8016), stop.PC)
+	assert.Equal(t, uint8(1), console.Bus.CpuVRAM[0x10])
+}
+
+func TestDebuggerPPUWatchpoint(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest([]uint8{
+		0xa9, 0x21, 0x8d, 0x06, 0x20, // LDA #$21, STA $2006
+		0xa9, 0x08, 0x8d, 0x06, 0x20, // LDA #$08, STA $2006
+		0xa9, 0xab, 0x8d, 0x07, 0x20, // LDA #$AB, STA $2007
+		0x4c, 0x0f, 0x80,
+	})))
+	d := console.AttachDebugger()
+	_, err := d.AddBreakpoint(BREAK_ACCESS, SPACE_PPU, 0x2000, 0x23ff, "")
+	assert.NoError(t, err)
+	_, err = d.AddBreakpoint(BREAK_EXECUTE, SPACE_PPU, 0x2000, 0x23ff, "")
+	assert.ErrorIs(t, err, ErrInvalidBreakpoint)
+
+	stop, err := d.Run(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x2108), stop.Addr)
+	assert.Equal(t, uint8(0xab), stop.Value)
+	assert.True(t, stop.Write)
+}
+
+func TestDebuggerNMICallStack(t *testing.T) {
+	console := createTestConsoleForDebuggerTest(t)
+	d := console.AttachDebugger()
+	_, err := d.AddBreakpoint(BREAK_EXECUTE, SPACE_CPU, 0x8030, 0x8030, "")
+	assert.NoError(t, err)
+	stop, err := d.Run(2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x8030), stop.PC)
+
+	d.StepInto()
+	d.Run(1)
+	stack := d.CallStack()
+	assert.NotEmpty(t, stack)
+	assert.Equal(t, CALL_NMI, stack[len(stack)-1].Kind)
+	assert.Equal(t, uint16(0x8030), stack[len(stack)-1].Target)
+
+	d.StepOver()
+	d.Run(1)
+	assert.Len(t, d.CallStack(), len(stack)-1)
+}
+
+func TestDebuggerRunToScanline(t *testing.T) {
+	console := createTestConsoleForDebuggerTest(t)
+	d := console.AttachDebugger()
+	d.RunToScanline(100)
+	stop, err := d.Run(1)
+	assert.NoError(t, err)
+	assert.Equal(t, STOP_SCANLINE, stop.Reason)
+	assert.Equal(t, uint16(100), console.Bus.PPU.Scanline)
+}
+
+func TestDebuggerSurvivesPowerCycle(t *testing.T) {
+	console := createTestConsoleForDebuggerTest(t)
+	d := console.AttachDebugger()
+	_, err := d.AddBreakpoint(BREAK_READ, SPACE_CPU, 0x0300, 0x0300, "")
+	assert.NoError(t, err)
+	assert.NoError(t, console.HardReset())
+	stop, err := d.Run(1)
+	assert.NoError(t, err)
+	assert.NotNil(t, stop)
+
+	console.DetachDebugger()
+	assert.NoError(t, console.StepFrame())
+}
+
+func TestDebuggerStopAtVblankEndsFrame(t *testing.T) {
+	reference := createTestConsoleForDebuggerTest(t)
+	assert.NoError(t, reference.StepFrame())
+
+	console := createTestConsoleForDebuggerTest(t)
+	d := console.AttachDebugger()
+	d.RunToScanline(241)
+	err := console.StepFrame()
+	assert.ErrorIs(t, err, ErrDebugStop)
+	assert.Equal(t, uint(1), console.FrameCount)
+	assert.Equal(t, reference.CPU.State(), console.CPU.State())
+	assert.Equal(t, reference.FrameHash(), console.FrameHash())
+}
@@ -0,0 +1,96 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+var (
+	ErrInvalidROM           = errors.New("invalid ROM file")
+	ErrNoROM                = errors.New("no ROM loaded")
+	ErrIllegalOpcode        = errors.New("illegal opcode")
+	ErrTruncatedInstruction = errors.New("truncated instruction")
+	ErrBreak                = errors.New("BRK instruction")
+	ErrCartridgeROMWrite    = errors.New("attempt to write to cartridge ROM space")
+	ErrCharacterROMWrite    = errors.New("attempt to write to character ROM space")
+	ErrUnusedPPUAddress     = errors.New("access to unused PPU address space")
+	ErrUnsupportedMirroring = errors.New("unsupported mirroring type")
+)
+
+// IllegalOpcodeError is returned by CPU.Step when the fetched opcode is not implemented.
+type IllegalOpcodeError struct {
+	PC     uint16
+	Opcode uint8
+}
+
+func (e *IllegalOpcodeError) Error() string {
+	return fmt.Sprintf("illegal opcode $%02X at $%04X", e.Opcode, e.PC)
+}
+
+func (e *IllegalOpcodeError) Is(target error) bool {
+	return target == ErrIllegalOpcode
+}
+
+// AccessError describes a memory access which real hardware silently tolerates
+// but usually indicates a bug in the ROM or in the emulator.
+type AccessError struct {
+	Addr  uint16
+	Write bool
+	Err   error
+}
+
+func (e *AccessError) Error() string {
+	op := "read"
+	if e.Write {
+		op = "write"
+	}
+	return fmt.Sprintf("%s $%04X: %v", op, e.Addr, e.Err)
+}
+
+func (e *AccessError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorPolicy decides what happens on hardware-benign errors such as AccessError.
+// In every case the access itself behaves as it does on real hardware.
+// The zero value logs them, so games relying on such accesses keep running.
+type ErrorPolicy uint8
+
+const (
+	ERROR_POLICY_LOG    ErrorPolicy = iota // the error is logged and emulation continues
+	ERROR_POLICY_HALT                      // CPU.Step returns the error
+	ERROR_POLICY_IGNORE                    // the error is dropped
+)
+
+// faultLatch keeps the first error raised since it was last taken.
+type faultLatch struct {
+	err error
+}
+
+func (f *faultLatch) fault(err error) {
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+func (f *faultLatch) take() error {
+	err := f.err
+	f.err = nil
+	return err
+}
+
+func applyErrorPolicy(policy ErrorPolicy, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch policy {
+	case ERROR_POLICY_LOG:
+		slog.Warn(err.Error())
+		return nil
+	case ERROR_POLICY_IGNORE:
+		return nil
+	default:
+		return err
+	}
+}
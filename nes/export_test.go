@@ -0,0 +1,7 @@
+package nes
+
+// the helpers of the tests in package nes_test, which can use the assembler
+var (
+	CreateTestROMForConsoleTest      = createTestROMForConsoleTest
+	CreateTestConsoleForDebuggerTest = createTestConsoleForDebuggerTest
+)
@@ -0,0 +1,237 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidExpression = errors.New("invalid expression")
+
+// Expression is a compiled debugger condition such as "a == $10 && [$0300] > 5".
+//
+// Operands are numbers ($hex, 0xhex, %binary or decimal), registers (a, x, y, p, sp, pc),
+// flags (c, z, i, d, v, n), scanline, dot, frame, and for watchpoints the accessed addr and value.
+// [expr] reads the byte at a CPU address without side effects.
+// Operators follow C: ! ~ - (unary), + -, &, ^, |, comparisons, && and ||.
+type Expression struct {
+	Source string
+	eval   func(env *exprEnv) int
+}
+
+type exprEnv struct {
+	console *Console
+	addr    uint16
+	value   uint8
+}
+
+// Eval returns true if the expression is not zero.
+func (e *Expression) Eval(env *exprEnv) bool {
+	return e.eval(env) != 0
+}
+
+// Value evaluates the expression on the current state of console, addr and value being 0.
+func (e *Expression) Value(console *Console) int {
+	return e.eval(&exprEnv{console: console})
+}
+
+func ParseExpression(source string) (*Expression, error) {
+	p := &exprParser{source: source}
+	p.next()
+	eval, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "" {
+		return nil, p.errorf("unexpected %q", p.token)
+	}
+	return &Expression{Source: source, eval: eval}, nil
+}
+
+type exprParser struct {
+	source string
+	pos    int
+	token  string
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %q: %s", ErrInvalidExpression, p.source, fmt.Sprintf(format, args...))
+}
+
+// next reads the following token into p.token, "" at the end.
+func (p *exprParser) next() {
+	for p.pos < len(p.source) && p.source[p.pos] == ' ' {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.source) {
+		p.token = ""
+		return
+	}
+
+	c := rune(p.source[p.pos])
+	switch {
+	case c == '$' || c == '%' || unicode.IsLetter(c) || unicode.IsDigit(c):
+		p.pos++
+		for p.pos < len(p.source) {
+			c := rune(p.source[p.pos])
+			if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				break
+			}
+			p.pos++
+		}
+	default:
+		p.pos++
+		for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||"} {
+			if strings.HasPrefix(p.source[start:], op) {
+				p.pos = start + 2
+				break
+			}
+		}
+	}
+	p.token = p.source[start:p.pos]
+}
+
+type binaryOperator struct {
+	precedence int
+	apply      func(a, b int) int
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var binaryOperators = map[string]binaryOperator{
+	"||": {1, func(a, b int) int { return boolToInt(a != 0 || b != 0) }},
+	"&&": {2, func(a, b int) int { return boolToInt(a != 0 && b != 0) }},
+	"==": {3, func(a, b int) int { return boolToInt(a == b) }},
+	"!=": {3, func(a, b int) int { return boolToInt(a != b) }},
+	"<":  {3, func(a, b int) int { return boolToInt(a < b) }},
+	"<=": {3, func(a, b int) int { return boolToInt(a <= b) }},
+	">":  {3, func(a, b int) int { return boolToInt(a > b) }},
+	">=": {3, func(a, b int) int { return boolToInt(a >= b) }},
+	"|":  {4, func(a, b int) int { return a | b }},
+	"^":  {5, func(a, b int) int { return a ^ b }},
+	"&":  {6, func(a, b int) int { return a & b }},
+	"+":  {7, func(a, b int) int { return a + b }},
+	"-":  {7, func(a, b int) int { return a - b }},
+}
+
+// parseBinary parses operators binding tighter than minPrecedence by precedence climbing.
+func (p *exprParser) parseBinary(minPrecedence int) (func(*exprEnv) int, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := binaryOperators[p.token]
+		if !ok || op.precedence <= minPrecedence {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(op.precedence)
+		if err != nil {
+			return nil, err
+		}
+		l, apply := left, op.apply
+		left = func(env *exprEnv) int { return apply(l(env), right(env)) }
+	}
+}
+
+func (p *exprParser) parseUnary() (func(*exprEnv) int, error) {
+	switch p.token {
+	case "!", "~", "-":
+		op := p.token
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "!":
+			return func(env *exprEnv) int { return boolToInt(operand(env) == 0) }, nil
+		case "~":
+			return func(env *exprEnv) int { return ^operand(env) }, nil
+		default:
+			return func(env *exprEnv) int { return -operand(env) }, nil
+		}
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (func(*exprEnv) int, error) {
+	token := p.token
+	switch token {
+	case "":
+		return nil, p.errorf("unexpected end")
+	case "(", "[":
+		p.next()
+		inner, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		closing := map[string]string{"(": ")", "[": "]"}[token]
+		if p.token != closing {
+			return nil, p.errorf("expected %q", closing)
+		}
+		p.next()
+		if token == "[" {
+			return func(env *exprEnv) int { return int(env.console.Bus.Peek(uint16(inner(env)))) }, nil
+		}
+		return inner, nil
+	}
+	p.next()
+
+	if n, ok := parseExprNumber(token); ok {
+		return func(*exprEnv) int { return n }, nil
+	}
+	if variable, ok := exprVariables[strings.ToLower(token)]; ok {
+		return variable, nil
+	}
+	return nil, p.errorf("unknown operand %q", token)
+}
+
+func parseExprNumber(token string) (int, bool) {
+	var n uint64
+	var err error
+	switch {
+	case strings.HasPrefix(token, "$"):
+		n, err = strconv.ParseUint(token[1:], 16, 32)
+	case strings.HasPrefix(token, "%"):
+		n, err = strconv.ParseUint(token[1:], 2, 32)
+	case token[0] >= '0' && token[0] <= '9':
+		n, err = strconv.ParseUint(token, 0, 32)
+	default:
+		return 0, false
+	}
+	return int(n), err == nil
+}
+
+func exprFlag(flag uint8) func(*exprEnv) int {
+	return func(env *exprEnv) int { return boolToInt(env.console.CPU.status&flag != 0) }
+}
+
+var exprVariables = map[string]func(*exprEnv) int{
+	"a":        func(env *exprEnv) int { return int(env.console.CPU.registerA) },
+	"x":        func(env *exprEnv) int { return int(env.console.CPU.registerX) },
+	"y":        func(env *exprEnv) int { return int(env.console.CPU.registerY) },
+	"p":        func(env *exprEnv) int { return int(env.console.CPU.status) },
+	"sp":       func(env *exprEnv) int { return int(env.console.CPU.stackPointer) },
+	"pc":       func(env *exprEnv) int { return int(env.console.CPU.programCounter) },
+	"c":        exprFlag(CPU_FLAG_CARRY),
+	"z":        exprFlag(CPU_FLAG_ZERO),
+	"i":        exprFlag(CPU_FLAG_INTERRUPT_DISABLE),
+	"d":        exprFlag(CPU_FLAG_DECIMAL_MODE),
+	"v":        exprFlag(CPU_FLAG_OVERFLOW),
+	"n":        exprFlag(CPU_FLAG_NEGATIVE),
+	"scanline": func(env *exprEnv) int { return int(env.console.Bus.PPU.Scanline) },
+	"dot":      func(env *exprEnv) int { return int(env.console.Bus.PPU.Cycles) },
+	"frame":    func(env *exprEnv) int { return int(env.console.FrameCount) },
+	"addr":     func(env *exprEnv) int { return int(env.addr) },
+	"value":    func(env *exprEnv) int { return int(env.value) },
+}
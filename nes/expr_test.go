@@ -0,0 +1,53 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExpression(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest([]uint8{0x4c, 0x00, 0x80})))
+	console.CPU.registerA = 0x10
+	console.CPU.registerX = 3
+	console.CPU.status = CPU_FLAG_CARRY
+	console.Bus.CpuVRAM[0x0300] = 5
+	env := &exprEnv{console: console, addr: 0x2002, value: 0x80}
+
+	tests := []struct {
+		source string
+		expect bool
+	}{
+		{"a == $10", true},
+		{"A == 16 && x == 3", true},
+		{"a == 0x11 || x != 3", false},
+		{"[$0300] > 4", true},
+		{"[$0300 - x + 3] == 5", true},
+		{"[$02fd + x] >= 6", false},
+		{"c && !z", true},
+		{"(a & %1111) == 0", true},
+		{"a ^ $10 | x == 3", true},
+		{"1 + 2 - 3", false},
+		{"-1 < 0", true},
+		{"~0 == -1", true},
+		{"addr == $2002 && value & $80", true},
+		{"pc == $8000 && sp == $fd", true},
+		{"scanline == 0 && frame == 0", true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.source, func(t *testing.T) {
+			expr, err := ParseExpression(tt.source)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, expr.Eval(env))
+		})
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, source := range []string{"", "a ==", "(a", "[a", "foo", "a b", "$zz", "1 +* 2"} {
+		_, err := ParseExpression(source)
+		assert.ErrorIs(t, err, ErrInvalidExpression, source)
+	}
+}
@@ -0,0 +1,51 @@
+package nes
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFunctional runs Klaus Dormann's functional tests (https://github.com/Klaus2m5/6502_65C02_functional_tests)
+// from testdata, where "make functional-test" downloads them, skipping the binaries which are missing.
+// They are the default builds: loaded at $0000, started at $0400, and trapping in an endless loop
+// on failure or at the success address.
+func TestFunctional(t *testing.T) {
+	tests := []struct {
+		file    string
+		variant CPUVariant
+		success uint16
+	}{
+		{"6502_functional_test.bin", CPU_VARIANT_6502, 0x3469},
+		{"65C02_extended_opcodes_test.bin", CPU_VARIANT_65C02, 0x24f1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if errors.Is(err, fs.ErrNotExist) {
+				t.Skipf("%s is missing", tt.file)
+			}
+			assert.NoError(t, err)
+
+			memory := NewFlatRAM()
+			memory.Load(0x0000, data)
+			cpu := NewCPUWithVariant(memory, tt.variant)
+			cpu.SetProgramCounter(0x0400)
+			for i := 0; i < 100_000_000; i++ {
+				pc := cpu.ProgramCounter()
+				if err := cpu.Step(); err != nil {
+					t.Fatalf("$%04X: %v", pc, err)
+				}
+				if cpu.ProgramCounter() == pc {
+					break
+				}
+			}
+			assert.Equal(t, tt.success, cpu.ProgramCounter(), "trapped at $%04X", cpu.ProgramCounter())
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package nes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Instruction is an instruction decoded from its bytes, shared by the trace logger and the disassembler.
+type Instruction struct {
+	Address uint16
+	Code    uint8
+	Op      OpeCode
+	Operand uint16 // the operand bytes, little endian
+}
+
+// DecodeInstruction decodes the instruction of variant at the start of data, which is mapped at addr.
+func DecodeInstruction(data []uint8, addr uint16, variant CPUVariant) (Instruction, error) {
+	return decodeInstruction(instructionTable(variant), data, addr)
+}
+
+// decodeInstruction decodes the instruction at the start of data with the dispatch table of a CPU.
+func decodeInstruction(table *[256]instruction, data []uint8, addr uint16) (Instruction, error) {
+	if len(data) == 0 {
+		return Instruction{}, ErrTruncatedInstruction
+	}
+	op := table[data[0]]
+	if op.execute == nil {
+		return Instruction{}, fmt.Errorf("%w: $%02X at $%04X", ErrIllegalOpcode, data[0], addr)
+	}
+	if len(data) < int(op.Length) {
+		return Instruction{}, fmt.Errorf("%w: %s at $%04X", ErrTruncatedInstruction, op.Mnemonic, addr)
+	}
+
+	i := Instruction{Address: addr, Code: data[0], Op: op.OpeCode}
+	switch op.Length {
+	case 2:
+		i.Operand = uint16(data[1])
+	case 3:
+		i.Operand = uint16(data[1]) | uint16(data[2])<<8
+	}
+	return i, nil
+}
+
+func (i Instruction) Length() int {
+	return int(i.Op.Length)
+}
+
+// Bytes returns the opcode followed by the operand bytes.
+func (i Instruction) Bytes() []uint8 {
+	return []uint8{i.Code, uint8(i.Operand), uint8(i.Operand >> 8)}[:i.Length()]
+}
+
+// Legal reports whether the instruction is documented.
+func (i Instruction) Legal() bool {
+	return !strings.HasPrefix(i.Op.Mnemonic, "*")
+}
+
+// Target returns the address the instruction refers to: the branch or jump target,
+// the accessed address, or the pointer for indirect modes.
+func (i Instruction) Target() (uint16, bool) {
+	switch i.Op.Mode {
+	case IMMEDIATE, IMPLIED, ACCUMULATOR:
+		return 0, false
+	case RELATIVE:
+		return i.Address + 2 + uint16(int8(i.Operand)), true
+	case ZERO_PAGE_RELATIVE:
+		// BBR and BBS test a zero page byte then branch
+		return i.Address + 3 + uint16(int8(i.Operand>>8)), true
+	}
+	return i.Operand, true
+}
+
+// FormatOperand formats the operand like "#$05", "$10,X" or "($20),Y", empty for implied instructions.
+// address writes the target, of 2 hexadecimal digits for the zero page modes and 4 otherwise.
+func (i Instruction) FormatOperand(address func(addr uint16, digits int) string) string {
+	target, _ := i.Target()
+	switch i.Op.Mode {
+	case ACCUMULATOR:
+		return "A"
+	case IMMEDIATE:
+		return fmt.Sprintf("#$%02X", i.Operand)
+	case ZERO_PAGE:
+		return address(target, 2)
+	case ZERO_PAGE_X:
+		return address(target, 2) + ",X"
+	case ZERO_PAGE_Y:
+		return address(target, 2) + ",Y"
+	case ABSOLUTE, RELATIVE:
+		return address(target, 4)
+	case ABSOLUTE_X:
+		return address(target, 4) + ",X"
+	case ABSOLUTE_Y:
+		return address(target, 4) + ",Y"
+	case INDIRECT:
+		return "(" + address(target, 4) + ")"
+	case INDIRECT_X:
+		return "(" + address(target, 2) + ",X)"
+	case INDIRECT_Y:
+		return "(" + address(target, 2) + "),Y"
+	case ZERO_PAGE_INDIRECT:
+		return "(" + address(target, 2) + ")"
+	case INDIRECT_ABSOLUTE_X:
+		return "(" + address(target, 4) + ",X)"
+	case ZERO_PAGE_RELATIVE:
+		return address(i.Operand&0xff, 2) + "," + address(target, 4)
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package nes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeInstruction(t *testing.T) {
+	tests := []struct {
+		name    string
+		variant CPUVariant
+		data    []uint8
+		operand string
+	}{
+		{"implied", CPU_VARIANT_2A03, []uint8{0xea}, ""},
+		{"accumulator", CPU_VARIANT_2A03, []uint8{0x0a}, "A"},
+		{"immediate", CPU_VARIANT_2A03, []uint8{0xa9, 0x05}, "#$05"},
+		{"zero page y", CPU_VARIANT_2A03, []uint8{0xb6, 0x10}, "$10,Y"},
+		{"absolute x", CPU_VARIANT_2A03, []uint8{0xbd, 0x00, 0x03}, "$0300,X"},
+		{"indirect", CPU_VARIANT_2A03, []uint8{0x6c, 0xfc, 0xff}, "($FFFC)"},
+		{"indirect y", CPU_VARIANT_2A03, []uint8{0xb1, 0x20}, "($20),Y"},
+		{"relative", CPU_VARIANT_2A03, []uint8{0xd0, 0xfd}, "$7FFF"},
+		{"zero page indirect", CPU_VARIANT_65C02, []uint8{0xb2, 0x20}, "($20)"},
+		{"indirect absolute x", CPU_VARIANT_65C02, []uint8{0x7c, 0x00, 0x03}, "($0300,X)"},
+		{"zero page relative", CPU_VARIANT_65C02, []uint8{0x0f, 0x10, 0xfd}, "$10,$8000"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			i, err := DecodeInstruction(append(tt.data, 0xff), 0x8000, tt.variant)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.data, i.Bytes())
+			assert.Equal(t, tt.operand, i.FormatOperand(func(addr uint16, digits int) string {
+				return fmt.Sprintf("$%0*X", digits, addr)
+			}))
+		})
+	}
+
+	_, err := DecodeInstruction([]uint8{0x02}, 0x8000, CPU_VARIANT_2A03)
+	assert.ErrorIs(t, err, ErrIllegalOpcode)
+	_, err = DecodeInstruction([]uint8{0x8d, 0x00}, 0x8000, CPU_VARIANT_2A03)
+	assert.ErrorIs(t, err, ErrTruncatedInstruction)
+}
+
+func TestTraceInstructionVariant(t *testing.T) {
+	memory := NewFlatRAM()
+	memory.Load(0x8000, []uint8{0xb2, 0x20})
+	memory.Load(0x0020, []uint8{0x00, 0x03})
+	memory.Write(0x0300, 0x55)
+	cpu := NewCPUWithVariant(memory, CPU_VARIANT_65C02)
+	cpu.SetProgramCounter(0x8000)
+
+	text, data := traceInstruction(cpu, nestestStyle)
+	assert.Equal(t, " LDA ($20) = 0300 = 55", text)
+	assert.Equal(t, []uint8{0xb2, 0x20}, data)
+}
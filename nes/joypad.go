@@ -1,7 +1,5 @@
 package nes
 
-import "github.com/go-gl/glfw/v3.2/glfw"
-
 const (
 	JOYPAD_A = iota
 	JOYPAD_B
@@ -39,6 +37,21 @@ func (j *Joypad) Read() uint8 {
 	return v
 }
 
+// Peek returns what Read would return without shifting to the next button.
+func (j *Joypad) Peek() uint8 {
+	if j.Strobe {
+		return j.peekButton(0)
+	}
+	return j.peekButton(j.ButtonIndex)
+}
+
+func (j *Joypad) peekButton(index uint8) uint8 {
+	if index <= 7 && j.ButtonStatus[index] {
+		return 1
+	}
+	return 0
+}
+
 func (j *Joypad) Write(data uint8) {
 	j.Strobe = data&1 == 1
 	if j.Strobe {
@@ -46,13 +59,27 @@ func (j *Joypad) Write(data uint8) {
 	}
 }
 
-func (j *Joypad) ReadKeys(window *glfw.Window) {
-	j.ButtonStatus[JOYPAD_A] = window.GetKey(glfw.KeyA) == glfw.Press
-	j.ButtonStatus[JOYPAD_B] = window.GetKey(glfw.KeyS) == glfw.Press
-	j.ButtonStatus[JOYPAD_SELECT] = window.GetKey(glfw.KeySpace) == glfw.Press
-	j.ButtonStatus[JOYPAD_START] = window.GetKey(glfw.KeyEnter) == glfw.Press
-	j.ButtonStatus[JOYPAD_UP] = window.GetKey(glfw.KeyUp) == glfw.Press
-	j.ButtonStatus[JOYPAD_DOWN] = window.GetKey(glfw.KeyDown) == glfw.Press
-	j.ButtonStatus[JOYPAD_LEFT] = window.GetKey(glfw.KeyLeft) == glfw.Press
-	j.ButtonStatus[JOYPAD_RIGHT] = window.GetKey(glfw.KeyRight) == glfw.Press
+// SetButtons sets every button at once from a bit mask of 1 << JOYPAD_*.
+func (j *Joypad) SetButtons(mask uint8) {
+	for i := range j.ButtonStatus {
+		j.ButtonStatus[i] = mask&(1<<i) != 0
+	}
+}
+
+// SetButton presses or releases a single JOYPAD_* button.
+func (j *Joypad) SetButton(button uint8, pressed bool) {
+	if button <= JOYPAD_RIGHT {
+		j.ButtonStatus[button] = pressed
+	}
+}
+
+// Buttons returns the pressed buttons as a bit mask of 1 << JOYPAD_*.
+func (j *Joypad) Buttons() uint8 {
+	var mask uint8
+	for i, pressed := range j.ButtonStatus {
+		if pressed {
+			mask |= 1 << i
+		}
+	}
+	return mask
 }
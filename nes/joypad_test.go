@@ -0,0 +1,30 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoypadSetButtons(t *testing.T) {
+	j := NewJoypad()
+	j.SetButtons(1<<JOYPAD_B | 1<<JOYPAD_DOWN)
+	assert.Equal(t, [8]bool{false, true, false, false, false, true, false, false}, j.ButtonStatus)
+
+	j.SetButton(JOYPAD_B, false)
+	j.SetButton(JOYPAD_RIGHT, true)
+	assert.Equal(t, uint8(1<<JOYPAD_DOWN|1<<JOYPAD_RIGHT), j.Buttons())
+}
+
+func TestJoypadRead(t *testing.T) {
+	j := NewJoypad()
+	j.SetButtons(1<<JOYPAD_A | 1<<JOYPAD_RIGHT)
+	j.Write(1)
+	j.Write(0)
+
+	var got []uint8
+	for i := 0; i < 9; i++ {
+		got = append(got, j.Read())
+	}
+	assert.Equal(t, []uint8{1, 0, 0, 0, 0, 0, 0, 1, 0}, got)
+}
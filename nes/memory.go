@@ -0,0 +1,59 @@
+package nes
+
+// Memory is the address space seen by the CPU.
+// *Bus implements it for the NES, but any 6502 system can provide its own.
+type Memory interface {
+	Read(addr uint16) uint8
+	Write(addr uint16, data uint8)
+	// Tick is called with the number of CPU cycles consumed by each instruction.
+	Tick(cycles uint8)
+}
+
+// faultSource is implemented by memories which report errors raised during an access (e.g. *Bus).
+type faultSource interface {
+	TakeError() error
+}
+
+// nmiSource is implemented by memories which can raise a non-maskable interrupt (e.g. *Bus).
+type nmiSource interface {
+	PollNMIStatus() bool
+}
+
+// Peeker is implemented by memories that can be read without side effects, for tracing and tools.
+type Peeker interface {
+	Peek(addr uint16) uint8
+}
+
+// FlatRAM is a plain 64KB read/write address space without any mapped devices.
+// It is useful to drive the CPU directly from unit tests, fuzzers or non-NES systems.
+type FlatRAM struct {
+	Data   [0x10000]uint8
+	Cycles uint
+}
+
+func NewFlatRAM() *FlatRAM {
+	return &FlatRAM{}
+}
+
+func (m *FlatRAM) Read(addr uint16) uint8 {
+	return m.Data[addr]
+}
+
+func (m *FlatRAM) Peek(addr uint16) uint8 {
+	return m.Data[addr]
+}
+
+func (m *FlatRAM) Write(addr uint16, data uint8) {
+	m.Data[addr] = data
+}
+
+func (m *FlatRAM) Tick(cycles uint8) {
+	m.Cycles += uint(cycles)
+}
+
+// Load copies data into memory starting at addr, wrapping around at the end of the address space.
+func (m *FlatRAM) Load(addr uint16, data []uint8) {
+	for i, v := range data {
+		m.Data[addr+uint16(i)] = v
+	}
+}
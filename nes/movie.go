@@ -0,0 +1,351 @@
+package nes
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Commands of the first column of an FM2 input line.
+const (
+	MOVIE_COMMAND_RESET = 1 << 0
+	MOVIE_COMMAND_POWER = 1 << 1
+)
+
+type MovieMode int
+
+const (
+	MOVIE_MODE_NONE MovieMode = iota
+	MOVIE_MODE_RECORD
+	MOVIE_MODE_PLAY
+	MOVIE_MODE_FINISHED // playback reached the end of the movie
+)
+
+var (
+	ErrInvalidMovie     = errors.New("invalid movie")
+	ErrUnsupportedMovie = errors.New("unsupported movie")
+	ErrMovieMismatch    = errors.New("movie was recorded with a different ROM")
+)
+
+// FM2 writes the buttons as RLDUTSBA, from bit 7 to bit 0 of the Joypad mask
+const movieButtons = "RLDUTSBA"
+
+type MovieFrame struct {
+	Command uint8
+	Buttons [2]uint8
+}
+
+// Movie is an FCEUX FM2 movie starting from power on.
+type Movie struct {
+	RerecordCount uint
+	ROMFilename   string
+	ROMChecksum   string // "base64:" followed by the MD5 of PRG-ROM and CHR-ROM
+	GUID          string
+	Comments      []string
+	Frames        []MovieFrame
+}
+
+// ReadMovie parses an FM2 movie. Movies starting from a save state, PAL movies and the Four Score are not supported.
+func ReadMovie(r io.Reader) (*Movie, error) {
+	m := &Movie{}
+	ports := [2]bool{true, true}
+	hasVersion := false
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+
+		if text[0] == '|' {
+			frame, err := parseMovieFrame(text, ports)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidMovie, line, err)
+			}
+			m.Frames = append(m.Frames, frame)
+			continue
+		}
+
+		key, value, _ := strings.Cut(text, " ")
+		switch key {
+		case "version":
+			if value != "3" {
+				return nil, fmt.Errorf("%w: version %s", ErrUnsupportedMovie, value)
+			}
+			hasVersion = true
+		case "rerecordCount":
+			n, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidMovie, line, err)
+			}
+			m.RerecordCount = uint(n)
+		case "romFilename":
+			m.ROMFilename = value
+		case "romChecksum":
+			m.ROMChecksum = value
+		case "guid":
+			m.GUID = value
+		case "comment":
+			m.Comments = append(m.Comments, value)
+		case "palFlag", "fourscore", "port2":
+			if value != "0" {
+				return nil, fmt.Errorf("%w: %s %s", ErrUnsupportedMovie, key, value)
+			}
+		case "port0", "port1":
+			switch value {
+			case "0":
+				ports[key[4]-'0'] = false
+			case "1":
+			default:
+				return nil, fmt.Errorf("%w: %s %s", ErrUnsupportedMovie, key, value)
+			}
+		case "savestate":
+			return nil, fmt.Errorf("%w: movie starts from a save state", ErrUnsupportedMovie)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !hasVersion {
+		return nil, fmt.Errorf("%w: missing version", ErrInvalidMovie)
+	}
+	return m, nil
+}
+
+func parseMovieFrame(text string, ports [2]bool) (MovieFrame, error) {
+	var frame MovieFrame
+	fields := strings.Split(text, "|")
+	// "|c|port0|port1|port2|" splits into an empty field at each end
+	if len(fields) < 5 {
+		return frame, fmt.Errorf("expected at least 3 columns: %q", text)
+	}
+
+	command, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil {
+		return frame, err
+	}
+	frame.Command = uint8(command)
+
+	for player := 0; player < 2; player++ {
+		if !ports[player] {
+			continue
+		}
+		buttons := fields[2+player]
+		if len(buttons) != len(movieButtons) {
+			return frame, fmt.Errorf("expected %d buttons: %q", len(movieButtons), buttons)
+		}
+		for i := 0; i < len(buttons); i++ {
+			if buttons[i] != '.' && buttons[i] != ' ' {
+				frame.Buttons[player] |= 1 << (7 - i)
+			}
+		}
+	}
+	return frame, nil
+}
+
+func (m *Movie) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "version 3")
+	fmt.Fprintln(bw, "emuVersion 0")
+	fmt.Fprintf(bw, "rerecordCount %d\n", m.RerecordCount)
+	fmt.Fprintln(bw, "palFlag 0")
+	fmt.Fprintf(bw, "romFilename %s\n", m.ROMFilename)
+	fmt.Fprintf(bw, "romChecksum %s\n", m.ROMChecksum)
+	if m.GUID != "" {
+		fmt.Fprintf(bw, "guid %s\n", m.GUID)
+	}
+	fmt.Fprintln(bw, "fourscore 0")
+	fmt.Fprintln(bw, "port0 1")
+	fmt.Fprintln(bw, "port1 1")
+	fmt.Fprintln(bw, "port2 0")
+	for _, comment := range m.Comments {
+		fmt.Fprintf(bw, "comment %s\n", comment)
+	}
+
+	for _, frame := range m.Frames {
+		fmt.Fprintf(bw, "|%d|%s|%s||\n", frame.Command, formatMovieButtons(frame.Buttons[0]), formatMovieButtons(frame.Buttons[1]))
+	}
+	return bw.Flush()
+}
+
+func formatMovieButtons(mask uint8) string {
+	b := []byte("........")
+	for i := 0; i < len(b); i++ {
+		if mask&(1<<(7-i)) != 0 {
+			b[i] = movieButtons[i]
+		}
+	}
+	return string(b)
+}
+
+type moviePlayer struct {
+	movie    *Movie
+	mode     MovieMode
+	readOnly bool
+	// frame index in the movie minus FrameCount, which starts over at every power cycle
+	offset   int
+	rerecord bool
+}
+
+// RecordMovie powers the console on and records every following frame into a new movie.
+func (c *Console) RecordMovie(romFilename string) (*Movie, error) {
+	c.movie = nil
+	if err := c.HardReset(); err != nil {
+		return nil, err
+	}
+	c.command = 0
+	c.movie = &moviePlayer{
+		movie: &Movie{
+			ROMFilename: romFilename,
+			ROMChecksum: c.movieChecksum(),
+		},
+		mode: MOVIE_MODE_RECORD,
+	}
+	return c.movie.movie, nil
+}
+
+// PlayMovie powers the console on and feeds the movie input to the following frames.
+// In read-only mode loading a state keeps playing, otherwise it switches to recording from the loaded frame.
+func (c *Console) PlayMovie(m *Movie, readOnly bool) error {
+	if c.rom == nil {
+		return ErrNoROM
+	}
+	if m.ROMChecksum != "" && m.ROMChecksum != c.movieChecksum() {
+		return ErrMovieMismatch
+	}
+	c.movie = nil
+	if err := c.HardReset(); err != nil {
+		return err
+	}
+	c.command = 0
+	c.movie = &moviePlayer{
+		movie:    m,
+		mode:     MOVIE_MODE_PLAY,
+		readOnly: readOnly,
+	}
+	return nil
+}
+
+func (c *Console) StopMovie() {
+	c.movie = nil
+}
+
+func (c *Console) MovieMode() MovieMode {
+	if c.movie == nil {
+		return MOVIE_MODE_NONE
+	}
+	return c.movie.mode
+}
+
+// Movie returns the movie being recorded or played, or nil.
+func (c *Console) Movie() *Movie {
+	if c.movie == nil {
+		return nil
+	}
+	return c.movie.movie
+}
+
+func (c *Console) SetMovieReadOnly(readOnly bool) {
+	if c.movie != nil {
+		c.movie.readOnly = readOnly
+	}
+}
+
+func (c *Console) MovieReadOnly() bool {
+	return c.movie != nil && c.movie.readOnly
+}
+
+// MovieFrame returns the index in the movie of the next frame.
+func (c *Console) MovieFrame() int {
+	if c.movie == nil {
+		return 0
+	}
+	return int(c.FrameCount) + c.movie.offset
+}
+
+func (c *Console) movieChecksum() string {
+	sum := md5.New()
+	sum.Write(c.Cartridge.ProgramRom)
+	sum.Write(c.Cartridge.CharacterRom)
+	return "base64:" + base64.StdEncoding.EncodeToString(sum.Sum(nil))
+}
+
+// startMovieFrame plays or records the input of the frame about to be emulated.
+// It returns the command issued since the last frame, which has already been executed.
+func (c *Console) startMovieFrame() (uint8, error) {
+	command := c.command
+	c.command = 0
+
+	p := c.movie
+	if p == nil {
+		return command, nil
+	}
+	index := c.MovieFrame()
+	frames := p.movie.Frames
+
+	switch p.mode {
+	case MOVIE_MODE_PLAY:
+		if index >= len(frames) {
+			p.mode = MOVIE_MODE_FINISHED
+			return command, nil
+		}
+		frame := frames[index]
+		var err error
+		if frame.Command&MOVIE_COMMAND_POWER != 0 {
+			err = c.HardReset()
+		} else if frame.Command&MOVIE_COMMAND_RESET != 0 {
+			err = c.Reset()
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.SetButtons(0, frame.Buttons[0])
+		c.SetButtons(1, frame.Buttons[1])
+		command = c.command
+		c.command = 0
+	case MOVIE_MODE_RECORD:
+		if index < len(frames) && p.rerecord {
+			p.movie.RerecordCount++
+		}
+		p.rerecord = false
+		for len(frames) < index {
+			frames = append(frames, MovieFrame{})
+		}
+		p.movie.Frames = append(frames[:index], MovieFrame{
+			Command: command,
+			Buttons: [2]uint8{c.Bus.JoyPad1.Buttons(), c.Bus.JoyPad2.Buttons()},
+		})
+	}
+	return command, nil
+}
+
+// seekMovie is called after the console jumped to another frame by loading a state or rewinding.
+func (c *Console) seekMovie() {
+	c.command = 0
+	p := c.movie
+	if p == nil {
+		return
+	}
+	if c.MovieFrame() < 0 {
+		c.movie = nil
+		return
+	}
+
+	switch p.mode {
+	case MOVIE_MODE_RECORD:
+		p.rerecord = true
+	case MOVIE_MODE_PLAY, MOVIE_MODE_FINISHED:
+		if !p.readOnly {
+			p.mode = MOVIE_MODE_RECORD
+			p.rerecord = true
+		} else if c.MovieFrame() < len(p.movie.Frames) {
+			p.mode = MOVIE_MODE_PLAY
+		}
+	}
+}
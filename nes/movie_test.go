@@ -0,0 +1,164 @@
+package nes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const movieTestFM2 = `version 3
+emuVersion 22020
+rerecordCount 7
+palFlag 0
+romFilename test
+romChecksum base64:AAAAAAAAAAAAAAAAAAAAAA==
+guid 452DE2C3-EF43-2FA9-77AC-0677FC51543B
+fourscore 0
+port0 1
+port1 1
+port2 0
+comment author someone
+|0|........|........||
+|1|R.....BA|.L..T...||
+|2|........|   U S  ||
+`
+
+func TestReadMovie(t *testing.T) {
+	m, err := ReadMovie(strings.NewReader(movieTestFM2))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), m.RerecordCount)
+	assert.Equal(t, "test", m.ROMFilename)
+	assert.Equal(t, "base64:AAAAAAAAAAAAAAAAAAAAAA==", m.ROMChecksum)
+	assert.Equal(t, []string{"author someone"}, m.Comments)
+	assert.Equal(t, []MovieFrame{
+		{},
+		{Command: MOVIE_COMMAND_RESET, Buttons: [2]uint8{
+			1<<JOYPAD_RIGHT | 1<<JOYPAD_B | 1<<JOYPAD_A,
+			1<<JOYPAD_LEFT | 1<<JOYPAD_START,
+		}},
+		{Command: MOVIE_COMMAND_POWER, Buttons: [2]uint8{0, 1<<JOYPAD_UP | 1<<JOYPAD_SELECT}},
+	}, m.Frames)
+
+	var buf bytes.Buffer
+	assert.NoError(t, m.Write(&buf))
+	again, err := ReadMovie(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, m, again)
+}
+
+func TestReadMovieErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{"missing version", "|0|........|........||\n", ErrInvalidMovie},
+		{"version", "version 2\n", ErrUnsupportedMovie},
+		{"pal", "version 3\npalFlag 1\n", ErrUnsupportedMovie},
+		{"savestate", "version 3\nsavestate base64:AAAA\n", ErrUnsupportedMovie},
+		{"short buttons", "version 3\n|0|...|........||\n", ErrInvalidMovie},
+		{"command", "version 3\n|x|........|........||\n", ErrInvalidMovie},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadMovie(strings.NewReader(tt.input))
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestMovieRecordAndPlay(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	console.EnableRewind(4, 1<<20)
+
+	m, err := console.RecordMovie("test.nes")
+	assert.NoError(t, err)
+	var expect []CPUState
+	for i := 0; i < 12; i++ {
+		console.SetButtons(0, uint8(i/2%2)<<JOYPAD_A)
+		switch i {
+		case 4:
+			assert.NoError(t, console.Reset())
+		case 8:
+			assert.NoError(t, console.HardReset())
+		}
+		assert.NoError(t, console.StepFrame())
+		expect = append(expect, console.CPU.State())
+	}
+	assert.Len(t, m.Frames, 12)
+	assert.Equal(t, uint8(MOVIE_COMMAND_RESET), m.Frames[4].Command)
+	assert.Equal(t, uint8(MOVIE_COMMAND_POWER), m.Frames[8].Command)
+	assert.Equal(t, 12, console.MovieFrame())
+
+	var buf bytes.Buffer
+	assert.NoError(t, m.Write(&buf))
+	loaded, err := ReadMovie(&buf)
+	assert.NoError(t, err)
+
+	other := NewConsole()
+	assert.NoError(t, other.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	assert.NoError(t, other.PlayMovie(loaded, true))
+	for i := 0; i < 12; i++ {
+		// input from the user is overridden by the movie
+		other.SetButtons(0, 0xff)
+		assert.NoError(t, other.StepFrame())
+		assert.Equal(t, expect[i], other.CPU.State(), "frame %d", i)
+	}
+	assert.Equal(t, MOVIE_MODE_PLAY, other.MovieMode())
+	assert.NoError(t, other.StepFrame())
+	assert.Equal(t, MOVIE_MODE_FINISHED, other.MovieMode())
+}
+
+func TestMovieRerecord(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	m, err := console.RecordMovie("test.nes")
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, console.StepFrame())
+	}
+	var state bytes.Buffer
+	assert.NoError(t, console.SaveState(&state))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, console.StepFrame())
+	}
+
+	t.Run("read-write", func(t *testing.T) {
+		assert.NoError(t, console.PlayMovie(m, false))
+		assert.NoError(t, console.LoadState(bytes.NewReader(state.Bytes())))
+		assert.Equal(t, MOVIE_MODE_RECORD, console.MovieMode())
+
+		console.SetButtons(0, 1<<JOYPAD_START)
+		assert.NoError(t, console.StepFrame())
+		assert.Equal(t, uint(1), m.RerecordCount)
+		assert.Len(t, m.Frames, 4)
+		assert.Equal(t, uint8(1<<JOYPAD_START), m.Frames[3].Buttons[0])
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		assert.NoError(t, console.PlayMovie(m, true))
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, console.StepFrame())
+		}
+		assert.Equal(t, MOVIE_MODE_FINISHED, console.MovieMode())
+
+		assert.NoError(t, console.LoadState(bytes.NewReader(state.Bytes())))
+		assert.Equal(t, MOVIE_MODE_PLAY, console.MovieMode())
+		assert.NoError(t, console.StepFrame())
+		assert.Equal(t, uint8(1<<JOYPAD_START), console.Bus.JoyPad1.Buttons())
+		assert.Equal(t, uint(1), m.RerecordCount)
+		assert.Len(t, m.Frames, 4)
+	})
+}
+
+func TestPlayMovieMismatch(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	m, err := ReadMovie(strings.NewReader(movieTestFM2))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, console.PlayMovie(m, true), ErrMovieMismatch)
+}
@@ -1,5 +1,10 @@
 package nes
 
+import (
+	"fmt"
+	"strings"
+)
+
 type OpeCode struct {
 	Code                  uint8
 	Mnemonic              string
@@ -286,3 +291,280 @@ var CPU_OPS_CODES map[uint8]OpeCode = map[uint8]OpeCode{
 	0xd4: {Mnemonic: "*NOP", Length: 2, Cycles: 4, Mode: ZERO_PAGE_X},
 	0xf4: {Mnemonic: "*NOP", Length: 2, Cycles: 4, Mode: ZERO_PAGE_X},
 }
+
+// CPU_65C02_OPS_CODES holds the opcodes which are added or changed on the 65C02.
+// The documented NMOS opcodes in CPU_OPS_CODES are shared, the NMOS illegal opcodes are not.
+var CPU_65C02_OPS_CODES map[uint8]OpeCode = map[uint8]OpeCode{
+	0x72: {Mnemonic: "ADC", Length: 2, Cycles: 5, Mode: ZERO_PAGE_INDIRECT},
+	0x32: {Mnemonic: "AND", Length: 2, Cycles: 5, Mode: ZERO_PAGE_INDIRECT},
+	0xd2: {Mnemonic: "CMP", Length: 2, Cycles: 5, Mode: ZERO_PAGE_INDIRECT},
+	0x52: {Mnemonic: "EOR", Length: 2, Cycles: 5, Mode: ZERO_PAGE_INDIRECT},
+	0xb2: {Mnemonic: "LDA", Length: 2, Cycles: 5, Mode: ZERO_PAGE_INDIRECT},
+	0x12: {Mnemonic: "ORA", Length: 2, Cycles: 5, Mode: ZERO_PAGE_INDIRECT},
+	0xf2: {Mnemonic: "SBC", Length: 2, Cycles: 5, Mode: ZERO_PAGE_INDIRECT},
+	0x92: {Mnemonic: "STA", Length: 2, Cycles: 5, Mode: ZERO_PAGE_INDIRECT},
+
+	0x89: {Mnemonic: "BIT", Length: 2, Cycles: 2, Mode: IMMEDIATE},
+	0x34: {Mnemonic: "BIT", Length: 2, Cycles: 4, Mode: ZERO_PAGE_X},
+	0x3c: {Mnemonic: "BIT", Length: 3, Cycles: 4, Mode: ABSOLUTE_X, AddCycleIfPageCrossed: true},
+
+	0x1a: {Mnemonic: "INC", Length: 1, Cycles: 2, Mode: ACCUMULATOR},
+	0x3a: {Mnemonic: "DEC", Length: 1, Cycles: 2, Mode: ACCUMULATOR},
+
+	0x6c: {Mnemonic: "JMP", Length: 3, Cycles: 6, Mode: INDIRECT},
+	0x7c: {Mnemonic: "JMP", Length: 3, Cycles: 6, Mode: INDIRECT_ABSOLUTE_X},
+
+	0x80: {Mnemonic: "BRA", Length: 2, Cycles: 3, Mode: RELATIVE},
+	0xda: {Mnemonic: "PHX", Length: 1, Cycles: 3, Mode: IMPLIED},
+	0x5a: {Mnemonic: "PHY", Length: 1, Cycles: 3, Mode: IMPLIED},
+	0xfa: {Mnemonic: "PLX", Length: 1, Cycles: 4, Mode: IMPLIED},
+	0x7a: {Mnemonic: "PLY", Length: 1, Cycles: 4, Mode: IMPLIED},
+
+	0x64: {Mnemonic: "STZ", Length: 2, Cycles: 3, Mode: ZERO_PAGE},
+	0x74: {Mnemonic: "STZ", Length: 2, Cycles: 4, Mode: ZERO_PAGE_X},
+	0x9c: {Mnemonic: "STZ", Length: 3, Cycles: 4, Mode: ABSOLUTE},
+	0x9e: {Mnemonic: "STZ", Length: 3, Cycles: 5, Mode: ABSOLUTE_X},
+
+	0x14: {Mnemonic: "TRB", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x1c: {Mnemonic: "TRB", Length: 3, Cycles: 6, Mode: ABSOLUTE},
+	0x04: {Mnemonic: "TSB", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x0c: {Mnemonic: "TSB", Length: 3, Cycles: 6, Mode: ABSOLUTE},
+
+	// Rockwell/WDC bit instructions
+	0x07: {Mnemonic: "RMB0", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x17: {Mnemonic: "RMB1", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x27: {Mnemonic: "RMB2", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x37: {Mnemonic: "RMB3", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x47: {Mnemonic: "RMB4", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x57: {Mnemonic: "RMB5", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x67: {Mnemonic: "RMB6", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x77: {Mnemonic: "RMB7", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x87: {Mnemonic: "SMB0", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x97: {Mnemonic: "SMB1", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0xa7: {Mnemonic: "SMB2", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0xb7: {Mnemonic: "SMB3", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0xc7: {Mnemonic: "SMB4", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0xd7: {Mnemonic: "SMB5", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0xe7: {Mnemonic: "SMB6", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0xf7: {Mnemonic: "SMB7", Length: 2, Cycles: 5, Mode: ZERO_PAGE},
+	0x0f: {Mnemonic: "BBR0", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0x1f: {Mnemonic: "BBR1", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0x2f: {Mnemonic: "BBR2", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0x3f: {Mnemonic: "BBR3", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0x4f: {Mnemonic: "BBR4", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0x5f: {Mnemonic: "BBR5", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0x6f: {Mnemonic: "BBR6", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0x7f: {Mnemonic: "BBR7", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0x8f: {Mnemonic: "BBS0", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0x9f: {Mnemonic: "BBS1", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0xaf: {Mnemonic: "BBS2", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0xbf: {Mnemonic: "BBS3", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0xcf: {Mnemonic: "BBS4", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0xdf: {Mnemonic: "BBS5", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0xef: {Mnemonic: "BBS6", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+	0xff: {Mnemonic: "BBS7", Length: 3, Cycles: 5, Mode: ZERO_PAGE_RELATIVE},
+
+	// unused opcodes are NOPs of various lengths on the 65C02
+	0x02: {Mnemonic: "NOP", Length: 2, Cycles: 2, Mode: IMMEDIATE},
+	0x22: {Mnemonic: "NOP", Length: 2, Cycles: 2, Mode: IMMEDIATE},
+	0x42: {Mnemonic: "NOP", Length: 2, Cycles: 2, Mode: IMMEDIATE},
+	0x62: {Mnemonic: "NOP", Length: 2, Cycles: 2, Mode: IMMEDIATE},
+	0x82: {Mnemonic: "NOP", Length: 2, Cycles: 2, Mode: IMMEDIATE},
+	0xc2: {Mnemonic: "NOP", Length: 2, Cycles: 2, Mode: IMMEDIATE},
+	0xe2: {Mnemonic: "NOP", Length: 2, Cycles: 2, Mode: IMMEDIATE},
+	0x44: {Mnemonic: "NOP", Length: 2, Cycles: 3, Mode: ZERO_PAGE},
+	0x54: {Mnemonic: "NOP", Length: 2, Cycles: 4, Mode: ZERO_PAGE_X},
+	0xd4: {Mnemonic: "NOP", Length: 2, Cycles: 4, Mode: ZERO_PAGE_X},
+	0xf4: {Mnemonic: "NOP", Length: 2, Cycles: 4, Mode: ZERO_PAGE_X},
+	0x5c: {Mnemonic: "NOP", Length: 3, Cycles: 8, Mode: ABSOLUTE},
+	0xdc: {Mnemonic: "NOP", Length: 3, Cycles: 4, Mode: ABSOLUTE},
+	0xfc: {Mnemonic: "NOP", Length: 3, Cycles: 4, Mode: ABSOLUTE},
+	0x03: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x13: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x23: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x33: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x43: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x53: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x63: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x73: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x83: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x93: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xa3: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xb3: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xc3: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xd3: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xe3: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xf3: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x0b: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x1b: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x2b: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x3b: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x4b: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x5b: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x6b: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x7b: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x8b: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0x9b: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xab: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xbb: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xcb: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xdb: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xeb: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+	0xfb: {Mnemonic: "NOP", Length: 1, Cycles: 1, Mode: IMPLIED},
+}
+
+type instruction struct {
+	OpeCode
+	execute func(c *CPU, opsInfo OpeCode)
+}
+
+// cpuInstructions is the dispatch table used by CPU.Step.
+// Each entry holds the opcode information (addressing mode, cycles, ...) and its handler,
+// so that executing an instruction needs neither a map lookup nor a switch on the mnemonic.
+var cpuInstructions = newInstructionTable(CPU_OPS_CODES)
+
+// cmosInstructions is the dispatch table used by CPU_VARIANT_65C02.
+var cmosInstructions = newInstructionTable(cmosOpsCodes())
+
+// instructionTable returns the dispatch table of variant.
+func instructionTable(variant CPUVariant) *[256]instruction {
+	if variant == CPU_VARIANT_65C02 {
+		return &cmosInstructions
+	}
+	return &cpuInstructions
+}
+
+var cpuHandlers = map[string]func(c *CPU, opsInfo OpeCode){
+	"BRK":  func(c *CPU, _ OpeCode) { c.brk() },
+	"ADC":  (*CPU).adc,
+	"AND":  (*CPU).and,
+	"ASL":  (*CPU).asl,
+	"BCC":  (*CPU).bcc,
+	"BCS":  (*CPU).bcs,
+	"BEQ":  (*CPU).beq,
+	"BIT":  (*CPU).bit,
+	"BMI":  (*CPU).bmi,
+	"BNE":  (*CPU).bne,
+	"BPL":  (*CPU).bpl,
+	"BVC":  (*CPU).bvc,
+	"BVS":  (*CPU).bvs,
+	"CLC":  func(c *CPU, _ OpeCode) { c.clc() },
+	"CLD":  func(c *CPU, _ OpeCode) { c.cld() },
+	"CLI":  func(c *CPU, _ OpeCode) { c.cli() },
+	"CLV":  func(c *CPU, _ OpeCode) { c.clv() },
+	"CMP":  (*CPU).cmp,
+	"CPX":  (*CPU).cpx,
+	"CPY":  (*CPU).cpy,
+	"DEC":  (*CPU).dec,
+	"DEX":  func(c *CPU, _ OpeCode) { c.dex() },
+	"DEY":  func(c *CPU, _ OpeCode) { c.dey() },
+	"EOR":  (*CPU).eor,
+	"INC":  (*CPU).inc,
+	"INX":  func(c *CPU, _ OpeCode) { c.inx() },
+	"INY":  func(c *CPU, _ OpeCode) { c.iny() },
+	"JMP":  (*CPU).jmp,
+	"JSR":  (*CPU).jsr,
+	"LDA":  (*CPU).lda,
+	"LDX":  (*CPU).ldx,
+	"LDY":  (*CPU).ldy,
+	"LSR":  (*CPU).lsr,
+	"NOP":  func(c *CPU, _ OpeCode) {},
+	"ORA":  (*CPU).ora,
+	"PHA":  func(c *CPU, _ OpeCode) { c.pha() },
+	"PHP":  func(c *CPU, _ OpeCode) { c.php() },
+	"PLA":  func(c *CPU, _ OpeCode) { c.pla() },
+	"PLP":  func(c *CPU, _ OpeCode) { c.plp() },
+	"ROL":  (*CPU).rol,
+	"ROR":  (*CPU).ror,
+	"RTI":  func(c *CPU, _ OpeCode) { c.rti() },
+	"RTS":  func(c *CPU, _ OpeCode) { c.rts() },
+	"SBC":  (*CPU).sbc,
+	"*SBC": (*CPU).sbc,
+	"SEC":  func(c *CPU, _ OpeCode) { c.sec() },
+	"SED":  func(c *CPU, _ OpeCode) { c.sed() },
+	"SEI":  func(c *CPU, _ OpeCode) { c.sei() },
+	"STA":  (*CPU).sta,
+	"STX":  (*CPU).stx,
+	"STY":  (*CPU).sty,
+	"TAX":  func(c *CPU, _ OpeCode) { c.tax() },
+	"TAY":  func(c *CPU, _ OpeCode) { c.tay() },
+	"TSX":  func(c *CPU, _ OpeCode) { c.tsx() },
+	"TXA":  func(c *CPU, _ OpeCode) { c.txa() },
+	"TXS":  func(c *CPU, _ OpeCode) { c.txs() },
+	"TYA":  func(c *CPU, _ OpeCode) { c.tya() },
+	"*NOP": (*CPU).nopRead,
+	"*LAX": (*CPU).lax,
+	"*SAX": (*CPU).sax,
+	"*DCP": (*CPU).dcp,
+	"*ISB": (*CPU).isb,
+	"*SLO": (*CPU).slo,
+	"*RLA": (*CPU).rla,
+	"*RRA": (*CPU).rra,
+	"*SRE": (*CPU).sre,
+	"BRA":  (*CPU).bra,
+	"PHX":  func(c *CPU, _ OpeCode) { c.phx() },
+	"PHY":  func(c *CPU, _ OpeCode) { c.phy() },
+	"PLX":  func(c *CPU, _ OpeCode) { c.plx() },
+	"PLY":  func(c *CPU, _ OpeCode) { c.ply() },
+	"STZ":  (*CPU).stz,
+	"TRB":  (*CPU).trb,
+	"TSB":  (*CPU).tsb,
+	"RMB0": (*CPU).rmb,
+	"RMB1": (*CPU).rmb,
+	"RMB2": (*CPU).rmb,
+	"RMB3": (*CPU).rmb,
+	"RMB4": (*CPU).rmb,
+	"RMB5": (*CPU).rmb,
+	"RMB6": (*CPU).rmb,
+	"RMB7": (*CPU).rmb,
+	"SMB0": (*CPU).smb,
+	"SMB1": (*CPU).smb,
+	"SMB2": (*CPU).smb,
+	"SMB3": (*CPU).smb,
+	"SMB4": (*CPU).smb,
+	"SMB5": (*CPU).smb,
+	"SMB6": (*CPU).smb,
+	"SMB7": (*CPU).smb,
+	"BBR0": (*CPU).bbr,
+	"BBR1": (*CPU).bbr,
+	"BBR2": (*CPU).bbr,
+	"BBR3": (*CPU).bbr,
+	"BBR4": (*CPU).bbr,
+	"BBR5": (*CPU).bbr,
+	"BBR6": (*CPU).bbr,
+	"BBR7": (*CPU).bbr,
+	"BBS0": (*CPU).bbs,
+	"BBS1": (*CPU).bbs,
+	"BBS2": (*CPU).bbs,
+	"BBS3": (*CPU).bbs,
+	"BBS4": (*CPU).bbs,
+	"BBS5": (*CPU).bbs,
+	"BBS6": (*CPU).bbs,
+	"BBS7": (*CPU).bbs,
+}
+
+func cmosOpsCodes() map[uint8]OpeCode {
+	opsCodes := map[uint8]OpeCode{}
+	for code, opsInfo := range CPU_OPS_CODES {
+		if !strings.HasPrefix(opsInfo.Mnemonic, "*") {
+			opsCodes[code] = opsInfo
+		}
+	}
+	for code, opsInfo := range CPU_65C02_OPS_CODES {
+		opsCodes[code] = opsInfo
+	}
+	return opsCodes
+}
+
+func newInstructionTable(opsCodes map[uint8]OpeCode) [256]instruction {
+	var table [256]instruction
+	for code, opsInfo := range opsCodes {
+		handler, ok := cpuHandlers[opsInfo.Mnemonic]
+		if !ok {
+			panic(fmt.Sprintf("no handler for mnemonic: %s", opsInfo.Mnemonic))
+		}
+		opsInfo.Code = code
+		table[code] = instruction{OpeCode: opsInfo, execute: handler}
+	}
+	return table
+}
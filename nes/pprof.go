@@ -0,0 +1,199 @@
+package nes
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+)
+
+// NTSC_CPU_FREQUENCY is the number of CPU cycles per second of an NTSC console.
+const NTSC_CPU_FREQUENCY = 1789773
+
+// protoBuffer encodes the few protocol buffer types used by profile.proto.
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+// uint64 appends a varint field, omitted when it is 0.
+func (b *protoBuffer) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(v)
+}
+
+func (b *protoBuffer) bool(field int, v bool) {
+	if v {
+		b.uint64(field, 1)
+	}
+}
+
+// packed appends a repeated varint field.
+func (b *protoBuffer) packed(field int, values []uint64) {
+	var p protoBuffer
+	for _, v := range values {
+		p.varint(v)
+	}
+	b.bytes(field, p)
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+// message appends the message encoded by encode.
+func (b *protoBuffer) message(field int, encode func(m *protoBuffer)) {
+	var m protoBuffer
+	encode(&m)
+	b.bytes(field, m)
+}
+
+// pprofWriter builds a profile.proto message, see github.com/google/pprof/proto/profile.proto.
+type pprofWriter struct {
+	protoBuffer
+	strings   map[string]uint64
+	table     []string
+	functions map[uint16]uint64
+	locations map[pprofLocation]uint64
+}
+
+type pprofLocation struct {
+	addr     uint16
+	function uint16
+}
+
+func (w *pprofWriter) string(s string) uint64 {
+	id, ok := w.strings[s]
+	if !ok {
+		id = uint64(len(w.table))
+		w.strings[s] = id
+		w.table = append(w.table, s)
+	}
+	return id
+}
+
+func (w *pprofWriter) function(r *RoutineProfile) uint64 {
+	id, ok := w.functions[r.Address]
+	if !ok {
+		id = uint64(len(w.functions) + 1)
+		w.functions[r.Address] = id
+		w.message(5, func(m *protoBuffer) {
+			m.uint64(1, id)
+			m.uint64(2, w.string(r.Name))
+			m.uint64(3, w.string(r.Name))
+		})
+	}
+	return id
+}
+
+// location returns the location of the instruction at addr in routine r.
+func (w *pprofWriter) location(addr uint16, r *RoutineProfile) uint64 {
+	key := pprofLocation{addr, r.Address}
+	id, ok := w.locations[key]
+	if !ok {
+		function := w.function(r)
+		id = uint64(len(w.locations) + 1)
+		w.locations[key] = id
+		w.message(4, func(m *protoBuffer) {
+			m.uint64(1, id)
+			m.uint64(2, 1)
+			m.uint64(3, uint64(addr))
+			m.message(4, func(line *protoBuffer) {
+				line.uint64(1, function)
+			})
+		})
+	}
+	return id
+}
+
+// samples adds a sample for every instruction executed by node and its children, the stacks going from the leaf up to the root.
+func (w *pprofWriter) samples(node *callNode) {
+	addrs := make([]uint16, 0, len(node.cycles))
+	for addr := range node.cycles {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+	for _, addr := range addrs {
+		stack := []uint64{w.location(addr, node.routine)}
+		for n := node; n.parent != nil; n = n.parent {
+			stack = append(stack, w.location(n.caller, n.parent.routine))
+		}
+		w.message(2, func(m *protoBuffer) {
+			m.packed(1, stack)
+			m.packed(2, []uint64{node.cycles[addr]})
+		})
+	}
+
+	children := make([]*callNode, 0, len(node.children))
+	for _, child := range node.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].caller != children[j].caller {
+			return children[i].caller < children[j].caller
+		}
+		return children[i].routine.Address < children[j].routine.Address
+	})
+	for _, child := range children {
+		w.samples(child)
+	}
+}
+
+// WriteProfile writes the cycles of every call stack as a gzipped pprof profile, for go tool pprof.
+// Functions are the routines, and locations the addresses of the instructions and calls.
+func (p *Profiler) WriteProfile(out io.Writer) error {
+	w := &pprofWriter{
+		strings:   map[string]uint64{},
+		functions: map[uint16]uint64{},
+		locations: map[pprofLocation]uint64{},
+	}
+	w.string("")
+	cycles, count := w.string("cycles"), w.string("count")
+	w.message(1, func(m *protoBuffer) {
+		m.uint64(1, cycles)
+		m.uint64(2, count)
+	})
+	w.message(3, func(m *protoBuffer) {
+		m.uint64(1, 1)
+		m.uint64(3, 0x10000)
+		m.uint64(5, w.string("6502"))
+		m.bool(7, true)
+	})
+	if p.root != nil {
+		w.samples(p.root)
+	}
+	handlers := make([]uint16, 0, len(p.handlers))
+	for addr := range p.handlers {
+		handlers = append(handlers, addr)
+	}
+	sort.Slice(handlers, func(i, j int) bool { return handlers[i] < handlers[j] })
+	for _, addr := range handlers {
+		w.samples(p.handlers[addr])
+	}
+
+	for _, s := range w.table {
+		w.bytes(6, []byte(s))
+	}
+	w.uint64(10, uint64(float64(p.Cycles)*1e9/NTSC_CPU_FREQUENCY))
+	w.message(11, func(m *protoBuffer) {
+		m.uint64(1, cycles)
+		m.uint64(2, count)
+	})
+	w.uint64(12, 1)
+
+	gz := gzip.NewWriter(out)
+	if _, err := gz.Write(w.protoBuffer); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,16 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtoBuffer(t *testing.T) {
+	var b protoBuffer
+	b.uint64(1, 150)
+	b.uint64(2, 0)
+	b.packed(4, []uint64{3, 270})
+	b.message(5, func(m *protoBuffer) { m.bool(1, true) })
+	assert.Equal(t, []byte{0x08, 0x96, 0x01, 0x22, 0x03, 0x03, 0x8e, 0x02, 0x2a, 0x02, 0x08, 0x01}, []byte(b))
+}
@@ -1,9 +1,5 @@
 package nes
 
-import (
-	"fmt"
-)
-
 type PPU struct {
 	CharacterRom       []uint8
 	PaletteTable       [32]uint8
@@ -53,6 +49,10 @@ type PPU struct {
 
 	scrollX uint8
 	scrollY uint8
+
+	faults faultLatch
+	hook   accessHook      // sees $2007 accesses, set by Console.attachHooks
+	cdl    *CodeDataLogger // sees the pattern fetches of the renderer
 }
 
 func NewPPU(characterRom []uint8, mirroring Mirroring) *PPU {
@@ -67,6 +67,17 @@ func NewPPU(characterRom []uint8, mirroring Mirroring) *PPU {
 	}
 }
 
+// Reset emulates the reset button.
+// https://www.nesdev.org/wiki/PPU_power_up_state
+func (p *PPU) Reset() {
+	p.WriteToPPUCTRL(0)
+	p.WriteToPPUMask(0)
+	p.w = 0
+	p.scrollX = 0
+	p.scrollY = 0
+	p.InternalDataBuffer = 0
+}
+
 func (p *PPU) WriteToPPUAddr(value uint8) {
 	// 15 14 13 12 11 10 9 8 7 6 5 4 3 2 1 0
 	// -  0  h  h  h  h  h h l l l l l l l l
@@ -211,47 +222,71 @@ func (p *PPU) VRAMAddrIncrement() uint8 {
 
 func (p *PPU) ReadData() uint8 {
 	addr := p.v
+	if p.hook != nil {
+		p.hook.onAccess(SPACE_PPU, addr&0x3fff, p.Peek(addr), false)
+	}
 	p.v += uint16(p.VRAMAddrIncrement())
 
 	var result uint8
 
+	// $4000-$7FFF mirrors $0000-$3FFF
+	addr &= 0x3fff
+
 	if addr <= 0x1fff {
 		result = p.InternalDataBuffer
-		p.InternalDataBuffer = p.CharacterRom[addr]
+		if int(addr) < len(p.CharacterRom) {
+			p.InternalDataBuffer = p.CharacterRom[addr]
+		}
 	} else if addr >= 0x2000 && addr <= 0x2fff {
 		result = p.InternalDataBuffer
 		p.InternalDataBuffer = p.VRAM[p.mirrorVRAMAddr(addr)]
 	} else if addr >= 0x3000 && addr <= 0x3eff {
-		panic(fmt.Sprintf("addr space 0x3000..0x3eff is not expected to be used, requested = %d", addr))
-	} else if addr >= 0x3f00 && addr <= 0x3fff {
-		result = p.PaletteTable[addr-0x3f00]
+		// mirror of $2000-$2EFF, which games are not expected to use
+		p.faults.fault(&AccessError{Addr: addr, Err: ErrUnusedPPUAddress})
+		result = p.InternalDataBuffer
+		p.InternalDataBuffer = p.VRAM[p.mirrorVRAMAddr(addr)]
 	} else {
-		panic(fmt.Sprintf("unexpected access to mirrored space %d", addr))
+		result = p.PaletteTable[p.mirrorPaletteAddr(addr)]
 	}
 	return result
 }
 
 func (p *PPU) WriteData(value uint8) {
-	addr := p.v
+	// $4000-$7FFF mirrors $0000-$3FFF
+	addr := p.v & 0x3fff
+	if p.hook != nil {
+		p.hook.onAccess(SPACE_PPU, addr, value, true)
+	}
 
 	if addr <= 0x1fff {
-		panic(fmt.Sprintf("attempt to write to character rom space: %d", addr))
+		p.faults.fault(&AccessError{Addr: addr, Write: true, Err: ErrCharacterROMWrite})
 	} else if addr >= 0x2000 && addr <= 0x2fff {
 		p.VRAM[p.mirrorVRAMAddr(addr)] = value
 	} else if addr >= 0x3000 && addr <= 0x3eff {
-		fmt.Println("not implemented")
-	} else if addr == 0x3f10 || addr == 0x3f14 || addr == 0x3f18 || addr == 0x3f1c {
-		addMirror := addr - 0x10
-		p.PaletteTable[addMirror-0x3f00] = value
-	} else if addr >= 0x3f00 && addr <= 0x3fff {
-		p.PaletteTable[addr-0x3f00] = value
+		// mirror of $2000-$2EFF, which games are not expected to use
+		p.faults.fault(&AccessError{Addr: addr, Write: true, Err: ErrUnusedPPUAddress})
+		p.VRAM[p.mirrorVRAMAddr(addr)] = value
 	} else {
-		panic(fmt.Sprintf("unexpected access to mirrored space %d", addr))
+		p.PaletteTable[p.mirrorPaletteAddr(addr)] = value
 	}
 
 	p.v += uint16(p.VRAMAddrIncrement())
 }
 
+// TakeError returns the first error raised since the last call, then clears it.
+func (p *PPU) TakeError() error {
+	return p.faults.take()
+}
+
+// $3F20-$3FFF mirrors $3F00-$3F1F, and $3F10/$3F14/$3F18/$3F1C mirror $3F00/$3F04/$3F08/$3F0C
+func (p *PPU) mirrorPaletteAddr(addr uint16) uint16 {
+	index := (addr - 0x3f00) % 32
+	if index == 0x10 || index == 0x14 || index == 0x18 || index == 0x1c {
+		index -= 0x10
+	}
+	return index
+}
+
 // Horizontal:
 //
 //	[ A ] [ a ]
@@ -292,6 +327,42 @@ func (p *PPU) ReadStatus() uint8 {
 	return result
 }
 
+// patternTile returns the 16 bytes of the tile at addr in the pattern tables, as fetched for rendering.
+func (p *PPU) patternTile(addr uint16) []uint8 {
+	if p.cdl != nil {
+		p.cdl.logRendered(addr, 16)
+	}
+	return p.CharacterRom[addr : addr+16]
+}
+
+// PeekStatus returns what ReadStatus would return without clearing vblank and the write toggle.
+func (p *PPU) PeekStatus() uint8 {
+	return p.flagSpriteOverflow<<5 | p.flagSpriteZeroHit<<6 | p.flagVblankStarted<<7
+}
+
+// PeekData returns what ReadData would return without moving the address or filling the buffer.
+func (p *PPU) PeekData() uint8 {
+	addr := p.v & 0x3fff
+	if addr >= 0x3f00 {
+		return p.PaletteTable[p.mirrorPaletteAddr(addr)]
+	}
+	return p.InternalDataBuffer
+}
+
+// Peek returns the byte at addr in the PPU address space, bypassing the read buffer of $2007.
+func (p *PPU) Peek(addr uint16) uint8 {
+	addr &= 0x3fff
+	if addr <= 0x1fff {
+		if int(addr) < len(p.CharacterRom) {
+			return p.CharacterRom[addr]
+		}
+		return 0
+	} else if addr <= 0x3eff {
+		return p.VRAM[p.mirrorVRAMAddr(addr)]
+	}
+	return p.PaletteTable[p.mirrorPaletteAddr(addr)]
+}
+
 func (p *PPU) Tick(cycles uint8) bool {
 	p.Cycles += uint(cycles)
 	if p.Cycles >= 341 {
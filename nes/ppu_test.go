@@ -194,3 +194,30 @@ func TestOAMDMA(t *testing.T) {
 	ppu.WriteToPPUOAMAddr(0x11)
 	assert.Equal(t, uint8(0x66), ppu.ReadOAMData())
 }
+
+func TestPPUState(t *testing.T) {
+	ppu := NewPPU(nil, MIRROR_HORIZONTAL)
+	ppu.WriteToPPUAddr(0x23)
+
+	state := ppu.State()
+	assert.Equal(t, uint16(0x2300), state.T)
+	assert.Equal(t, uint8(1), state.W)
+
+	state.V = 0x2305
+	state.W = 0
+	ppu.SetState(state)
+	ppu.WriteData(0x66)
+	assert.Equal(t, uint8(0x66), ppu.VRAM[0x0305])
+	assert.Equal(t, uint16(0x2306), ppu.State().V)
+}
+
+func TestPPUCharacterRomWriteIsReported(t *testing.T) {
+	ppu := NewPPU(make([]uint8, CHARACTER_ROM_PAGE_SIZE), MIRROR_HORIZONTAL)
+	ppu.WriteToPPUAddr(0x00)
+	ppu.WriteToPPUAddr(0x10)
+	ppu.WriteData(0x66)
+
+	assert.Equal(t, uint8(0x00), ppu.CharacterRom[0x10])
+	assert.ErrorIs(t, ppu.TakeError(), ErrCharacterROMWrite)
+	assert.NoError(t, ppu.TakeError())
+}
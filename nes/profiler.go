@@ -0,0 +1,221 @@
+package nes
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// RoutineProfile is what a Profiler measured of a subroutine or interrupt handler.
+type RoutineProfile struct {
+	Address   uint16 // entry point
+	Name      string // symbol of the entry point, or its address
+	Calls     uint64
+	Exclusive uint64 // cycles spent in the routine itself
+	Inclusive uint64 // cycles spent in the routine and the ones it called
+	MaxFrame  uint64 // most inclusive cycles in a single frame
+
+	frame uint64 // inclusive cycles in the current frame
+	mark  uint64 // instruction whose cycles were last added to Inclusive, to count recursive calls once
+}
+
+// callNode is a call stack: the routine being executed, and the nodes of the routines it called.
+type callNode struct {
+	routine  *RoutineProfile
+	caller   uint16 // the JSR, BRK or interrupted instruction in the parent
+	parent   *callNode
+	children map[callSite]*callNode
+	cycles   map[uint16]uint64 // cycles of every instruction executed with this call stack
+}
+
+type callSite struct {
+	caller uint16
+	target uint16
+}
+
+type profileFrame struct {
+	CallFrame
+	node *callNode
+}
+
+// Profiler attributes the CPU cycles to the subroutines executing them, following JSR, RTS, and the interrupts
+// like the call stack of the Debugger. Code not called by any tracked JSR is attributed to the reset routine,
+// and interrupt handlers start call stacks of their own rather than being counted in the routines they interrupt.
+type Profiler struct {
+	Frames uint   // frames fully profiled
+	Cycles uint64 // cycles profiled
+
+	console  *Console
+	routines map[uint16]*RoutineProfile
+	root     *callNode
+	handlers map[uint16]*callNode // roots of the interrupt handlers
+	stack    []profileFrame
+	count    uint64 // instructions profiled
+
+	callTracker      // the instruction being executed
+	cycles      uint // Bus.Cycles before it
+}
+
+// AttachProfiler returns the profiler of the console, attaching one if needed.
+// It is kept by power cycles, and starts over when another ROM is loaded.
+// It can be attached before the first ROM is loaded.
+func (c *Console) AttachProfiler() *Profiler {
+	if c.profiler == nil {
+		c.profiler = &Profiler{console: c}
+		c.profiler.Reset()
+	}
+	return c.profiler
+}
+
+func (c *Console) DetachProfiler() {
+	c.profiler = nil
+}
+
+func (c *Console) Profiler() *Profiler {
+	return c.profiler
+}
+
+// Reset forgets everything measured so far.
+func (p *Profiler) Reset() {
+	p.Frames, p.Cycles = 0, 0
+	p.routines = map[uint16]*RoutineProfile{}
+	p.root = nil
+	// without a ROM there is no reset vector yet, LoadROM resets the profiler again
+	if p.console.CPU != nil {
+		p.root = p.newNode(p.routine(p.console.CPU.peek16(0xfffc)), 0, nil)
+	}
+	p.handlers = map[uint16]*callNode{}
+	p.reset()
+}
+
+// reset forgets the call stack after a power cycle or loading a state.
+func (p *Profiler) reset() {
+	p.stack = p.stack[:0]
+	for _, r := range p.routines {
+		r.frame = 0
+	}
+}
+
+func (p *Profiler) routine(addr uint16) *RoutineProfile {
+	r, ok := p.routines[addr]
+	if !ok {
+		r = &RoutineProfile{Address: addr, Name: fmt.Sprintf("$%04X", addr)}
+		if name, ok := p.console.Bus.SymbolName(addr); ok {
+			r.Name = name
+		}
+		p.routines[addr] = r
+	}
+	return r
+}
+
+func (p *Profiler) newNode(routine *RoutineProfile, caller uint16, parent *callNode) *callNode {
+	return &callNode{routine: routine, caller: caller, parent: parent, children: map[callSite]*callNode{}, cycles: map[uint16]uint64{}}
+}
+
+func (p *Profiler) node() *callNode {
+	if len(p.stack) == 0 {
+		return p.root
+	}
+	return p.stack[len(p.stack)-1].node
+}
+
+func (p *Profiler) push(frame CallFrame) {
+	var node *callNode
+	if frame.Kind == CALL_JSR {
+		parent := p.node()
+		site := callSite{frame.Caller, frame.Target}
+		node = parent.children[site]
+		if node == nil {
+			node = p.newNode(p.routine(frame.Target), frame.Caller, parent)
+			parent.children[site] = node
+		}
+	} else {
+		node = p.handlers[frame.Target]
+		if node == nil {
+			node = p.newNode(p.routine(frame.Target), 0, nil)
+			p.handlers[frame.Target] = node
+		}
+	}
+	node.routine.Calls++
+	p.stack = append(p.stack, profileFrame{frame, node})
+}
+
+func (p *Profiler) beforeInstruction() {
+	p.before(p.console)
+	p.cycles = p.console.Bus.Cycles
+}
+
+func (p *Profiler) afterInstruction() {
+	cpu := p.console.CPU
+	interrupt, call := p.calls(cpu)
+	if interrupt != nil {
+		p.push(*interrupt)
+	}
+	// the cycles of the NMI go to its handler, those of a JSR to the caller
+	p.addCycles(uint64(p.console.Bus.Cycles - p.cycles))
+	if call != nil {
+		p.push(*call)
+	}
+	for len(p.stack) > 0 && returned(cpu, p.stack[len(p.stack)-1].CallFrame) {
+		p.stack = p.stack[:len(p.stack)-1]
+	}
+}
+
+// addCycles attributes the cycles of the instruction at pc to the routines of the call stack.
+func (p *Profiler) addCycles(cycles uint64) {
+	p.count++
+	p.Cycles += cycles
+	node := p.node()
+	node.cycles[p.pc] += cycles
+	node.routine.Exclusive += cycles
+	for n := node; n != nil; n = n.parent {
+		if r := n.routine; r.mark != p.count {
+			r.mark = p.count
+			r.Inclusive += cycles
+			r.frame += cycles
+		}
+	}
+}
+
+func (p *Profiler) endFrame() {
+	p.Frames++
+	for _, r := range p.routines {
+		r.MaxFrame = max(r.MaxFrame, r.frame)
+		r.frame = 0
+	}
+}
+
+// Routines returns the profiles of the routines executed, most inclusive cycles first.
+func (p *Profiler) Routines() []RoutineProfile {
+	routines := make([]RoutineProfile, 0, len(p.routines))
+	for _, r := range p.routines {
+		if r.Inclusive > 0 {
+			routines = append(routines, *r)
+		}
+	}
+	sort.Slice(routines, func(i, j int) bool {
+		if routines[i].Inclusive != routines[j].Inclusive {
+			return routines[i].Inclusive > routines[j].Inclusive
+		}
+		return routines[i].Address < routines[j].Address
+	})
+	return routines
+}
+
+// WriteReport writes a table of the cycles per frame of every routine, most inclusive cycles first.
+func (p *Profiler) WriteReport(w io.Writer) error {
+	frames := uint64(max(p.Frames, 1))
+	if _, err := fmt.Fprintf(w, "%d frames, %d cycles per frame\n", p.Frames, p.Cycles/frames); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%10s %10s %10s %10s  %s\n", "incl/frame", "excl/frame", "max/frame", "calls", "routine"); err != nil {
+		return err
+	}
+	for _, r := range p.Routines() {
+		_, err := fmt.Fprintf(w, "%10d %10d %10d %10d  %s\n", r.Inclusive/frames, r.Exclusive/frames, r.MaxFrame, r.Calls, r.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package nes_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"go-nes/asm"
+	"go-nes/nes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const profilerTestProgram = `
+	JSR outer
+loop:
+	JMP loop
+outer:
+	JSR inner
+	LDA #$00
+	RTS
+inner:
+	NOP
+	RTS
+`
+
+func createTestConsoleForProfilerTest(t *testing.T) (*nes.Console, *asm.Assembly) {
+	t.Helper()
+	assembly, err := asm.Assemble(profilerTestProgram, 0x8000)
+	assert.NoError(t, err)
+	console := nes.NewConsole()
+	assert.NoError(t, console.LoadROM(nes.CreateTestROMForConsoleTest(assembly.Code)))
+	console.Symbols.Add(nes.Symbol{Name: "inner", Address: assembly.Labels["inner"], ROMOffset: int(assembly.Labels["inner"] - 0x8000)})
+	return console, assembly
+}
+
+func TestProfiler(t *testing.T) {
+	console, assembly := createTestConsoleForProfilerTest(t)
+	p := console.AttachProfiler()
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, console.StepInstruction())
+	}
+
+	want := []nes.RoutineProfile{
+		// JSR outer, JMP loop
+		{Address: 0x8000, Name: "$8000", Exclusive: 6 + 3, Inclusive: 6 + 22 + 3},
+		// JSR inner, LDA #$00, RTS
+		{Address: assembly.Labels["outer"], Name: "$8006", Calls: 1, Exclusive: 6 + 2 + 6, Inclusive: 22},
+		// NOP, RTS
+		{Address: assembly.Labels["inner"], Name: "inner", Calls: 1, Exclusive: 2 + 6, Inclusive: 8},
+	}
+	var got []nes.RoutineProfile
+	for _, r := range p.Routines() {
+		// without the unexported counters
+		got = append(got, nes.RoutineProfile{Address: r.Address, Name: r.Name, Calls: r.Calls, Exclusive: r.Exclusive, Inclusive: r.Inclusive, MaxFrame: r.MaxFrame})
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, uint64(31), p.Cycles)
+}
+
+func TestProfilerFrames(t *testing.T) {
+	console := nes.CreateTestConsoleForDebuggerTest(t)
+	p := console.AttachProfiler()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, console.StepFrame())
+	}
+	assert.Equal(t, uint(3), p.Frames)
+
+	routines := map[uint16]nes.RoutineProfile{}
+	for _, r := range p.Routines() {
+		routines[r.Address] = r
+	}
+	nmi := routines[0x8030]
+	assert.Equal(t, uint64(2), nmi.Calls)
+	// INC $11, RTI and the interrupt
+	assert.Greater(t, nmi.MaxFrame, uint64(5+6))
+	assert.Equal(t, 2*nmi.MaxFrame, nmi.Exclusive)
+	// the interrupted subroutines don't include the handler
+	assert.Equal(t, routines[0x8020].Exclusive, routines[0x8020].Inclusive)
+	assert.Equal(t, p.Cycles, routines[0x8000].Inclusive+nmi.Inclusive)
+
+	var report strings.Builder
+	assert.NoError(t, p.WriteReport(&report))
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	assert.Len(t, lines, 2+len(routines))
+	assert.True(t, strings.HasPrefix(lines[0], "3 frames, "), lines[0])
+	assert.True(t, strings.HasSuffix(lines[2], "  $8000"), lines[2])
+
+	assert.NoError(t, console.HardReset())
+	assert.Same(t, p, console.Profiler())
+	assert.NoError(t, console.StepFrame())
+	assert.Equal(t, uint(4), p.Frames)
+	p.Reset()
+	assert.Empty(t, p.Routines())
+}
+
+func TestProfilerWriteProfile(t *testing.T) {
+	console, _ := createTestConsoleForProfilerTest(t)
+	p := console.AttachProfiler()
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, console.StepInstruction())
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, p.WriteProfile(&out))
+	gz, err := gzip.NewReader(&out)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+
+	// the string table, the first string being empty
+	assert.Contains(t, string(data), "\x32\x00\x32\x06cycles\x32\x05count")
+	assert.Contains(t, string(data), "\x32\x05inner")
+	assert.Contains(t, string(data), "\x32\x05$8006")
+}
+
+func TestProfilerAttachedBeforeLoadROM(t *testing.T) {
+	console := nes.NewConsole()
+	p := console.AttachProfiler()
+	assert.Empty(t, p.Routines())
+	assert.NoError(t, p.WriteProfile(io.Discard))
+
+	assembly, err := asm.Assemble(profilerTestProgram, 0x8000)
+	assert.NoError(t, err)
+	assert.NoError(t, console.LoadROM(nes.CreateTestROMForConsoleTest(assembly.Code)))
+	assert.Same(t, p, console.Profiler())
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, console.StepInstruction())
+	}
+	assert.Equal(t, uint64(31), p.Cycles)
+	assert.Len(t, p.Routines(), 3)
+}
+
+func TestProfilerSkipsRewindReplay(t *testing.T) {
+	console := nes.CreateTestConsoleForDebuggerTest(t)
+	console.EnableRewind(4, 1<<20)
+	p := console.AttachProfiler()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, console.StepFrame())
+	}
+	frames, cycles := p.Frames, p.Cycles
+	assert.NoError(t, console.RewindFrame())
+	assert.Equal(t, frames, p.Frames)
+	assert.Equal(t, cycles, p.Cycles)
+
+	assert.NoError(t, console.StepFrame())
+	assert.Equal(t, frames+1, p.Frames)
+}
@@ -0,0 +1,106 @@
+package nes
+
+// SearchComparison selects which candidates RAMSearch.Filter keeps.
+type SearchComparison int
+
+const (
+	SEARCH_EQUAL     SearchComparison = iota // unchanged since the last snapshot
+	SEARCH_CHANGED                           // changed since the last snapshot
+	SEARCH_INCREASED                         // greater than at the last snapshot
+	SEARCH_DECREASED                         // less than at the last snapshot
+)
+
+// RAMSearch narrows down the addresses of CPU RAM ($0000-$07FF) and PRG-RAM ($6000-$7FFF)
+// holding a game variable, like the RAM search of FCEUX.
+// Every filter compares the current values with the previous snapshot and then takes a new one.
+type RAMSearch struct {
+	console    *Console
+	candidates []uint16
+	previous   map[uint16]uint8
+}
+
+type SearchResult struct {
+	Address  uint16
+	Previous uint8
+	Current  uint8
+}
+
+func NewRAMSearch(console *Console) *RAMSearch {
+	s := &RAMSearch{console: console}
+	s.Reset()
+	return s
+}
+
+// Reset makes every address a candidate again and takes a snapshot.
+func (s *RAMSearch) Reset() {
+	s.candidates = s.candidates[:0]
+	for addr := uint16(0); addr < 0x0800; addr++ {
+		s.candidates = append(s.candidates, addr)
+	}
+	for addr := uint16(0x6000); addr < 0x8000; addr++ {
+		s.candidates = append(s.candidates, addr)
+	}
+	s.snapshot()
+}
+
+func (s *RAMSearch) Filter(comparison SearchComparison) {
+	s.filter(func(previous, current uint8) bool {
+		switch comparison {
+		case SEARCH_EQUAL:
+			return current == previous
+		case SEARCH_CHANGED:
+			return current != previous
+		case SEARCH_INCREASED:
+			return current > previous
+		case SEARCH_DECREASED:
+			return current < previous
+		}
+		return false
+	})
+}
+
+// FilterValue keeps the candidates currently holding value.
+func (s *RAMSearch) FilterValue(value uint8) {
+	s.filter(func(previous, current uint8) bool {
+		return current == value
+	})
+}
+
+func (s *RAMSearch) filter(keep func(previous, current uint8) bool) {
+	matches := s.candidates[:0]
+	for _, addr := range s.candidates {
+		if keep(s.previous[addr], s.read(addr)) {
+			matches = append(matches, addr)
+		}
+	}
+	s.candidates = matches
+	s.snapshot()
+}
+
+func (s *RAMSearch) Len() int {
+	return len(s.candidates)
+}
+
+// Results returns the remaining candidates with their values at the last snapshot and now.
+func (s *RAMSearch) Results() []SearchResult {
+	results := make([]SearchResult, len(s.candidates))
+	for i, addr := range s.candidates {
+		results[i] = SearchResult{
+			Address:  addr,
+			Previous: s.previous[addr],
+			Current:  s.read(addr),
+		}
+	}
+	return results
+}
+
+func (s *RAMSearch) snapshot() {
+	s.previous = make(map[uint16]uint8, len(s.candidates))
+	for _, addr := range s.candidates {
+		s.previous[addr] = s.read(addr)
+	}
+}
+
+func (s *RAMSearch) read(addr uint16) uint8 {
+	return s.console.Bus.Peek(addr)
+}
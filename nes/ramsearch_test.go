@@ -0,0 +1,45 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRAMSearch(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest([]uint8{0x4c, 0x00, 0x80})))
+	ram := &console.Bus.CpuVRAM
+
+	lives := uint16(0x0032)
+	ram[lives] = 3
+	ram[0x0100] = 3
+	console.Cartridge.ProgramRam[0x10] = 3
+
+	search := NewRAMSearch(console)
+	assert.Equal(t, 0x800+0x2000, search.Len())
+
+	search.FilterValue(3)
+	assert.Equal(t, 3, search.Len())
+
+	ram[lives] = 2
+	ram[0x0100] = 4
+	search.Filter(SEARCH_CHANGED)
+	assert.Equal(t, 2, search.Len())
+
+	ram[lives] = 1
+	ram[0x0100] = 5
+	search.Filter(SEARCH_DECREASED)
+	assert.Equal(t, []SearchResult{{Address: lives, Previous: 1, Current: 1}}, search.Results())
+
+	ram[lives] = 1
+	search.Filter(SEARCH_EQUAL)
+	assert.Equal(t, 1, search.Len())
+	search.Filter(SEARCH_INCREASED)
+	assert.Zero(t, search.Len())
+
+	search.Reset()
+	console.Cartridge.ProgramRam[0x10] = 4
+	search.Filter(SEARCH_INCREASED)
+	assert.Equal(t, []SearchResult{{Address: 0x6010, Previous: 4, Current: 4}}, search.Results())
+}
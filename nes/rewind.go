@@ -0,0 +1,216 @@
+package nes
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+)
+
+var ErrRewindEmpty = errors.New("no earlier frame to rewind to")
+
+// rewindBuffer keeps save states taken every interval frames and the input of every frame since the oldest one.
+//
+// Only the newest state is kept as is. Each older state is stored as the deflated XOR against the next
+// newer one, which is mostly zero as few bytes change between snapshots. Going back one snapshot is
+// therefore a single XOR, and the oldest snapshot can be dropped at any time to stay within budget.
+type rewindBuffer struct {
+	interval uint
+	budget   int
+
+	latest      []uint8
+	latestFrame uint
+	older       []rewindDelta
+	size        int
+
+	inputBase uint // frame of inputs[0]
+	inputs    []MovieFrame
+}
+
+type rewindDelta struct {
+	frame uint
+	data  []uint8
+}
+
+// EnableRewind starts recording a snapshot every interval frames, keeping at most budget bytes of snapshots.
+func (c *Console) EnableRewind(interval uint, budget int) {
+	if interval == 0 {
+		interval = 1
+	}
+	c.rewind = &rewindBuffer{
+		interval: interval,
+		budget:   budget,
+	}
+}
+
+func (c *Console) DisableRewind() {
+	c.rewind = nil
+}
+
+// RewindFrame moves the console one frame back.
+// It restores the closest snapshot and re-emulates the recorded input up to the previous frame.
+func (c *Console) RewindFrame() error {
+	r := c.rewind
+	if r == nil || r.latest == nil || c.FrameCount == 0 || c.FrameCount-1 < r.oldestFrame() {
+		return ErrRewindEmpty
+	}
+	target := c.FrameCount - 1
+	// replayed frames were already debugged, traced and profiled
+	c.replaying = true
+	defer func() { c.replaying = false }()
+
+	for r.latestFrame > target {
+		if err := r.pop(); err != nil {
+			return err
+		}
+	}
+	if err := c.loadState(bytes.NewReader(r.latest)); err != nil {
+		return err
+	}
+	r.truncateInputs(target)
+
+	for c.FrameCount < target {
+		input := r.inputs[c.FrameCount-r.inputBase]
+		// the reset of the snapshot frame happened before the snapshot was taken.
+		// A power cycle clears the buffer, so it can only be on the snapshot frame.
+		if c.FrameCount != r.latestFrame && input.Command&MOVIE_COMMAND_RESET != 0 {
+			if err := c.Reset(); err != nil {
+				return err
+			}
+		}
+		c.SetButtons(0, input.Buttons[0])
+		c.SetButtons(1, input.Buttons[1])
+		if err := c.stepFrame(); err != nil {
+			return err
+		}
+	}
+	c.seekMovie()
+	return c.frame.Render(c.Bus.PPU)
+}
+
+// record is called before each frame is emulated, with the command already executed for it.
+func (r *rewindBuffer) record(c *Console, command uint8) error {
+	if c.FrameCount%r.interval == 0 && (r.latest == nil || c.FrameCount > r.latestFrame) {
+		var state bytes.Buffer
+		if err := c.SaveState(&state); err != nil {
+			return err
+		}
+		if err := r.push(c.FrameCount, state.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if len(r.inputs) == 0 {
+		r.inputBase = c.FrameCount
+	}
+	r.inputs = append(r.inputs[:c.FrameCount-r.inputBase], MovieFrame{
+		Command: command,
+		Buttons: [2]uint8{c.Bus.JoyPad1.Buttons(), c.Bus.JoyPad2.Buttons()},
+	})
+	return nil
+}
+
+func (r *rewindBuffer) push(frame uint, state []uint8) error {
+	if r.latest != nil {
+		if len(state) != len(r.latest) {
+			// the layout changed, older snapshots can't be reconstructed any more
+			r.older = nil
+			r.size = 0
+		} else {
+			delta, err := deflateXOR(r.latest, state)
+			if err != nil {
+				return err
+			}
+			r.older = append(r.older, rewindDelta{frame: r.latestFrame, data: delta})
+			r.size += len(delta)
+		}
+	}
+	r.latest = state
+	r.latestFrame = frame
+
+	for len(r.older) > 0 && r.size+len(r.latest) > r.budget {
+		r.size -= len(r.older[0].data)
+		r.older = r.older[1:]
+	}
+	r.dropInputsBefore(r.oldestFrame())
+	return nil
+}
+
+func (r *rewindBuffer) pop() error {
+	if len(r.older) == 0 {
+		return ErrRewindEmpty
+	}
+	delta := r.older[len(r.older)-1]
+	r.older = r.older[:len(r.older)-1]
+	r.size -= len(delta.data)
+
+	state, err := inflateXOR(r.latest, delta.data)
+	if err != nil {
+		return err
+	}
+	r.latest = state
+	r.latestFrame = delta.frame
+	return nil
+}
+
+func (r *rewindBuffer) oldestFrame() uint {
+	if len(r.older) > 0 {
+		return r.older[0].frame
+	}
+	return r.latestFrame
+}
+
+func (r *rewindBuffer) truncateInputs(frame uint) {
+	if frame < r.inputBase {
+		r.inputs = r.inputs[:0]
+		return
+	}
+	if n := int(frame - r.inputBase); n < len(r.inputs) {
+		r.inputs = r.inputs[:n]
+	}
+}
+
+func (r *rewindBuffer) dropInputsBefore(frame uint) {
+	if frame <= r.inputBase {
+		return
+	}
+	n := int(frame - r.inputBase)
+	if n > len(r.inputs) {
+		n = len(r.inputs)
+	}
+	r.inputs = r.inputs[n:]
+	r.inputBase = frame
+}
+
+func deflateXOR(a, b []uint8) ([]uint8, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	x := make([]uint8, len(a))
+	for i := range a {
+		x[i] = a[i] ^ b[i]
+	}
+	if _, err := w.Write(x); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func inflateXOR(base, delta []uint8) ([]uint8, error) {
+	x, err := io.ReadAll(flate.NewReader(bytes.NewReader(delta)))
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != len(base) {
+		return nil, ErrInvalidState
+	}
+	for i := range x {
+		x[i] ^= base[i]
+	}
+	return x, nil
+}
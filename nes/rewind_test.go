@@ -0,0 +1,68 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loop: INC $10, strobe and read joypad 1, ADC $11, STA $11, JMP loop
+var rewindTestProgram = []uint8{
+	0xe6, 0x10,
+	0xa9, 0x01, 0x8d, 0x16, 0x40,
+	0xa9, 0x00, 0x8d, 0x16, 0x40,
+	0xad, 0x16, 0x40,
+	0x65, 0x11,
+	0x85, 0x11,
+	0x4c, 0x00, 0x80,
+}
+
+func TestConsoleRewindFrame(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	console.EnableRewind(4, 1<<20)
+
+	type frameState struct {
+		cpu CPUState
+		ram [2048]uint8
+	}
+	states := []frameState{{console.CPU.State(), console.Bus.CpuVRAM}}
+	for i := 0; i < 20; i++ {
+		console.SetButtons(0, uint8(i/3%2)<<JOYPAD_A)
+		assert.NoError(t, console.StepFrame())
+		states = append(states, frameState{console.CPU.State(), console.Bus.CpuVRAM})
+	}
+
+	for frame := 19; frame >= 0; frame-- {
+		assert.NoError(t, console.RewindFrame())
+		assert.Equal(t, uint(frame), console.FrameCount)
+		assert.Equal(t, states[frame], frameState{console.CPU.State(), console.Bus.CpuVRAM}, "frame %d", frame)
+	}
+	assert.ErrorIs(t, console.RewindFrame(), ErrRewindEmpty)
+
+	// emulation continues from the rewound frame
+	console.SetButtons(0, 0)
+	assert.NoError(t, console.StepFrame())
+	assert.Equal(t, states[1], frameState{console.CPU.State(), console.Bus.CpuVRAM})
+}
+
+func TestConsoleRewindBudget(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	console.EnableRewind(1, 1)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, console.StepFrame())
+	}
+	// only the newest snapshot fits, taken before frame 5 was emulated
+	assert.NoError(t, console.RewindFrame())
+	assert.Equal(t, uint(4), console.FrameCount)
+	assert.ErrorIs(t, console.RewindFrame(), ErrRewindEmpty)
+}
+
+func TestConsoleRewindWithoutEnable(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	assert.NoError(t, console.StepFrame())
+	assert.ErrorIs(t, console.RewindFrame(), ErrRewindEmpty)
+}
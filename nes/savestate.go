@@ -0,0 +1,356 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Save state format (little endian):
+//
+//	"GNES" magic
+//	uint32 version
+//	uint32 CRC32 of PRG-ROM and CHR-ROM
+//	chunks: [4]byte tag, uint32 length, payload
+//
+// Every payload is one of the *Snapshot structs below, encoded with encoding/binary.
+// Unknown chunks are skipped so that newer components can be added without a version bump.
+// Changing the layout of an existing snapshot requires bumping SAVE_STATE_VERSION.
+const (
+	SAVE_STATE_MAGIC   = "GNES"
+	SAVE_STATE_VERSION = 1
+)
+
+var (
+	ErrInvalidState  = errors.New("invalid save state")
+	ErrStateVersion  = errors.New("unsupported save state version")
+	ErrStateMismatch = errors.New("save state was made with a different ROM")
+)
+
+type cpuSnapshot struct {
+	A, X, Y, P, SP uint8
+	PC             uint16
+}
+
+type ppuSnapshot struct {
+	PaletteTable       [32]uint8
+	VRAM               [2048]uint8
+	OAMData            [256]uint8
+	OAMAddress         uint8
+	InternalDataBuffer uint8
+	Scanline           uint16
+	Cycles             uint64
+	NMIInterrupt       bool
+	V, T               uint16
+	X, W, F            uint8
+	Ctrl, Mask         uint8
+	SpriteOverflow     uint8
+	SpriteZeroHit      uint8
+	VblankStarted      uint8
+	ScrollX, ScrollY   uint8
+}
+
+type busSnapshot struct {
+	CpuVRAM     [2048]uint8
+	Cycles      uint64
+	VblankCount uint64
+	RenderFlag  bool
+	FrameCount  uint64
+}
+
+type joypadSnapshot struct {
+	Strobe       bool
+	ButtonIndex  uint8
+	ButtonStatus [8]bool
+}
+
+type cartridgeSnapshot struct {
+	ProgramRam [PROGRAM_RAM_SIZE]uint8
+}
+
+// SaveState writes the whole machine state.
+// The APU is not emulated and NROM has no mapper registers, so neither has a chunk yet.
+func (c *Console) SaveState(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString(SAVE_STATE_MAGIC)
+	binary.Write(&buf, binary.LittleEndian, uint32(SAVE_STATE_VERSION))
+	binary.Write(&buf, binary.LittleEndian, c.romChecksum())
+
+	chunks := []struct {
+		tag  string
+		data any
+	}{
+		{"CPU ", c.CPU.snapshot()},
+		{"PPU ", c.Bus.PPU.snapshot()},
+		{"BUS ", c.busSnapshot()},
+		{"JOY1", c.Bus.JoyPad1.snapshot()},
+		{"JOY2", c.Bus.JoyPad2.snapshot()},
+		{"CART", c.Cartridge.snapshot()},
+	}
+	for _, chunk := range chunks {
+		buf.WriteString(chunk.tag)
+		binary.Write(&buf, binary.LittleEndian, uint32(binary.Size(chunk.data)))
+		if err := binary.Write(&buf, binary.LittleEndian, chunk.data); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// LoadState restores a state written by SaveState for the same ROM.
+// The console is left untouched when an error is returned.
+func (c *Console) LoadState(r io.Reader) error {
+	if err := c.loadState(r); err != nil {
+		return err
+	}
+	// the recorded history no longer leads to the current state
+	if c.rewind != nil {
+		c.EnableRewind(c.rewind.interval, c.rewind.budget)
+	}
+	c.seekMovie()
+	return nil
+}
+
+func (c *Console) loadState(r io.Reader) error {
+	var header struct {
+		Magic    [4]byte
+		Version  uint32
+		Checksum uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	if string(header.Magic[:]) != SAVE_STATE_MAGIC {
+		return ErrInvalidState
+	}
+	if header.Version != SAVE_STATE_VERSION {
+		return fmt.Errorf("%w: %d", ErrStateVersion, header.Version)
+	}
+	if header.Checksum != c.romChecksum() {
+		return ErrStateMismatch
+	}
+
+	var (
+		cpu       cpuSnapshot
+		ppu       ppuSnapshot
+		bus       busSnapshot
+		joypad1   joypadSnapshot
+		joypad2   joypadSnapshot
+		cartridge cartridgeSnapshot
+	)
+	targets := map[string]any{
+		"CPU ": &cpu,
+		"PPU ": &ppu,
+		"BUS ": &bus,
+		"JOY1": &joypad1,
+		"JOY2": &joypad2,
+		"CART": &cartridge,
+	}
+	found := map[string]bool{}
+
+	for {
+		var chunk struct {
+			Tag    [4]byte
+			Length uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+
+		payload := make([]uint8, chunk.Length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+
+		tag := string(chunk.Tag[:])
+		target, ok := targets[tag]
+		if !ok {
+			continue
+		}
+		if int(chunk.Length) != binary.Size(target) {
+			return fmt.Errorf("%w: chunk %q has length %d", ErrInvalidState, tag, chunk.Length)
+		}
+		if err := binary.Read(bytes.NewReader(payload), binary.LittleEndian, target); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		found[tag] = true
+	}
+
+	for tag := range targets {
+		if !found[tag] {
+			return fmt.Errorf("%w: missing chunk %q", ErrInvalidState, tag)
+		}
+	}
+
+	c.CPU.restore(cpu)
+	c.Bus.PPU.restore(ppu)
+	c.restoreBus(bus)
+	c.Bus.JoyPad1.restore(joypad1)
+	c.Bus.JoyPad2.restore(joypad2)
+	c.Cartridge.restore(cartridge)
+	c.midFrame = false
+	if c.debugger != nil {
+		c.debugger.callStack = nil
+	}
+	if c.profiler != nil {
+		c.profiler.reset()
+	}
+	return nil
+}
+
+// romChecksum identifies the ROM as loaded, ignoring the patches made since.
+func (c *Console) romChecksum() uint32 {
+	return c.romCRC
+}
+
+func cartridgeChecksum(cartridge *Cartridge) uint32 {
+	crc := crc32.NewIEEE()
+	crc.Write(cartridge.ProgramRom)
+	crc.Write(cartridge.CharacterRom)
+	return crc.Sum32()
+}
+
+func (c *Console) busSnapshot() busSnapshot {
+	return busSnapshot{
+		CpuVRAM:     c.Bus.CpuVRAM,
+		Cycles:      uint64(c.Bus.Cycles),
+		VblankCount: uint64(c.Bus.VblankCount),
+		RenderFlag:  c.Bus.RenderFlag,
+		FrameCount:  uint64(c.FrameCount),
+	}
+}
+
+func (c *Console) restoreBus(s busSnapshot) {
+	c.Bus.CpuVRAM = s.CpuVRAM
+	c.Bus.Cycles = uint(s.Cycles)
+	c.Bus.VblankCount = uint(s.VblankCount)
+	c.Bus.RenderFlag = s.RenderFlag
+	c.FrameCount = uint(s.FrameCount)
+}
+
+func (c *CPU) snapshot() cpuSnapshot {
+	return cpuSnapshot{
+		A:  c.registerA,
+		X:  c.registerX,
+		Y:  c.registerY,
+		P:  c.status,
+		SP: c.stackPointer,
+		PC: c.programCounter,
+	}
+}
+
+func (c *CPU) restore(s cpuSnapshot) {
+	c.registerA = s.A
+	c.registerX = s.X
+	c.registerY = s.Y
+	c.status = s.P
+	c.stackPointer = s.SP
+	c.programCounter = s.PC
+}
+
+func (p *PPU) snapshot() ppuSnapshot {
+	ctrl := p.flagNameTable |
+		p.flagIncrement<<2 |
+		p.flagSpriteTable<<3 |
+		p.flagBackgroundTable<<4 |
+		p.flagSpriteSize<<5 |
+		p.flagMasterSlave<<6
+	if p.flagNMI {
+		ctrl |= 1 << 7
+	}
+	mask := p.flagGrayscale |
+		p.flagShowBackgroundLeftMost8px<<1 |
+		p.flagShowSpriteLeftMost8px<<2 |
+		p.flagShowBackground<<3 |
+		p.flagShowSprite<<4 |
+		p.flagEmphasizeRed<<5 |
+		p.flagEmphasizeGreen<<6 |
+		p.flagEmphasizeBlue<<7
+
+	return ppuSnapshot{
+		PaletteTable:       p.PaletteTable,
+		VRAM:               p.VRAM,
+		OAMData:            p.OAMData,
+		OAMAddress:         p.OAMAddress,
+		InternalDataBuffer: p.InternalDataBuffer,
+		Scanline:           p.Scanline,
+		Cycles:             uint64(p.Cycles),
+		NMIInterrupt:       p.NMIInterrupt,
+		V:                  p.v,
+		T:                  p.t,
+		X:                  p.x,
+		W:                  p.w,
+		F:                  p.f,
+		Ctrl:               ctrl,
+		Mask:               mask,
+		SpriteOverflow:     p.flagSpriteOverflow,
+		SpriteZeroHit:      p.flagSpriteZeroHit,
+		VblankStarted:      p.flagVblankStarted,
+		ScrollX:            p.scrollX,
+		ScrollY:            p.scrollY,
+	}
+}
+
+func (p *PPU) restore(s ppuSnapshot) {
+	p.PaletteTable = s.PaletteTable
+	p.VRAM = s.VRAM
+	p.OAMData = s.OAMData
+	p.OAMAddress = s.OAMAddress
+	p.InternalDataBuffer = s.InternalDataBuffer
+	p.Scanline = s.Scanline
+	p.Cycles = uint(s.Cycles)
+	p.NMIInterrupt = s.NMIInterrupt
+	p.v = s.V
+	p.t = s.T
+	p.x = s.X
+	p.w = s.W
+	p.f = s.F
+
+	// the flags are set directly, as writing $2000 would also modify t and NMIInterrupt
+	p.flagNameTable = s.Ctrl & 0b0000_0011
+	p.flagIncrement = (s.Ctrl & 0b0000_0100) >> 2
+	p.flagSpriteTable = (s.Ctrl & 0b0000_1000) >> 3
+	p.flagBackgroundTable = (s.Ctrl & 0b0001_0000) >> 4
+	p.flagSpriteSize = (s.Ctrl & 0b0010_0000) >> 5
+	p.flagMasterSlave = (s.Ctrl & 0b0100_0000) >> 6
+	p.flagNMI = (s.Ctrl & 0b1000_0000) != 0
+	p.WriteToPPUMask(s.Mask)
+
+	p.flagSpriteOverflow = s.SpriteOverflow
+	p.flagSpriteZeroHit = s.SpriteZeroHit
+	p.flagVblankStarted = s.VblankStarted
+	p.scrollX = s.ScrollX
+	p.scrollY = s.ScrollY
+}
+
+func (j *Joypad) snapshot() joypadSnapshot {
+	return joypadSnapshot{
+		Strobe:       j.Strobe,
+		ButtonIndex:  j.ButtonIndex,
+		ButtonStatus: j.ButtonStatus,
+	}
+}
+
+func (j *Joypad) restore(s joypadSnapshot) {
+	j.Strobe = s.Strobe
+	j.ButtonIndex = s.ButtonIndex
+	j.ButtonStatus = s.ButtonStatus
+}
+
+func (c *Cartridge) snapshot() cartridgeSnapshot {
+	var s cartridgeSnapshot
+	copy(s.ProgramRam[:], c.ProgramRam)
+	return s
+}
+
+func (c *Cartridge) restore(s cartridgeSnapshot) {
+	copy(c.ProgramRam, s.ProgramRam[:])
+}
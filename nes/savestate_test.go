@@ -0,0 +1,74 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loop: INC $10, LDA $10, STA $6000, STA $2007, JMP loop
+var saveStateTestProgram = []uint8{0xe6, 0x10, 0xa5, 0x10, 0x8d, 0x00, 0x60, 0x8d, 0x07, 0x20, 0x4c, 0x00, 0x80}
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(saveStateTestProgram)))
+	console.SetErrorPolicy(ERROR_POLICY_IGNORE)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, console.StepFrame())
+	}
+
+	var state bytes.Buffer
+	assert.NoError(t, console.SaveState(&state))
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, console.StepFrame())
+	}
+	expectCPU := console.CPU.State()
+	expectPPU := console.Bus.PPU.snapshot()
+	expectRAM := console.Bus.CpuVRAM
+	expectProgramRam := append([]uint8{}, console.Cartridge.ProgramRam...)
+	expectCycles := console.Bus.Cycles
+
+	assert.NoError(t, console.LoadState(bytes.NewReader(state.Bytes())))
+	assert.Equal(t, uint(3), console.FrameCount)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, console.StepFrame())
+	}
+
+	assert.Equal(t, expectCPU, console.CPU.State())
+	assert.Equal(t, expectPPU, console.Bus.PPU.snapshot())
+	assert.Equal(t, expectRAM, console.Bus.CpuVRAM)
+	assert.Equal(t, expectProgramRam, console.Cartridge.ProgramRam)
+	assert.Equal(t, expectCycles, console.Bus.Cycles)
+	assert.Equal(t, uint(5), console.FrameCount)
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(saveStateTestProgram)))
+
+	var state bytes.Buffer
+	assert.NoError(t, console.SaveState(&state))
+
+	t.Run("invalid magic", func(t *testing.T) {
+		assert.ErrorIs(t, console.LoadState(bytes.NewReader([]uint8("XXXX"))), ErrInvalidState)
+	})
+
+	t.Run("version", func(t *testing.T) {
+		data := append([]uint8{}, state.Bytes()...)
+		data[4] = SAVE_STATE_VERSION + 1
+		assert.ErrorIs(t, console.LoadState(bytes.NewReader(data)), ErrStateVersion)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		data := state.Bytes()[:state.Len()-1]
+		assert.ErrorIs(t, console.LoadState(bytes.NewReader(data)), ErrInvalidState)
+	})
+
+	t.Run("different ROM", func(t *testing.T) {
+		other := NewConsole()
+		assert.NoError(t, other.LoadROM(createTestROMForConsoleTest([]uint8{0x4c, 0x00, 0x80})))
+		assert.ErrorIs(t, other.LoadState(bytes.NewReader(state.Bytes())), ErrStateMismatch)
+	})
+}
@@ -0,0 +1,91 @@
+package nes
+
+// CPUState is a snapshot of the CPU registers.
+type CPUState struct {
+	A  uint8
+	X  uint8
+	Y  uint8
+	P  uint8 // status flags, see CPU_FLAG_*
+	SP uint8
+	PC uint16
+}
+
+// Flag reports whether the given CPU_FLAG_* bit is set.
+func (s CPUState) Flag(flag uint8) bool {
+	return s.P&flag != 0
+}
+
+// SetFlag sets or clears the given CPU_FLAG_* bit.
+func (s *CPUState) SetFlag(flag uint8, on bool) {
+	if on {
+		s.P |= flag
+	} else {
+		s.P &= ^flag
+	}
+}
+
+func (c *CPU) State() CPUState {
+	return CPUState{
+		A:  c.registerA,
+		X:  c.registerX,
+		Y:  c.registerY,
+		P:  c.status,
+		SP: c.stackPointer,
+		PC: c.programCounter,
+	}
+}
+
+func (c *CPU) SetState(s CPUState) {
+	c.registerA = s.A
+	c.registerX = s.X
+	c.registerY = s.Y
+	c.status = s.P
+	c.stackPointer = s.SP
+	c.programCounter = s.PC
+}
+
+func (c *CPU) ProgramCounter() uint16 {
+	return c.programCounter
+}
+
+func (c *CPU) SetProgramCounter(pc uint16) {
+	c.programCounter = pc
+}
+
+func (c *CPU) Variant() CPUVariant {
+	return c.variant
+}
+
+// PPUState is a snapshot of the PPU internal registers and its position in the frame.
+// See https://www.nesdev.org/wiki/PPU_scrolling#PPU_internal_registers
+type PPUState struct {
+	V        uint16 // current vram address(15bit)
+	T        uint16 // temporary vram address(15bit)
+	X        uint8  // fine x scroll(3bit)
+	W        uint8  // write toggle(1bit)
+	F        uint8  // even/odd frame flag(1bit)
+	Scanline uint16
+	Dot      uint
+}
+
+func (p *PPU) State() PPUState {
+	return PPUState{
+		V:        p.v,
+		T:        p.t,
+		X:        p.x,
+		W:        p.w,
+		F:        p.f,
+		Scanline: p.Scanline,
+		Dot:      p.Cycles,
+	}
+}
+
+func (p *PPU) SetState(s PPUState) {
+	p.v = s.V & 0x7fff
+	p.t = s.T & 0x7fff
+	p.x = s.X & 0b111
+	p.w = s.W & 0b1
+	p.f = s.F & 0b1
+	p.Scanline = s.Scanline
+	p.Cycles = s.Dot
+}
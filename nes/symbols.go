@@ -0,0 +1,236 @@
+package nes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidSymbols = errors.New("invalid symbol file")
+	ErrUnknownSymbol  = errors.New("unknown symbol")
+)
+
+// FCEUX writes one .nl file per 16KB PRG-ROM bank
+const FCEUX_BANK_SIZE = 0x4000
+
+// Symbol names a CPU address, or a range of Size bytes starting there.
+// Symbols in PRG-ROM also have their offset in it, so that only the ones of the banks currently mapped are shown.
+type Symbol struct {
+	Name      string
+	Address   uint16
+	Size      int
+	ROMOffset int // -1 outside of PRG-ROM
+}
+
+// SymbolTable holds the labels loaded from ca65 .dbg, FCEUX .nl and Mesen .mlb files.
+type SymbolTable struct {
+	symbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{}
+}
+
+func (t *SymbolTable) Add(s Symbol) {
+	if s.Size < 1 {
+		s.Size = 1
+	}
+	t.symbols = append(t.symbols, s)
+}
+
+func (t *SymbolTable) Symbols() []Symbol {
+	return t.symbols
+}
+
+func (t *SymbolTable) Len() int {
+	return len(t.symbols)
+}
+
+func (t *SymbolTable) Clear() {
+	t.symbols = nil
+}
+
+// Lookup returns the first symbol with the given name.
+func (t *SymbolTable) Lookup(name string) (Symbol, bool) {
+	for _, s := range t.symbols {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// AddDebugInfo adds the labels of a ca65 .dbg file.
+func (t *SymbolTable) AddDebugInfo(info *DebugInfo) {
+	for _, s := range info.Symbols {
+		if !s.Label {
+			continue
+		}
+		t.Add(Symbol{Name: s.Name, Address: s.Value, Size: s.Size, ROMOffset: s.ROMOffset})
+	}
+}
+
+// ReadFCEUX adds the labels of a FCEUX .nl file, "$C000#name#comment" or "$0300/10#name#comment" for 16 bytes.
+// bank is the PRG-ROM bank of the file, from its name "game.nes.<bank>.nl", or -1 for "game.nes.ram.nl".
+func (t *SymbolTable) ReadFCEUX(r io.Reader, bank int) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "$") {
+			// blank lines and continued comments
+			continue
+		}
+		fields := strings.SplitN(line[1:], "#", 3)
+		if len(fields) < 2 {
+			return fmt.Errorf("%w: line %d: %q", ErrInvalidSymbols, n, line)
+		}
+		addr, size, hasSize := strings.Cut(fields[0], "/")
+		address, err := strconv.ParseUint(addr, 16, 16)
+		if err != nil {
+			return fmt.Errorf("%w: line %d: invalid address %s", ErrInvalidSymbols, n, addr)
+		}
+		s := Symbol{Name: fields[1], Address: uint16(address), Size: 1, ROMOffset: -1}
+		if hasSize {
+			length, err := strconv.ParseUint(size, 16, 16)
+			if err != nil {
+				return fmt.Errorf("%w: line %d: invalid size %s", ErrInvalidSymbols, n, size)
+			}
+			s.Size = int(length)
+		}
+		if s.Name == "" {
+			continue
+		}
+		if bank >= 0 && s.Address >= 0x8000 {
+			s.ROMOffset = bank*FCEUX_BANK_SIZE + int(s.Address)%FCEUX_BANK_SIZE
+		}
+		t.Add(s)
+	}
+	return scanner.Err()
+}
+
+// ReadMesen adds the labels of a Mesen .mlb file, "type:address[-end]:name[:comment]".
+// PRG-ROM labels are placed at the address bus maps their offset to.
+func (t *SymbolTable) ReadMesen(r io.Reader, bus *Bus) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 4)
+		if len(fields) < 3 {
+			return fmt.Errorf("%w: line %d: %q", ErrInvalidSymbols, n, line)
+		}
+		first, last, isRange := strings.Cut(fields[1], "-")
+		start, err := strconv.ParseUint(first, 16, 32)
+		if err != nil {
+			return fmt.Errorf("%w: line %d: invalid address %s", ErrInvalidSymbols, n, first)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.ParseUint(last, 16, 32); err != nil || end < start {
+				return fmt.Errorf("%w: line %d: invalid address %s", ErrInvalidSymbols, n, last)
+			}
+		}
+		s := Symbol{Name: fields[2], Size: int(end-start) + 1, ROMOffset: -1}
+		if s.Name == "" {
+			// comment only
+			continue
+		}
+
+		// Mesen 2 spells the memory types out
+		switch fields[0] {
+		case "P", "NesPrgRom":
+			s.ROMOffset = int(start)
+			addr, ok := bus.programRomAddress(s.ROMOffset)
+			if !ok {
+				return fmt.Errorf("%w: line %d: $%X is outside of PRG-ROM", ErrInvalidSymbols, n, start)
+			}
+			s.Address = addr
+		case "R", "NesInternalRam", "G", "NesMemory", "NesRegister":
+			s.Address = uint16(start)
+		case "S", "NesSaveRam", "W", "NesWorkRam":
+			s.Address = 0x6000 + uint16(start)
+		default:
+			// CHR and other memories have no CPU address
+			continue
+		}
+		t.Add(s)
+	}
+	return scanner.Err()
+}
+
+// NameAt returns the symbol covering addr, like "buffer+3", preferring the ones starting there.
+// romOffset is the PRG-ROM offset mapped at addr, -1 outside of PRG-ROM.
+func (t *SymbolTable) NameAt(addr uint16, romOffset int) (string, bool) {
+	var found *Symbol
+	var foundOffset int
+	for i := range t.symbols {
+		s := &t.symbols[i]
+		offset := int(addr) - int(s.Address)
+		if s.ROMOffset >= 0 {
+			// PRG-ROM symbols match wherever their bank is mapped
+			if romOffset < 0 {
+				continue
+			}
+			offset = romOffset - s.ROMOffset
+		}
+		if offset < 0 || offset >= s.Size {
+			continue
+		}
+		if found == nil || offset < foundOffset {
+			found, foundOffset = s, offset
+		}
+		if offset == 0 {
+			break
+		}
+	}
+	if found == nil {
+		return "", false
+	}
+	if foundOffset == 0 {
+		return found.Name, true
+	}
+	return fmt.Sprintf("%s+%d", found.Name, foundOffset), true
+}
+
+// SymbolName returns the label of the CPU address.
+func (b *Bus) SymbolName(addr uint16) (string, bool) {
+	if b.Symbols == nil {
+		return "", false
+	}
+	romOffset := -1
+	if addr >= 0x8000 {
+		romOffset = b.ProgramRomOffset(addr)
+	}
+	return b.Symbols.NameAt(addr, romOffset)
+}
+
+// SymbolAddress resolves a label, optionally followed by an offset like "buffer+3", to a CPU address.
+func (b *Bus) SymbolAddress(name string) (uint16, error) {
+	label, offset, hasOffset := strings.Cut(name, "+")
+	var delta uint64
+	if hasOffset {
+		var err error
+		if strings.HasPrefix(offset, "$") {
+			delta, err = strconv.ParseUint(offset[1:], 16, 16)
+		} else {
+			delta, err = strconv.ParseUint(offset, 0, 16)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownSymbol, name)
+		}
+	}
+	if b.Symbols == nil {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownSymbol, name)
+	}
+	s, ok := b.Symbols.Lookup(label)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownSymbol, name)
+	}
+	return s.Address + uint16(delta), nil
+}
@@ -0,0 +1,193 @@
+package nes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestConsoleForSymbolTest(t *testing.T) *Console {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest([]uint8{
+		0x20, 0x10, 0x80, // JSR $8010
+		0xad, 0x02, 0x20, // LDA $2002
+		0x85, 0x13, // STA $13
+		0x4c, 0x00, 0x80, // JMP $8000
+	})))
+	return console
+}
+
+func TestSymbolTableReadFCEUX(t *testing.T) {
+	console := createTestConsoleForSymbolTest(t)
+	symbols := console.Symbols
+
+	assert.NoError(t, symbols.ReadFCEUX(strings.NewReader("$0010#counter#frames\n$0300/10#buffer#\n$0020##comment only\n"), -1))
+	assert.NoError(t, symbols.ReadFCEUX(strings.NewReader("$8000#reset#\n$8010#init#multi line\\\ncomment\n"), 0))
+	// bank 1 is mapped at $C000, not at $8000 where the label was taken
+	assert.NoError(t, symbols.ReadFCEUX(strings.NewReader("$8001#other_bank#\n$C000#high#\n"), 1))
+
+	assert.Equal(t, []Symbol{
+		{Name: "counter", Address: 0x0010, Size: 1, ROMOffset: -1},
+		{Name: "buffer", Address: 0x0300, Size: 16, ROMOffset: -1},
+		{Name: "reset", Address: 0x8000, Size: 1, ROMOffset: 0},
+		{Name: "init", Address: 0x8010, Size: 1, ROMOffset: 0x10},
+		{Name: "other_bank", Address: 0x8001, Size: 1, ROMOffset: 0x4001},
+		{Name: "high", Address: 0xc000, Size: 1, ROMOffset: 0x4000},
+	}, symbols.Symbols())
+
+	tests := []struct {
+		addr     uint16
+		expected string
+		ok       bool
+	}{
+		{0x0010, "counter", true},
+		{0x0300, "buffer", true},
+		{0x030f, "buffer+15", true},
+		{0x0310, "", false},
+		{0x8000, "reset", true},
+		{0xc000, "high", true},
+		{0x8001, "", false},
+		{0xc001, "other_bank", true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("$%04X", tt.addr), func(t *testing.T) {
+			name, ok := console.Bus.SymbolName(tt.addr)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, name)
+		})
+	}
+
+	assert.ErrorIs(t, symbols.ReadFCEUX(strings.NewReader("$zz#bad#\n"), 0), ErrInvalidSymbols)
+	assert.ErrorIs(t, symbols.ReadFCEUX(strings.NewReader("$8000\n"), 0), ErrInvalidSymbols)
+}
+
+func TestSymbolTableReadMesen(t *testing.T) {
+	console := createTestConsoleForSymbolTest(t)
+	input := strings.Join([]string{
+		"P:0010:init:clears the RAM",
+		"P:0100-010F:table",
+		"R:0010:counter",
+		"R:0020::comment only",
+		"S:0000:save",
+		"G:2000:PPUCTRL",
+		"NesPrgRom:7FFC:reset_vector",
+		"C:0000:tiles",
+	}, "\n")
+	assert.NoError(t, console.Symbols.ReadMesen(strings.NewReader(input), console.Bus))
+
+	assert.Equal(t, []Symbol{
+		{Name: "init", Address: 0x8010, Size: 1, ROMOffset: 0x10},
+		{Name: "table", Address: 0x8100, Size: 16, ROMOffset: 0x100},
+		{Name: "counter", Address: 0x0010, Size: 1, ROMOffset: -1},
+		{Name: "save", Address: 0x6000, Size: 1, ROMOffset: -1},
+		{Name: "PPUCTRL", Address: 0x2000, Size: 1, ROMOffset: -1},
+		{Name: "reset_vector", Address: 0xfffc, Size: 1, ROMOffset: 0x7ffc},
+	}, console.Symbols.Symbols())
+
+	assert.ErrorIs(t, console.Symbols.ReadMesen(strings.NewReader("P:8000:outside"), console.Bus), ErrInvalidSymbols)
+	assert.ErrorIs(t, console.Symbols.ReadMesen(strings.NewReader("R:0010"), console.Bus), ErrInvalidSymbols)
+}
+
+func TestSymbolTableMirroredROM(t *testing.T) {
+	// a 16KB PRG-ROM is mapped at both $8000 and $C000
+	rom := createTestROMForConsoleTest(nil)
+	rom[4] = 0x01
+	rom = append(rom[:16+0x4000], rom[16+0x8000:]...)
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(rom))
+
+	assert.NoError(t, console.Symbols.ReadMesen(strings.NewReader("P:0010:init"), console.Bus))
+	addr, err := console.Bus.SymbolAddress("init")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0xc010), addr)
+
+	for _, addr := range []uint16{0x8010, 0xc010} {
+		name, ok := console.Bus.SymbolName(addr)
+		assert.True(t, ok)
+		assert.Equal(t, "init", name)
+	}
+}
+
+func TestBusSymbolAddress(t *testing.T) {
+	console := createTestConsoleForSymbolTest(t)
+	console.Symbols.Add(Symbol{Name: "buffer", Address: 0x0300, Size: 16, ROMOffset: -1})
+
+	tests := []struct {
+		name     string
+		expected uint16
+	}{
+		{"buffer", 0x0300},
+		{"buffer+3", 0x0303},
+		{"buffer+$10", 0x0310},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := console.Bus.SymbolAddress(tt.name)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, addr)
+		})
+	}
+
+	_, err := console.Bus.SymbolAddress("missing")
+	assert.ErrorIs(t, err, ErrUnknownSymbol)
+	_, err = console.Bus.SymbolAddress("buffer+x")
+	assert.ErrorIs(t, err, ErrUnknownSymbol)
+}
+
+func TestSymbolTableAddDebugInfo(t *testing.T) {
+	info, err := ReadDebugInfo(strings.NewReader(testDebugInfo))
+	assert.NoError(t, err)
+	symbols := NewSymbolTable()
+	symbols.AddDebugInfo(info)
+
+	// constants are not labels
+	assert.Equal(t, []Symbol{
+		{Name: "reset", Address: 0x8000, Size: 1, ROMOffset: 0},
+		{Name: "loop", Address: 0x8002, Size: 1, ROMOffset: 2},
+	}, symbols.Symbols())
+}
+
+func TestTraceSymbols(t *testing.T) {
+	console := createTestConsoleForSymbolTest(t)
+	assert.NoError(t, console.Symbols.ReadFCEUX(strings.NewReader("$2002#PPUSTATUS#\n$0013#counter#\n"), -1))
+	assert.NoError(t, console.Symbols.ReadFCEUX(strings.NewReader("$8000#main#\n$8010#init#\n"), 0))
+
+	assert.Contains(t, trace(console.CPU), "JSR init")
+	console.CPU.programCounter = 0x8003
+	assert.Contains(t, trace(console.CPU), "LDA PPUSTATUS = ")
+	console.CPU.programCounter = 0x8006
+	assert.Contains(t, trace(console.CPU), "STA counter = 00")
+	console.CPU.programCounter = 0x8008
+	assert.Contains(t, trace(console.CPU), "JMP main")
+}
+
+func TestDebuggerBreakpointAtSymbol(t *testing.T) {
+	console := createTestConsoleForSymbolTest(t)
+	assert.NoError(t, console.Symbols.ReadFCEUX(strings.NewReader("$0300/4#buffer#\n"), -1))
+	assert.NoError(t, console.Symbols.ReadFCEUX(strings.NewReader("$8010#init#\n"), 0))
+	d := console.AttachDebugger()
+
+	bp, err := d.AddBreakpointAtSymbol(BREAK_EXECUTE, "init", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "#1 exec cpu $8010 (init)", bp.String())
+
+	bp, err = d.AddBreakpointAtSymbol(BREAK_WRITE, "buffer", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "#2 write cpu $0300-$0303 (buffer)", bp.String())
+
+	bp, err = d.AddBreakpointAtSymbol(BREAK_READ, "buffer+2", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "#3 read cpu $0302 (buffer+2)", bp.String())
+
+	_, err = d.AddBreakpointAtSymbol(BREAK_EXECUTE, "missing", "")
+	assert.ErrorIs(t, err, ErrUnknownSymbol)
+
+	err = console.StepFrame()
+	var stop *DebugStop
+	assert.ErrorAs(t, err, &stop)
+	assert.Equal(t, uint16(0x8010), stop.PC)
+}
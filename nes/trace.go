@@ -5,111 +5,126 @@ import (
 	"strings"
 )
 
-func trace(cpu *CPU) string {
-	var opsInfo OpeCode
-	code := cpu.readMemory(cpu.programCounter)
-	opsInfo = CPU_OPS_CODES[code]
+// traceStyle is how a trace format prints the effective addresses and values of operands.
+type traceStyle struct {
+	addr8  string // zero page effective address
+	addr16 string
+	value  string
+}
 
-	begin := cpu.programCounter
-	hexDump := []uint8{}
-	hexDump = append(hexDump, code)
+var (
+	nestestStyle = traceStyle{addr8: "%02X", addr16: "%04X", value: "%02X"}
+	mesenStyle   = traceStyle{addr8: "$%02X", addr16: "$%04X", value: "$%02X"}
+	fceuxStyle   = traceStyle{addr8: "$%02X", addr16: "$%04X", value: "#$%02X"}
+)
 
-	var memoryAddr uint16
-	var storedValue uint8
+// trace formats the instruction at the program counter like nestest.log.
+// Memory is only peeked, so tracing never changes the emulation.
+func trace(cpu *CPU) string {
+	return formatTrace(cpu, TraceOptions{Format: TRACE_FORMAT_NESTEST, PPU: true, Cycles: true}, 0)
+}
 
-	switch opsInfo.Mode {
-	case IMMEDIATE, IMPLIED, ACCUMULATOR, RELATIVE, INDIRECT:
-		memoryAddr = 0
-		storedValue = 0
-	default:
-		memoryAddr, _ = cpu.getAbsoluteAddress(opsInfo, begin+1)
-		storedValue = cpu.readMemory(memoryAddr)
-	}
-	if begin == 0xE545 {
-		fmt.Print()
+// traceInstruction disassembles the instruction at the program counter with the operand details of style,
+// like "STA $0300,X @ 0301 = 00". It also returns the instruction bytes.
+func traceInstruction(cpu *CPU, style traceStyle) (string, []uint8) {
+	pc := cpu.programCounter
+	data := []uint8{cpu.Peek(pc), cpu.Peek(pc + 1), cpu.Peek(pc + 2)}
+	i, err := decodeInstruction(cpu.instructions, data, pc)
+	if err != nil {
+		return fmt.Sprintf("%4s ", ""), data[:1]
 	}
 
-	var tmp string
-
-	switch opsInfo.Length {
-	case 1:
-		switch code {
-		case 0x0a, 0x4a, 0x2a, 0x6a:
-			tmp = "A "
-		}
-	case 2:
-		address := cpu.readMemory(begin + 1)
-		hexDump = append(hexDump, address)
-
-		switch opsInfo.Mode {
-		case IMMEDIATE:
-			tmp = fmt.Sprintf("#$%02X", address)
-		case ZERO_PAGE:
-			tmp = fmt.Sprintf("$%02X = %02X", memoryAddr, storedValue)
-		case ZERO_PAGE_X:
-			tmp = fmt.Sprintf("$%02X,X @ %02X = %02X", address, memoryAddr, storedValue)
-		case ZERO_PAGE_Y:
-			tmp = fmt.Sprintf("$%02X,Y @ %02X = %02X", address, memoryAddr, storedValue)
-		case INDIRECT_X:
-			tmp = fmt.Sprintf("($%02X,X) @ %02X = %04X = %02X", address, (address + cpu.registerX), memoryAddr, storedValue)
-		case INDIRECT_Y:
-			tmp = fmt.Sprintf("($%02X),Y = %04X @ %04X = %02X", address, (memoryAddr - uint16(cpu.registerY)), memoryAddr, storedValue)
-		case RELATIVE:
-			address := uint16(cpu.readMemory(begin + 1))
-			if address > 0x7f {
-				address = uint16(address) - uint16(0x100)
+	// operand addresses are shown as labels when symbols are loaded
+	operand := i.FormatOperand(func(addr uint16, digits int) string {
+		if bus, ok := cpu.bus.(*Bus); ok {
+			if name, ok := bus.SymbolName(addr); ok {
+				return name
 			}
-			address = begin + address + 2
-			tmp = fmt.Sprintf("$%04X", address)
-		default:
-			var add uint
-			add = uint(begin) + 2 + uint(address)
-			tmp = fmt.Sprintf("$%04X", add)
 		}
-	case 3:
-		addressLo := cpu.readMemory(begin + 1)
-		addressHi := cpu.readMemory(begin + 2)
-		hexDump = append(hexDump, addressLo)
-		hexDump = append(hexDump, addressHi)
-
-		address := cpu.readMemory16(begin + 1)
+		return fmt.Sprintf("$%0*X", digits, addr)
+	})
 
-		switch opsInfo.Mode {
-		case IMPLIED, ACCUMULATOR, RELATIVE, INDIRECT:
-			if code == 0x6c {
-				// jmp indirect
-				jmpAddr := cpu.readMemory16(address)
-				if address&0xff == 0xff {
-					lo := cpu.readMemory(address)
-					hi := cpu.readMemory(address & 0xff00)
-					jmpAddr = uint16(hi)<<8 | uint16(lo)
-				}
-				tmp = fmt.Sprintf("($%04X) = %04X", address, jmpAddr)
-
-			} else {
-				tmp = fmt.Sprintf("$%04X", address)
-			}
-		case ABSOLUTE:
-			if code == 0x4c || code == 0x20 {
-				// jmp/jsr absolute
-				tmp = fmt.Sprintf("$%04X", address)
-			} else {
-				tmp = fmt.Sprintf("$%04X = %02X", address, storedValue)
-			}
-		case ABSOLUTE_X:
-			tmp = fmt.Sprintf("$%04X,X @ %04X = %02X", address, memoryAddr, storedValue)
-		case ABSOLUTE_Y:
-			tmp = fmt.Sprintf("$%04X,Y @ %04X = %02X", address, memoryAddr, storedValue)
+	var addr uint16
+	var value string
+	switch i.Op.Mode {
+	case IMMEDIATE, IMPLIED, ACCUMULATOR, RELATIVE, INDIRECT:
+	default:
+		addr = cpu.peekOperandAddress(i.Op, pc+1)
+		value = fmt.Sprintf(style.value, cpu.Peek(addr))
+	}
+	switch i.Op.Mode {
+	case ZERO_PAGE:
+		operand += " = " + value
+	case ABSOLUTE:
+		if i.Code != 0x4c && i.Code != 0x20 {
+			// not jmp/jsr absolute
+			operand += " = " + value
+		}
+	case ZERO_PAGE_X, ZERO_PAGE_Y:
+		operand += fmt.Sprintf(" @ "+style.addr8+" = %s", addr, value)
+	case ABSOLUTE_X, ABSOLUTE_Y:
+		operand += fmt.Sprintf(" @ "+style.addr16+" = %s", addr, value)
+	case INDIRECT_X:
+		operand += fmt.Sprintf(" @ "+style.addr8+" = "+style.addr16+" = %s", uint8(i.Operand)+cpu.registerX, addr, value)
+	case INDIRECT_Y:
+		operand += fmt.Sprintf(" = "+style.addr16+" @ "+style.addr16+" = %s", addr-uint16(cpu.registerY), addr, value)
+	case INDIRECT:
+		// jmp indirect, with the page wrap bug of the NMOS 6502
+		jmpAddr := cpu.peek16(i.Operand)
+		if i.Operand&0xff == 0xff && cpu.variant != CPU_VARIANT_65C02 {
+			jmpAddr = uint16(cpu.Peek(i.Operand&0xff00))<<8 | uint16(cpu.Peek(i.Operand))
 		}
+		operand += fmt.Sprintf(" = "+style.addr16, jmpAddr)
+	case ZERO_PAGE_INDIRECT:
+		operand += fmt.Sprintf(" = "+style.addr16+" = %s", addr, value)
+	case INDIRECT_ABSOLUTE_X:
+		// jmp (absolute,x)
+		operand += fmt.Sprintf(" @ "+style.addr16+" = "+style.addr16, addr, cpu.peek16(addr))
+	case ZERO_PAGE_RELATIVE:
+		operand += " = " + value
 	}
 
+	return fmt.Sprintf("%4s %s", i.Op.Mnemonic, operand), i.Bytes()
+}
+
+func hexBytes(data []uint8) string {
 	var hexStrs []string
-	for _, b := range hexDump {
+	for _, b := range data {
 		hexStrs = append(hexStrs, fmt.Sprintf("%02X", b))
 	}
-	hexStr := strings.Join(hexStrs, " ")
-
-	asmStr := fmt.Sprintf("%04X %-8s %4s %s", begin, hexStr, opsInfo.Mnemonic, tmp)
+	return strings.Join(hexStrs, " ")
+}
 
-	return fmt.Sprintf("%-47s A:%02X X:%02X Y:%02X P:%02X SP:%02X PPU:%3d,%3d CYC:%d", asmStr, cpu.registerA, cpu.registerX, cpu.registerY, cpu.status, cpu.stackPointer, cpu.bus.PPU.Scanline, cpu.bus.PPU.Cycles, cpu.bus.Cycles)
+// peekOperandAddress is getAbsoluteAddress without side effects on the bus.
+func (c *CPU) peekOperandAddress(opsInfo OpeCode, addr uint16) uint16 {
+	switch opsInfo.Mode {
+	case IMMEDIATE:
+		return addr
+	case ZERO_PAGE:
+		return uint16(c.Peek(addr))
+	case ZERO_PAGE_X:
+		return uint16(c.Peek(addr) + c.registerX)
+	case ZERO_PAGE_Y:
+		return uint16(c.Peek(addr) + c.registerY)
+	case ABSOLUTE:
+		return c.peek16(addr)
+	case ABSOLUTE_X:
+		return c.peek16(addr) + uint16(c.registerX)
+	case ABSOLUTE_Y:
+		return c.peek16(addr) + uint16(c.registerY)
+	case INDIRECT_X:
+		ptr := c.Peek(addr) + c.registerX
+		return uint16(c.Peek(uint16(ptr+1)))<<8 | uint16(c.Peek(uint16(ptr)))
+	case INDIRECT_Y:
+		base := c.Peek(addr)
+		return (uint16(c.Peek(uint16(base+1)))<<8 | uint16(c.Peek(uint16(base)))) + uint16(c.registerY)
+	case ZERO_PAGE_INDIRECT:
+		base := c.Peek(addr)
+		return uint16(c.Peek(uint16(base+1)))<<8 | uint16(c.Peek(uint16(base)))
+	case INDIRECT_ABSOLUTE_X:
+		return c.peek16(addr) + uint16(c.registerX)
+	case ZERO_PAGE_RELATIVE:
+		return uint16(c.Peek(addr))
+	}
+	return 0
 }
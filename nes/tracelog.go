@@ -0,0 +1,203 @@
+package nes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrUnknownTraceFormat = errors.New("unknown trace format")
+
+type TraceFormat uint8
+
+const (
+	TRACE_FORMAT_NESTEST TraceFormat = iota // nestest.log: "C000  4C F5 C5  JMP $C5F5    A:00 X:00 Y:00 P:24 SP:FD"
+	TRACE_FORMAT_MESEN                      // Mesen: "C000  JMP $C5F5    A:00 X:00 Y:00 S:FD P:nvubdIzc"
+	TRACE_FORMAT_FCEUX                      // FCEUX: "A:00 X:00 Y:00 S:FD P:nvubdIzc  $C000:4C F5 C5  JMP $C5F5"
+)
+
+var traceFormatNames = map[string]TraceFormat{
+	"nestest": TRACE_FORMAT_NESTEST,
+	"mesen":   TRACE_FORMAT_MESEN,
+	"fceux":   TRACE_FORMAT_FCEUX,
+}
+
+// ParseTraceFormat parses "nestest", "mesen" or "fceux".
+func ParseTraceFormat(name string) (TraceFormat, error) {
+	format, ok := traceFormatNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownTraceFormat, name)
+	}
+	return format, nil
+}
+
+// TraceOptions select what a TraceLogger writes.
+type TraceOptions struct {
+	Format TraceFormat
+	PPU    bool // scanline and dot columns
+	Cycles bool // CPU cycles since power on
+
+	// only instructions at Start-End (inclusive) are traced, unless both are 0
+	Start uint16
+	End   uint16
+
+	// only frames FirstFrame-LastFrame (inclusive) are traced, LastFrame 0 meaning no end
+	FirstFrame uint
+	LastFrame  uint
+
+	// when RingSize is not 0, only the last RingSize lines are kept, and written by Dump or on a crash
+	RingSize int
+}
+
+// TraceLogger writes a line for every instruction a Console executes, before executing it.
+// Set it with Console.SetTraceLogger; it can be disabled and enabled again at any time.
+type TraceLogger struct {
+	Options TraceOptions
+	w       io.Writer
+	enabled bool
+	ring    []string
+	next    int // next line of ring to overwrite
+	err     error
+}
+
+func NewTraceLogger(w io.Writer, options TraceOptions) *TraceLogger {
+	return &TraceLogger{Options: options, w: w, enabled: true}
+}
+
+func (t *TraceLogger) Enabled() bool {
+	return t.enabled
+}
+
+func (t *TraceLogger) SetEnabled(enabled bool) {
+	t.enabled = enabled
+}
+
+// Err returns the first write error, after which nothing more is written.
+func (t *TraceLogger) Err() error {
+	return t.err
+}
+
+// Lines returns the lines of the ring buffer, oldest first.
+func (t *TraceLogger) Lines() []string {
+	if len(t.ring) < t.Options.RingSize {
+		return append([]string(nil), t.ring...)
+	}
+	return append(append([]string(nil), t.ring[t.next:]...), t.ring[:t.next]...)
+}
+
+// Dump writes the lines of the ring buffer and empties it.
+func (t *TraceLogger) Dump() error {
+	for _, line := range t.Lines() {
+		t.write(line)
+	}
+	t.ring, t.next = t.ring[:0], 0
+	return t.err
+}
+
+func (t *TraceLogger) write(line string) {
+	if t.err == nil {
+		_, t.err = io.WriteString(t.w, line+"\n")
+	}
+}
+
+// log traces the instruction console is about to execute.
+func (t *TraceLogger) log(c *Console) {
+	o := &t.Options
+	pc := c.CPU.programCounter
+	switch {
+	case !t.enabled:
+		return
+	case (o.Start != 0 || o.End != 0) && (pc < o.Start || pc > o.End):
+		return
+	case c.FrameCount < o.FirstFrame || (o.LastFrame != 0 && c.FrameCount > o.LastFrame):
+		return
+	}
+
+	line := formatTrace(c.CPU, *o, c.FrameCount)
+	if o.RingSize <= 0 {
+		t.write(line)
+		return
+	}
+	if len(t.ring) < o.RingSize {
+		t.ring = append(t.ring, line)
+		return
+	}
+	t.ring[t.next] = line
+	t.next = (t.next + 1) % o.RingSize
+}
+
+// crash writes the ring buffer and why the emulation stopped.
+func (t *TraceLogger) crash(reason any) {
+	t.Dump()
+	t.write(fmt.Sprintf("crashed: %v", reason))
+}
+
+// SetTraceLogger starts tracing the executed instructions, nil stops it.
+func (c *Console) SetTraceLogger(t *TraceLogger) {
+	c.tracer = t
+}
+
+func (c *Console) TraceLogger() *TraceLogger {
+	return c.tracer
+}
+
+// formatFlags formats the status register like "nvubdIzc", set flags in upper case.
+func formatFlags(p uint8) string {
+	flags := []byte("nvubdizc")
+	for i := range flags {
+		if p&(0x80>>i) != 0 {
+			flags[i] -= 'a' - 'A'
+		}
+	}
+	return string(flags)
+}
+
+// formatTrace formats the instruction at the program counter of cpu.
+func formatTrace(cpu *CPU, o TraceOptions, frame uint) string {
+	var scanline uint16
+	var ppuCycles, cycles uint
+	if bus, ok := cpu.bus.(*Bus); ok {
+		scanline = bus.PPU.Scanline
+		ppuCycles = bus.PPU.Cycles
+		cycles = bus.Cycles
+	}
+	pc := cpu.programCounter
+
+	var b strings.Builder
+	switch o.Format {
+	case TRACE_FORMAT_MESEN:
+		instruction, _ := traceInstruction(cpu, mesenStyle)
+		fmt.Fprintf(&b, "%04X  %-40s A:%02X X:%02X Y:%02X S:%02X P:%s", pc, strings.TrimSpace(instruction),
+			cpu.registerA, cpu.registerX, cpu.registerY, cpu.stackPointer, formatFlags(cpu.status))
+		if o.PPU {
+			fmt.Fprintf(&b, " V:%-3d H:%-3d Fr:%d", scanline, ppuCycles, frame)
+		}
+		if o.Cycles {
+			fmt.Fprintf(&b, " Cycle:%d", cycles)
+		}
+	case TRACE_FORMAT_FCEUX:
+		if o.Cycles {
+			fmt.Fprintf(&b, "c%-11d ", cycles)
+		}
+		if o.PPU {
+			fmt.Fprintf(&b, "f%-6d SL:%-3d PX:%-3d ", frame, scanline, ppuCycles)
+		}
+		instruction, data := traceInstruction(cpu, fceuxStyle)
+		fmt.Fprintf(&b, "A:%02X X:%02X Y:%02X S:%02X P:%s  $%04X:%-8s %s",
+			cpu.registerA, cpu.registerX, cpu.registerY, cpu.stackPointer, formatFlags(cpu.status),
+			pc, hexBytes(data), instruction)
+	default:
+		instruction, data := traceInstruction(cpu, nestestStyle)
+		asmStr := fmt.Sprintf("%04X  %-8s %s", pc, hexBytes(data), instruction)
+		fmt.Fprintf(&b, "%-47s A:%02X X:%02X Y:%02X P:%02X SP:%02X", asmStr,
+			cpu.registerA, cpu.registerX, cpu.registerY, cpu.status, cpu.stackPointer)
+		if o.PPU {
+			fmt.Fprintf(&b, " PPU:%3d,%3d", scanline, ppuCycles)
+		}
+		if o.Cycles {
+			fmt.Fprintf(&b, " CYC:%d", cycles)
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
@@ -0,0 +1,149 @@
+package nes_test
+
+import (
+	"fmt"
+	"go-nes/nes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTracedConsole(t *testing.T, source string, options nes.TraceOptions) (*nes.Console, *strings.Builder) {
+	t.Helper()
+	console := nes.NewConsole()
+	assert.NoError(t, console.LoadROM(nes.CreateTestROMForConsoleTest(assemble(t, source))))
+	var out strings.Builder
+	console.SetTraceLogger(nes.NewTraceLogger(&out, options))
+	return console, &out
+}
+
+const traceTestProgram = `
+	LDX #$05
+loop:
+	INX
+	STX $10
+	JMP loop
+`
+
+func TestTraceFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		options nes.TraceOptions
+		want    []string
+	}{
+		{
+			name:    "nestest",
+			options: nes.TraceOptions{Format: nes.TRACE_FORMAT_NESTEST},
+			want: []string{
+				"8000  A2 05     LDX #$05                        A:00 X:00 Y:00 P:24 SP:FD",
+				"8002  E8        INX                             A:00 X:05 Y:00 P:24 SP:FD",
+				"8003  86 10     STX $10 = 00                    A:00 X:06 Y:00 P:24 SP:FD",
+			},
+		},
+		{
+			name:    "mesen",
+			options: nes.TraceOptions{Format: nes.TRACE_FORMAT_MESEN},
+			want: []string{
+				"8000  LDX #$05                                 A:00 X:00 Y:00 S:FD P:nvUbdIzc",
+				"8002  INX                                      A:00 X:05 Y:00 S:FD P:nvUbdIzc",
+				"8003  STX $10 = $00                            A:00 X:06 Y:00 S:FD P:nvUbdIzc",
+			},
+		},
+		{
+			name:    "fceux",
+			options: nes.TraceOptions{Format: nes.TRACE_FORMAT_FCEUX},
+			want: []string{
+				"A:00 X:00 Y:00 S:FD P:nvUbdIzc  $8000:A2 05     LDX #$05",
+				"A:00 X:05 Y:00 S:FD P:nvUbdIzc  $8002:E8        INX",
+				"A:00 X:06 Y:00 S:FD P:nvUbdIzc  $8003:86 10     STX $10 = #$00",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			console, out := createTracedConsole(t, traceTestProgram, tt.options)
+			for range tt.want {
+				assert.NoError(t, console.StepInstruction())
+			}
+			assert.Equal(t, strings.Join(tt.want, "\n")+"\n", out.String())
+		})
+	}
+}
+
+func TestTraceColumns(t *testing.T) {
+	tests := []struct {
+		format nes.TraceFormat
+		want   string
+	}{
+		{nes.TRACE_FORMAT_NESTEST, "SP:FD PPU:  0,  0 CYC:0"},
+		{nes.TRACE_FORMAT_MESEN, "P:nvUbdIzc V:0   H:0   Fr:0 Cycle:0"},
+		{nes.TRACE_FORMAT_FCEUX, "c0           f0      SL:0   PX:0   A:00"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprint(tt.format), func(t *testing.T) {
+			console, out := createTracedConsole(t, traceTestProgram, nes.TraceOptions{Format: tt.format, PPU: true, Cycles: true})
+			assert.NoError(t, console.StepInstruction())
+			assert.Contains(t, out.String(), tt.want)
+		})
+	}
+}
+
+func TestTraceFilters(t *testing.T) {
+	console, out := createTracedConsole(t, traceTestProgram, nes.TraceOptions{Start: 0x8003, End: 0x8004, FirstFrame: 1, LastFrame: 1})
+	for console.FrameCount < 3 {
+		assert.NoError(t, console.StepFrame())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Greater(t, len(lines), 1)
+	for _, line := range lines {
+		assert.True(t, strings.HasPrefix(line, "8003 "), line)
+	}
+
+	// disabled
+	out.Reset()
+	console.TraceLogger().SetEnabled(false)
+	console.TraceLogger().Options.LastFrame = 0
+	assert.NoError(t, console.StepFrame())
+	assert.Empty(t, out.String())
+}
+
+func TestTraceRingBuffer(t *testing.T) {
+	console, out := createTracedConsole(t, "LDX #$01\nINX\nINX\nINX\n.byte $02", nes.TraceOptions{RingSize: 2})
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, console.StepInstruction())
+	}
+	assert.Empty(t, out.String())
+	assert.Len(t, console.TraceLogger().Lines(), 2)
+
+	err := console.StepInstruction()
+	assert.ErrorIs(t, err, nes.ErrIllegalOpcode)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "8004 "), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "8005 "), lines[1])
+	assert.Equal(t, "crashed: illegal opcode $02 at $8005", lines[2])
+	assert.Empty(t, console.TraceLogger().Lines())
+}
+
+func TestParseTraceFormat(t *testing.T) {
+	format, err := nes.ParseTraceFormat("Mesen")
+	assert.NoError(t, err)
+	assert.Equal(t, nes.TRACE_FORMAT_MESEN, format)
+	_, err = nes.ParseTraceFormat("bizhawk")
+	assert.ErrorIs(t, err, nes.ErrUnknownTraceFormat)
+}
+
+func TestTraceSkipsRewindReplay(t *testing.T) {
+	console, out := createTracedConsole(t, traceTestProgram, nes.TraceOptions{RingSize: 1000})
+	console.EnableRewind(4, 1<<20)
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, console.StepFrame())
+	}
+	lines := console.TraceLogger().Lines()
+	assert.NoError(t, console.RewindFrame())
+	assert.Equal(t, lines, console.TraceLogger().Lines())
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,119 @@
+package nes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The emulation has no source of nondeterminism: RAM powers on zeroed, there is no wall clock and no random
+// number, so the same ROM and input always produce the same frames. The hash log below checks that guarantee.
+
+var ErrInvalidHashLog = errors.New("invalid hash log")
+
+// FrameHash holds FNV-1a hashes of the console memory after a frame.
+type FrameHash struct {
+	Frame       uint   // Console.EmulatedFrames, which power cycles don't reset
+	RAM         uint64 // CPU RAM and PRG-RAM
+	VRAM        uint64 // nametables, palettes and OAM
+	Framebuffer uint64
+}
+
+// DivergenceError reports the first component whose hash differs from the recorded one.
+type DivergenceError struct {
+	Frame     uint
+	Component string
+	Expected  uint64
+	Actual    uint64
+}
+
+func (e *DivergenceError) Error() string {
+	return fmt.Sprintf("frame %d: %s diverged: expected %016x, got %016x", e.Frame, e.Component, e.Expected, e.Actual)
+}
+
+// FrameHash hashes the current state, usually right after StepFrame.
+func (c *Console) FrameHash() FrameHash {
+	ram := fnv.New64a()
+	ram.Write(c.Bus.CpuVRAM[:])
+	ram.Write(c.Cartridge.ProgramRam)
+
+	vram := fnv.New64a()
+	vram.Write(c.Bus.PPU.VRAM[:])
+	vram.Write(c.Bus.PPU.PaletteTable[:])
+	vram.Write(c.Bus.PPU.OAMData[:])
+
+	framebuffer := fnv.New64a()
+	framebuffer.Write(c.frame.Front.Pix)
+
+	return FrameHash{
+		Frame:       c.EmulatedFrames(),
+		RAM:         ram.Sum64(),
+		VRAM:        vram.Sum64(),
+		Framebuffer: framebuffer.Sum64(),
+	}
+}
+
+// Verify compares h against the expected hash of the same frame.
+// It returns a *DivergenceError naming the first differing component.
+func (h FrameHash) Verify(expected FrameHash) error {
+	components := []struct {
+		name             string
+		expected, actual uint64
+	}{
+		{"ram", expected.RAM, h.RAM},
+		{"vram", expected.VRAM, h.VRAM},
+		{"framebuffer", expected.Framebuffer, h.Framebuffer},
+	}
+	for _, component := range components {
+		if component.expected != component.actual {
+			return &DivergenceError{
+				Frame:     h.Frame,
+				Component: component.name,
+				Expected:  component.expected,
+				Actual:    component.actual,
+			}
+		}
+	}
+	return nil
+}
+
+// WriteHashLog writes one line per frame: "<frame> <ram> <vram> <framebuffer>" with the hashes in hex.
+func WriteHashLog(w io.Writer, hashes []FrameHash) error {
+	bw := bufio.NewWriter(w)
+	for _, h := range hashes {
+		fmt.Fprintf(bw, "%d %016x %016x %016x\n", h.Frame, h.RAM, h.VRAM, h.Framebuffer)
+	}
+	return bw.Flush()
+}
+
+func ReadHashLog(r io.Reader) ([]FrameHash, error) {
+	var hashes []FrameHash
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%w: line %d: expected 4 columns", ErrInvalidHashLog, line)
+		}
+
+		frame, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidHashLog, line, err)
+		}
+		var sums [3]uint64
+		for i := range sums {
+			sums[i], err = strconv.ParseUint(fields[1+i], 16, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidHashLog, line, err)
+			}
+		}
+		hashes = append(hashes, FrameHash{Frame: uint(frame), RAM: sums[0], VRAM: sums[1], Framebuffer: sums[2]})
+	}
+	return hashes, scanner.Err()
+}
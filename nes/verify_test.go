@@ -0,0 +1,80 @@
+package nes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runForHashTest(t *testing.T, frames int) []FrameHash {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	var hashes []FrameHash
+	for i := 0; i < frames; i++ {
+		console.SetButtons(0, uint8(i/3%2)<<JOYPAD_A)
+		assert.NoError(t, console.StepFrame())
+		hashes = append(hashes, console.FrameHash())
+	}
+	return hashes
+}
+
+func TestFrameHashDeterministic(t *testing.T) {
+	first := runForHashTest(t, 10)
+	second := runForHashTest(t, 10)
+	assert.Equal(t, first, second)
+	for i := range first {
+		assert.NoError(t, second[i].Verify(first[i]))
+	}
+	assert.NotEqual(t, first[0].RAM, first[1].RAM)
+}
+
+func TestFrameHashVerify(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	assert.NoError(t, console.StepFrame())
+	expected := console.FrameHash()
+
+	console.Bus.PPU.PaletteTable[0] = 0x3f
+	err := console.FrameHash().Verify(expected)
+	var divergence *DivergenceError
+	assert.ErrorAs(t, err, &divergence)
+	assert.Equal(t, uint(1), divergence.Frame)
+	assert.Equal(t, "vram", divergence.Component)
+
+	// RAM is reported first
+	console.Bus.CpuVRAM[0x100] = 0xff
+	assert.ErrorAs(t, console.FrameHash().Verify(expected), &divergence)
+	assert.Equal(t, "ram", divergence.Component)
+}
+
+func TestHashLog(t *testing.T) {
+	hashes := runForHashTest(t, 3)
+	var buf bytes.Buffer
+	assert.NoError(t, WriteHashLog(&buf, hashes))
+	read, err := ReadHashLog(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, hashes, read)
+
+	_, err = ReadHashLog(strings.NewReader("1 00 00\n"))
+	assert.ErrorIs(t, err, ErrInvalidHashLog)
+	_, err = ReadHashLog(strings.NewReader("1 00 00 zz\n"))
+	assert.ErrorIs(t, err, ErrInvalidHashLog)
+}
+
+func TestFrameHashAcrossPowerCycles(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest(rewindTestProgram)))
+	movie := &Movie{Frames: make([]MovieFrame, 4)}
+	movie.Frames[2].Command = MOVIE_COMMAND_POWER
+	assert.NoError(t, console.PlayMovie(movie, true))
+
+	var frames []uint
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, console.StepFrame())
+		frames = append(frames, console.FrameHash().Frame)
+	}
+	assert.Equal(t, []uint{1, 2, 3, 4}, frames)
+	assert.Equal(t, uint(2), console.FrameCount)
+}
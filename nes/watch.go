@@ -0,0 +1,119 @@
+package nes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidWatch = errors.New("invalid watch")
+
+type WatchFormat int
+
+const (
+	WATCH_UNSIGNED WatchFormat = iota
+	WATCH_SIGNED
+	WATCH_HEX
+	WATCH_BCD // every nibble is a decimal digit
+)
+
+// Watch is a named value of 1, 2 or 4 little endian bytes in the CPU address space.
+type Watch struct {
+	Name    string
+	Address uint16
+	Size    int
+	Format  WatchFormat
+}
+
+var watchFormats = map[byte]WatchFormat{
+	'u': WATCH_UNSIGNED,
+	's': WATCH_SIGNED,
+	'h': WATCH_HEX,
+	'b': WATCH_BCD,
+}
+
+// ReadWatches parses a watch file. Each line holds an address, a type and a name,
+// where the type is u (unsigned), s (signed), h (hex) or b (BCD) followed by 8, 16 or 32 bits.
+// "#" starts a comment.
+//
+//	$075A u8  lives
+//	$07DD b16 score
+func ReadWatches(r io.Reader) ([]Watch, error) {
+	var watches []Watch
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%w: line %d: expected an address and a type", ErrInvalidWatch, line)
+		}
+
+		watch, err := parseWatch(fields[0], fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidWatch, line, err)
+		}
+		watch.Name = strings.Join(fields[2:], " ")
+		if watch.Name == "" {
+			watch.Name = fmt.Sprintf("$%04X", watch.Address)
+		}
+		watches = append(watches, watch)
+	}
+	return watches, scanner.Err()
+}
+
+func parseWatch(address, kind string) (Watch, error) {
+	var watch Watch
+	addr, err := strconv.ParseUint(strings.TrimPrefix(address, "$"), 16, 16)
+	if err != nil {
+		return watch, err
+	}
+	watch.Address = uint16(addr)
+
+	format, ok := watchFormats[kind[0]]
+	if !ok {
+		return watch, fmt.Errorf("unknown format %q", kind[:1])
+	}
+	watch.Format = format
+
+	switch kind[1:] {
+	case "8":
+		watch.Size = 1
+	case "16":
+		watch.Size = 2
+	case "32":
+		watch.Size = 4
+	default:
+		return watch, fmt.Errorf("size must be 8, 16 or 32 bits: %q", kind)
+	}
+	return watch, nil
+}
+
+// Value reads the watch through Bus.Peek, so watching registers doesn't affect the emulation.
+func (w Watch) Value(b *Bus) uint32 {
+	var value uint32
+	for i := 0; i < w.Size; i++ {
+		value |= uint32(b.Peek(w.Address+uint16(i))) << (8 * i)
+	}
+	return value
+}
+
+// FormatValue reads the watch and formats it.
+func (w Watch) FormatValue(b *Bus) string {
+	value := w.Value(b)
+	switch w.Format {
+	case WATCH_SIGNED:
+		shift := 32 - 8*w.Size
+		return strconv.Itoa(int(int32(value<<shift) >> shift))
+	case WATCH_HEX:
+		return fmt.Sprintf("$%0*X", 2*w.Size, value)
+	case WATCH_BCD:
+		return fmt.Sprintf("%0*X", 2*w.Size, value)
+	}
+	return strconv.FormatUint(uint64(value), 10)
+}
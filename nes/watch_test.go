@@ -0,0 +1,76 @@
+package nes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadWatches(t *testing.T) {
+	file := `# smb
+$075A u8  lives
+07dd b16  score points
+$0010 s32
+`
+	watches, err := ReadWatches(strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, []Watch{
+		{Name: "lives", Address: 0x075a, Size: 1, Format: WATCH_UNSIGNED},
+		{Name: "score points", Address: 0x07dd, Size: 2, Format: WATCH_BCD},
+		{Name: "$0010", Address: 0x0010, Size: 4, Format: WATCH_SIGNED},
+	}, watches)
+
+	for _, line := range []string{"$0010", "$0010 x8", "$0010 u24", "zz u8"} {
+		_, err := ReadWatches(strings.NewReader(line))
+		assert.ErrorIs(t, err, ErrInvalidWatch, line)
+	}
+}
+
+func TestWatchFormatValue(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest([]uint8{0x4c, 0x00, 0x80})))
+	copy(console.Bus.CpuVRAM[0x10:], []uint8{0x34, 0x12, 0xff, 0xff})
+
+	tests := []struct {
+		watch  Watch
+		expect string
+	}{
+		{Watch{Address: 0x10, Size: 1, Format: WATCH_UNSIGNED}, "52"},
+		{Watch{Address: 0x12, Size: 1, Format: WATCH_SIGNED}, "-1"},
+		{Watch{Address: 0x10, Size: 2, Format: WATCH_SIGNED}, "4660"},
+		{Watch{Address: 0x12, Size: 2, Format: WATCH_SIGNED}, "-1"},
+		{Watch{Address: 0x10, Size: 4, Format: WATCH_SIGNED}, "-60876"},
+		{Watch{Address: 0x10, Size: 2, Format: WATCH_HEX}, "$1234"},
+		{Watch{Address: 0x10, Size: 2, Format: WATCH_BCD}, "1234"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expect, func(t *testing.T) {
+			assert.Equal(t, tt.expect, tt.watch.FormatValue(console.Bus))
+		})
+	}
+}
+
+func TestWatchHasNoSideEffects(t *testing.T) {
+	console := NewConsole()
+	assert.NoError(t, console.LoadROM(createTestROMForConsoleTest([]uint8{0x4c, 0x00, 0x80})))
+	console.Bus.PPU.flagVblankStarted = 1
+	console.Bus.PPU.w = 1
+	console.Bus.PPU.v = 0x2000
+	console.SetButtons(0, 1<<JOYPAD_A)
+
+	watches := []Watch{
+		{Address: 0x2002, Size: 1, Format: WATCH_HEX},
+		{Address: 0x2007, Size: 1, Format: WATCH_HEX},
+		{Address: 0x4016, Size: 1, Format: WATCH_HEX},
+	}
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, "$80", watches[0].FormatValue(console.Bus))
+		assert.Equal(t, "$00", watches[1].FormatValue(console.Bus))
+		assert.Equal(t, "$01", watches[2].FormatValue(console.Bus))
+	}
+	assert.Equal(t, uint8(1), console.Bus.PPU.w)
+	assert.Equal(t, uint16(0x2000), console.Bus.PPU.v)
+	assert.Equal(t, uint8(0), console.Bus.JoyPad1.ButtonIndex)
+}
@@ -0,0 +1,209 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"go-nes/nes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Commands are typed in the terminal the emulator was started from.
+// They are read on another goroutine and run between frames.
+type command struct {
+	usage string
+	run   func(f *Frame, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"help": {
+			usage: "help",
+			run:   runHelp,
+		},
+		"search": {
+			usage: "search reset|eq|ne|gt|lt|value <n>|list",
+			run:   runSearch,
+		},
+		"break": {
+			usage: "break <addr>[-<end>]|<label> [if <condition>]",
+			run:   runBreak,
+		},
+		"watch": {
+			usage: "watch r|w|rw [ppu] <addr>[-<end>]|<label> [if <condition>]",
+			run:   runWatch,
+		},
+		"delete": {
+			usage: "delete <breakpoint>",
+			run:   runDelete,
+		},
+		"enable": {
+			usage: "enable <breakpoint>",
+			run:   runEnable(true),
+		},
+		"disable": {
+			usage: "disable <breakpoint>",
+			run:   runEnable(false),
+		},
+		"breakpoints": {
+			usage: "breakpoints",
+			run:   runBreakpoints,
+		},
+		"pause": {
+			usage: "pause",
+			run:   runPause,
+		},
+		"continue": {
+			usage: "continue",
+			run:   runContinue,
+		},
+		"step": {
+			usage: "step (into the next instruction)",
+			run:   runStep,
+		},
+		"next": {
+			usage: "next (step over subroutines)",
+			run:   runNext,
+		},
+		"finish": {
+			usage: "finish (step out of the subroutine)",
+			run:   runFinish,
+		},
+		"scanline": {
+			usage: "scanline <n> (run to the scanline)",
+			run:   runScanline,
+		},
+		"bt": {
+			usage: "bt (call stack)",
+			run:   runBacktrace,
+		},
+		"regs": {
+			usage: "regs",
+			run:   runRegisters,
+		},
+		"sym": {
+			usage: "sym <label>|<addr> (resolve a symbol)",
+			run:   runSymbol,
+		},
+		"trace": {
+			usage: "trace on [nestest|mesen|fceux]|off|dump (log the executed instructions)",
+			run:   runTrace,
+		},
+		"cdl": {
+			usage: "cdl [on|off|reset|save <file>] (log the code and data bytes used, FCEUX's .cdl format)",
+			run:   runCodeDataLog,
+		},
+		"profile": {
+			usage: "profile [on|off|reset|save <file>] (cycles per frame of every subroutine, pprof profile)",
+			run:   runProfile,
+		},
+		"asm": {
+			usage: "asm <addr>|<label> <instruction> (patch the code in place)",
+			run:   runAssemble,
+		},
+	}
+}
+
+// ReadCommands queues every line of r to be run by the next frame.
+func (f *Frame) ReadCommands(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		f.commands <- scanner.Text()
+	}
+}
+
+func (f *Frame) runCommands() {
+	for {
+		select {
+		case line := <-f.commands:
+			f.runCommand(line)
+		default:
+			return
+		}
+	}
+}
+
+func (f *Frame) runCommand(line string) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Printf("unknown command %q, try help\n", args[0])
+		return
+	}
+	if err := cmd.run(f, args[1:]); err != nil {
+		fmt.Printf("%s: %v\nusage: %s\n", args[0], err, cmd.usage)
+	}
+}
+
+func runHelp(f *Frame, args []string) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(commands[name].usage)
+	}
+	return nil
+}
+
+// parseNumber accepts decimal, $hex and 0xhex.
+func parseNumber(s string, bitSize int) (uint64, error) {
+	if strings.HasPrefix(s, "$") {
+		return strconv.ParseUint(s[1:], 16, bitSize)
+	}
+	return strconv.ParseUint(s, 0, bitSize)
+}
+
+const searchListLimit = 50
+
+func runSearch(f *Frame, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing subcommand")
+	}
+	if f.search == nil || args[0] == "reset" {
+		f.search = nes.NewRAMSearch(f.Console)
+	}
+
+	switch args[0] {
+	case "reset", "list":
+	case "eq":
+		f.search.Filter(nes.SEARCH_EQUAL)
+	case "ne":
+		f.search.Filter(nes.SEARCH_CHANGED)
+	case "gt":
+		f.search.Filter(nes.SEARCH_INCREASED)
+	case "lt":
+		f.search.Filter(nes.SEARCH_DECREASED)
+	case "value":
+		if len(args) != 2 {
+			return fmt.Errorf("missing value")
+		}
+		value, err := parseNumber(args[1], 8)
+		if err != nil {
+			return err
+		}
+		f.search.FilterValue(uint8(value))
+	default:
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+
+	fmt.Printf("%d candidates\n", f.search.Len())
+	if f.search.Len() <= searchListLimit || args[0] == "list" {
+		for i, result := range f.search.Results() {
+			if i == searchListLimit {
+				fmt.Println("...")
+				break
+			}
+			fmt.Printf("$%04X: %3d -> %3d ($%02X)\n", result.Address, result.Previous, result.Current, result.Current)
+		}
+	}
+	return nil
+}
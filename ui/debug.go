@@ -0,0 +1,369 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"go-nes/asm"
+	"go-nes/nes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parseRange parses "<addr>" or "<start>-<end>".
+func parseRange(s string) (uint16, uint16, error) {
+	first, last, isRange := strings.Cut(s, "-")
+	start, err := parseNumber(first, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	end := start
+	if isRange {
+		if end, err = parseNumber(last, 16); err != nil {
+			return 0, 0, err
+		}
+	}
+	return uint16(start), uint16(end), nil
+}
+
+// addBreakpoint adds a breakpoint on an address range, or on a label for CPU addresses.
+func addBreakpoint(console *nes.Console, kind nes.BreakpointKind, space nes.AddressSpace, location string, condition string) (*nes.Breakpoint, error) {
+	d := console.AttachDebugger()
+	start, end, err := parseRange(location)
+	if err != nil && space == nes.SPACE_CPU {
+		if _, symbolErr := console.Bus.SymbolAddress(location); symbolErr == nil {
+			return d.AddBreakpointAtSymbol(kind, location, condition)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.AddBreakpoint(kind, space, start, end, condition)
+}
+
+// parseCondition splits "... if <condition>" off the arguments.
+func parseCondition(args []string) ([]string, string) {
+	for i, arg := range args {
+		if arg == "if" {
+			return args[:i], strings.Join(args[i+1:], " ")
+		}
+	}
+	return args, ""
+}
+
+func runBreak(f *Frame, args []string) error {
+	args, condition := parseCondition(args)
+	if len(args) != 1 {
+		return fmt.Errorf("expected an address")
+	}
+	bp, err := addBreakpoint(f.Console, nes.BREAK_EXECUTE, nes.SPACE_CPU, args[0], condition)
+	if err != nil {
+		return err
+	}
+	fmt.Println(bp)
+	return nil
+}
+
+var watchKinds = map[string]nes.BreakpointKind{
+	"r":  nes.BREAK_READ,
+	"w":  nes.BREAK_WRITE,
+	"rw": nes.BREAK_ACCESS,
+}
+
+func runWatch(f *Frame, args []string) error {
+	args, condition := parseCondition(args)
+	if len(args) < 2 {
+		return fmt.Errorf("expected a kind and an address")
+	}
+	kind, ok := watchKinds[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown kind %q", args[0])
+	}
+	space := nes.SPACE_CPU
+	if args[1] == "ppu" {
+		space = nes.SPACE_PPU
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("expected an address")
+	}
+	bp, err := addBreakpoint(f.Console, kind, space, args[1], condition)
+	if err != nil {
+		return err
+	}
+	fmt.Println(bp)
+	return nil
+}
+
+func breakpointID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected a breakpoint number")
+	}
+	return strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+}
+
+func runDelete(f *Frame, args []string) error {
+	id, err := breakpointID(args)
+	if err != nil {
+		return err
+	}
+	return f.Console.AttachDebugger().RemoveBreakpoint(id)
+}
+
+func runEnable(enabled bool) func(f *Frame, args []string) error {
+	return func(f *Frame, args []string) error {
+		id, err := breakpointID(args)
+		if err != nil {
+			return err
+		}
+		bp, err := f.Console.AttachDebugger().Breakpoint(id)
+		if err != nil {
+			return err
+		}
+		bp.Enabled = enabled
+		fmt.Println(bp)
+		return nil
+	}
+}
+
+func runBreakpoints(f *Frame, args []string) error {
+	for _, bp := range f.Console.AttachDebugger().Breakpoints() {
+		fmt.Println(bp)
+	}
+	return nil
+}
+
+// runResume returns a command arming the debugger and resuming the emulation.
+func runResume(resume func(d *nes.Debugger, args []string) error) func(f *Frame, args []string) error {
+	return func(f *Frame, args []string) error {
+		if err := resume(f.Console.AttachDebugger(), args); err != nil {
+			return err
+		}
+		f.paused = false
+		return nil
+	}
+}
+
+var (
+	runContinue = runResume(func(d *nes.Debugger, args []string) error {
+		d.Continue()
+		return nil
+	})
+	runStep = runResume(func(d *nes.Debugger, args []string) error {
+		d.StepInto()
+		return nil
+	})
+	runNext = runResume(func(d *nes.Debugger, args []string) error {
+		d.StepOver()
+		return nil
+	})
+	runFinish = runResume(func(d *nes.Debugger, args []string) error {
+		return d.StepOut()
+	})
+	runScanline = runResume(func(d *nes.Debugger, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected a scanline")
+		}
+		scanline, err := parseNumber(args[0], 16)
+		if err != nil {
+			return err
+		}
+		d.RunToScanline(uint16(scanline))
+		return nil
+	})
+)
+
+func runPause(f *Frame, args []string) error {
+	f.Console.AttachDebugger()
+	f.paused = true
+	printLocation(f.Console)
+	return nil
+}
+
+func runBacktrace(f *Frame, args []string) error {
+	kinds := map[nes.CallKind]string{nes.CALL_JSR: "jsr", nes.CALL_NMI: "nmi", nes.CALL_BRK: "brk"}
+	stack := f.Console.AttachDebugger().CallStack()
+	for i := len(stack) - 1; i >= 0; i-- {
+		frame := stack[i]
+		fmt.Printf("#%d %s from %s (%s)\n", len(stack)-1-i, formatAddress(f.Console, frame.Target), formatAddress(f.Console, frame.Caller), kinds[frame.Kind])
+	}
+	return nil
+}
+
+func runRegisters(f *Frame, args []string) error {
+	printLocation(f.Console)
+	return nil
+}
+
+func printLocation(console *nes.Console) {
+	s := console.CPU.State()
+	ppu := console.Bus.PPU.State()
+	fmt.Printf("PC:%s A:$%02X X:$%02X Y:$%02X P:$%02X SP:$%02X scanline:%d dot:%d frame:%d\n",
+		formatAddress(console, s.PC), s.A, s.X, s.Y, s.P, s.SP, ppu.Scanline, ppu.Dot, console.FrameCount)
+}
+
+// formatAddress formats a CPU address with its label, like "$8010 <main>".
+func formatAddress(console *nes.Console, addr uint16) string {
+	if name, ok := console.Bus.SymbolName(addr); ok {
+		return fmt.Sprintf("$%04X <%s>", addr, name)
+	}
+	return fmt.Sprintf("$%04X", addr)
+}
+
+func runSymbol(f *Frame, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a label or an address")
+	}
+	addr, err := parseNumber(args[0], 16)
+	if err != nil {
+		if addr, err := f.Console.Bus.SymbolAddress(args[0]); err == nil {
+			fmt.Println(formatAddress(f.Console, addr))
+			return nil
+		}
+		return err
+	}
+	if _, ok := f.Console.Bus.SymbolName(uint16(addr)); !ok {
+		return fmt.Errorf("no symbol at $%04X", addr)
+	}
+	fmt.Println(formatAddress(f.Console, uint16(addr)))
+	return nil
+}
+
+func runAssemble(f *Frame, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("expected an address and an instruction")
+	}
+	addr, err := parseNumber(args[0], 16)
+	if err != nil {
+		symbol, symbolErr := f.Console.Bus.SymbolAddress(args[0])
+		if symbolErr != nil {
+			return err
+		}
+		addr = uint64(symbol)
+	}
+	n, err := asm.Patch(f.Console.Bus, uint16(addr), strings.Join(args[1:], " "))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("patched %d bytes at %s\n", n, formatAddress(f.Console, uint16(addr)))
+	return nil
+}
+
+// runTrace toggles the trace logger set with -trace, or traces to the terminal without one.
+func runTrace(f *Frame, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected on, off or dump")
+	}
+	tracer := f.Console.TraceLogger()
+	switch args[0] {
+	case "on":
+		if len(args) > 2 {
+			return fmt.Errorf("expected a trace format")
+		}
+		if tracer == nil {
+			tracer = nes.NewTraceLogger(os.Stdout, nes.TraceOptions{})
+			f.Console.SetTraceLogger(tracer)
+		}
+		if len(args) == 2 {
+			format, err := nes.ParseTraceFormat(args[1])
+			if err != nil {
+				return err
+			}
+			tracer.Options.Format = format
+		}
+		tracer.SetEnabled(true)
+	case "off":
+		if tracer != nil {
+			tracer.SetEnabled(false)
+		}
+	case "dump":
+		if tracer == nil {
+			return fmt.Errorf("not tracing")
+		}
+		return tracer.Dump()
+	default:
+		return fmt.Errorf("expected on, off or dump")
+	}
+	return nil
+}
+
+// runCodeDataLog prints how much of the ROM the code/data logger has seen, or attaches, detaches, resets or saves it.
+func runCodeDataLog(f *Frame, args []string) error {
+	cdl := f.Console.CodeDataLogger()
+	if len(args) > 0 && args[0] == "on" {
+		cdl = f.Console.AttachCodeDataLogger()
+	}
+	if cdl == nil {
+		return fmt.Errorf("not logging, see cdl on")
+	}
+	switch {
+	case len(args) == 0 || args[0] == "on":
+		code, data, chr := cdl.Counts()
+		fmt.Printf("PRG-ROM: %d code, %d data of %d bytes; CHR-ROM: %d of %d bytes\n", code, data, len(cdl.PRG), chr, len(cdl.CHR))
+	case args[0] == "off":
+		f.Console.DetachCodeDataLogger()
+	case args[0] == "reset":
+		cdl.Reset()
+	case args[0] == "save" && len(args) == 2:
+		return WriteFile(args[1], cdl.Write)
+	default:
+		return fmt.Errorf("expected on, off, reset or save <file>")
+	}
+	return nil
+}
+
+// runProfile prints the cycles per frame of the routines profiled, or attaches, detaches, resets or saves the profiler.
+func runProfile(f *Frame, args []string) error {
+	p := f.Console.Profiler()
+	if len(args) > 0 && args[0] == "on" {
+		p = f.Console.AttachProfiler()
+	}
+	if p == nil {
+		return fmt.Errorf("not profiling, see profile on")
+	}
+	switch {
+	case len(args) == 0:
+		return p.WriteReport(os.Stdout)
+	case args[0] == "on":
+	case args[0] == "off":
+		f.Console.DetachProfiler()
+	case args[0] == "reset":
+		p.Reset()
+	case args[0] == "save" && len(args) == 2:
+		return WriteFile(args[1], p.WriteProfile)
+	default:
+		return fmt.Errorf("expected on, off, reset or save <file>")
+	}
+	return nil
+}
+
+// WriteFile creates the file at path with what writeTo writes.
+func WriteFile(path string, writeTo func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := writeTo(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// stepFrame runs a frame unless paused, and pauses when the debugger stops.
+func (f *Frame) stepFrame() error {
+	if f.paused {
+		return nil
+	}
+	err := f.Console.StepFrame()
+	var stop *nes.DebugStop
+	if errors.As(err, &stop) {
+		f.paused = true
+		fmt.Println(stop)
+		printLocation(f.Console)
+		return nil
+	}
+	return err
+}
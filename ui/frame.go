@@ -6,31 +6,70 @@ import (
 	"image"
 	"image/color"
 	"log"
+	"os"
 
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/glfw/v3.2/glfw"
 )
 
 const (
-	WIDTH  = 256
-	HEIGHT = 240
+	WIDTH  = nes.SCREEN_WIDTH
+	HEIGHT = nes.SCREEN_HEIGHT
 	SCALE  = 3
 )
 
 type Frame struct {
-	Front   *image.RGBA
-	Joypad1 *nes.Joypad
-	Joypad2 *nes.Joypad
+	Console     *nes.Console
+	StatePrefix string // save state slots are written to <StatePrefix>.state<N>
+	Watches     []nes.Watch
+	ShowOverlay bool
+
+	commands chan string
+	search   *nes.RAMSearch
+	paused   bool // stopped by the debugger
+	overlay  *image.RGBA
 }
 
-func NewFrame(joypad1, joypad2 *nes.Joypad) *Frame {
+func NewFrame(console *nes.Console, statePrefix string) *Frame {
 	return &Frame{
-		Front:   image.NewRGBA(image.Rect(0, 0, WIDTH, HEIGHT)),
-		Joypad1: joypad1,
-		Joypad2: joypad2,
+		Console:     console,
+		StatePrefix: statePrefix,
+		commands:    make(chan string, 16),
+		ShowOverlay: true,
+		overlay:     image.NewRGBA(image.Rect(0, 0, WIDTH, HEIGHT)),
 	}
 }
 
+// Image returns the framebuffer with the watches drawn on top.
+// The console framebuffer itself is left untouched so that frame hashes don't depend on the overlay.
+func (f *Frame) Image() *image.RGBA {
+	framebuffer := f.Console.Framebuffer()
+	if !f.ShowOverlay || len(f.Watches) == 0 {
+		return framebuffer
+	}
+
+	copy(f.overlay.Pix, framebuffer.Pix)
+	for i, watch := range f.Watches {
+		text := watch.Name + " " + watch.FormatValue(f.Console.Bus)
+		drawText(f.overlay, 2, 2+i*glyphHeight, text, color.White)
+	}
+	return f.overlay
+}
+
+// F1-F10 load the save state slot, Shift+F1-F10 save it
+var stateSlotKeys = map[glfw.Key]int{
+	glfw.KeyF1:  1,
+	glfw.KeyF2:  2,
+	glfw.KeyF3:  3,
+	glfw.KeyF4:  4,
+	glfw.KeyF5:  5,
+	glfw.KeyF6:  6,
+	glfw.KeyF7:  7,
+	glfw.KeyF8:  8,
+	glfw.KeyF9:  9,
+	glfw.KeyF10: 10,
+}
+
 func Init() *glfw.Window {
 	if err := glfw.Init(); err != nil {
 		panic(err)
@@ -58,205 +97,111 @@ func Init() *glfw.Window {
 }
 
 func (f *Frame) OnKey(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
-	f.Joypad1.ReadKeys(w)
-	f.Joypad2.ReadKeys(w)
+	buttons := ReadKeys(w)
+	f.Console.SetButtons(0, buttons)
+	f.Console.SetButtons(1, buttons)
 	if action == glfw.Press {
 		if key == glfw.KeyEscape {
 			w.SetShouldClose(true)
 		}
-	}
-}
-
-func (f *Frame) renderPixel(x, y uint, c color.RGBA) {
-	f.Front.SetRGBA(int(x), int(y), c)
-}
-
-func (f *Frame) Render(ppu *nes.PPU) {
-	scrollX := ppu.ReadPPUScrollX()
-	scrollY := ppu.ReadPPUScrollY()
-
-	var mainNameTable, secondNameTable []uint8
-	if ppu.Mirroring == nes.MIRROR_VERTICAL &&
-		(ppu.ReadCTRLNameTableAddress() == 0x2000 || ppu.ReadCTRLNameTableAddress() == 0x2800) {
-		mainNameTable = ppu.VRAM[0:0x400]
-		secondNameTable = ppu.VRAM[0x400:0x800]
-	} else if ppu.Mirroring == nes.MIRROR_VERTICAL &&
-		(ppu.ReadCTRLNameTableAddress() == 0x2400 || ppu.ReadCTRLNameTableAddress() == 0x2c00) {
-		mainNameTable = ppu.VRAM[0x400:0x800]
-		secondNameTable = ppu.VRAM[0:0x400]
-	} else if ppu.Mirroring == nes.MIRROR_HORIZONTAL &&
-		(ppu.ReadCTRLNameTableAddress() == 0x2000 || ppu.ReadCTRLNameTableAddress() == 0x2400) {
-		mainNameTable = ppu.VRAM[0:0x400]
-		secondNameTable = ppu.VRAM[0x400:0x800]
-	} else if ppu.Mirroring == nes.MIRROR_HORIZONTAL &&
-		(ppu.ReadCTRLNameTableAddress() == 0x2800 || ppu.ReadCTRLNameTableAddress() == 0x2c00) {
-		mainNameTable = ppu.VRAM[0x400:0x800]
-		secondNameTable = ppu.VRAM[0:0x400]
-	} else {
-		panic(fmt.Sprintf("not supported mirroring type: %d", ppu.Mirroring))
-	}
-
-	f.RenderNameTable(ppu, mainNameTable, *NewRect(uint(scrollX), uint(scrollY), WIDTH, HEIGHT), -int(scrollX), -int(scrollY))
-	if scrollX > 0 {
-		f.RenderNameTable(ppu, secondNameTable, *NewRect(0, 0, uint(scrollX), HEIGHT), WIDTH-int(scrollX), 0)
-	} else if scrollY > 0 {
-		f.RenderNameTable(ppu, secondNameTable, *NewRect(0, 0, WIDTH, uint(scrollY)), 0, HEIGHT-int(scrollY))
-	}
-
-	// Render Sprite
-	for i := 0; i < len(ppu.OAMData); i += 4 {
-		tileIndex := uint16(ppu.OAMData[i+1])
-		tileX := uint(ppu.OAMData[i+3])
-		tileY := uint(ppu.OAMData[i])
-
-		var flipVertical, flipHorizontal bool
-		if ppu.OAMData[i+2]>>7&1 == 1 {
-			flipVertical = true
-		} else {
-			flipVertical = false
+		if key == glfw.KeyF12 {
+			f.ShowOverlay = !f.ShowOverlay
 		}
 
-		if ppu.OAMData[i+2]>>6&1 == 1 {
-			flipHorizontal = true
-		} else {
-			flipHorizontal = false
-		}
-		palletteIndex := ppu.OAMData[i+2] & 0b11
-		spritePallet := spritePallete(ppu, palletteIndex)
-
-		bank := ppu.ReadCTRLSpriteTableAddress()
-
-		tile := ppu.CharacterRom[(bank + tileIndex*16):(bank + tileIndex*16 + 15 + 1)]
-
-		for y := uint(0); y < 8; y++ {
-			upper := tile[y]
-			lower := tile[y+8]
-			for x := 7; x >= 0; x-- {
-				value := (1&lower)<<1 | (1 & upper)
-				upper = upper >> 1
-				lower = lower >> 1
-				var rgb color.RGBA
-				switch value {
-				case 0:
-					continue
-				case 1:
-					rgb = nes.Palletes[spritePallet[1]]
-				case 2:
-					rgb = nes.Palletes[spritePallet[2]]
-				case 3:
-					rgb = nes.Palletes[spritePallet[3]]
-				default:
-					panic("unknown value")
+		// Ctrl+R reset, Ctrl+P power cycle, Ctrl+M toggle movie read-only
+		if mods&glfw.ModControl != 0 {
+			switch key {
+			case glfw.KeyR:
+				if err := f.Console.Reset(); err != nil {
+					log.Println(err)
 				}
-
-				if flipHorizontal && flipVertical {
-					f.renderPixel(tileX+7-uint(x), tileY+7-y, rgb)
-				} else if flipHorizontal && !flipVertical {
-					f.renderPixel(tileX+7-uint(x), tileY+y, rgb)
-				} else if !flipHorizontal && flipVertical {
-					f.renderPixel(tileX+uint(x), tileY+7-y, rgb)
-				} else {
-					f.renderPixel(tileX+uint(x), tileY+y, rgb)
+			case glfw.KeyP:
+				if err := f.Console.HardReset(); err != nil {
+					log.Println(err)
 				}
+			case glfw.KeyM:
+				f.Console.SetMovieReadOnly(!f.Console.MovieReadOnly())
+				log.Println("movie read-only:", f.Console.MovieReadOnly())
+			}
+
+			// Ctrl+1-9 toggle the cheats in the order of the cheat file
+			if key >= glfw.Key1 && key <= glfw.Key9 {
+				f.toggleCheat(int(key - glfw.Key1))
+			}
+		}
+
+		if slot, ok := stateSlotKeys[key]; ok {
+			if mods&glfw.ModShift != 0 {
+				f.saveState(slot)
+			} else {
+				f.loadState(slot)
 			}
 		}
 	}
 }
 
-func backgroundPallette(ppu *nes.PPU, attributeTable []uint8, tileColumn uint, tileRow uint) []uint8 {
-	attrTableIdx := (tileRow/4)*8 + tileColumn/4
-	attrByte := attributeTable[attrTableIdx]
-
-	var palletIndex uint8
-	palletIdx1 := tileColumn % 4 / 2
-	palletIdx2 := tileRow % 4 / 2
-
-	if palletIdx1 == 0 && palletIdx2 == 0 {
-		palletIndex = attrByte & 0b11
-	} else if palletIdx1 == 1 && palletIdx2 == 0 {
-		palletIndex = (attrByte >> 2) & 0b11
-	} else if palletIdx1 == 0 && palletIdx2 == 1 {
-		palletIndex = (attrByte >> 4) & 0b11
-	} else {
-		palletIndex = (attrByte >> 6) & 0b11
+func (f *Frame) toggleCheat(i int) {
+	cheats := f.Console.Cheats
+	if i >= len(cheats.Cheats) {
+		return
 	}
+	cheats.Toggle(i)
+	cheat := cheats.Cheats[i]
+	log.Printf("cheat %d %s (%s): %v", i+1, cheat.Code, cheat.Name, cheat.Enabled)
+}
 
-	palletStart := 1 + (palletIndex * 4)
-
-	return []uint8{
-		ppu.PaletteTable[0],
-		ppu.PaletteTable[palletStart],
-		ppu.PaletteTable[palletStart+1],
-		ppu.PaletteTable[palletStart+2],
-	}
+func (f *Frame) statePath(slot int) string {
+	return fmt.Sprintf("%s.state%d", f.StatePrefix, slot)
 }
 
-func spritePallete(ppu *nes.PPU, palleteIndex uint8) []uint8 {
-	palletStart := 0x11 + (palleteIndex * 4)
+func (f *Frame) saveState(slot int) {
+	file, err := os.Create(f.statePath(slot))
+	if err != nil {
+		log.Println("save state:", err)
+		return
+	}
+	defer file.Close()
 
-	return []uint8{
-		0,
-		ppu.PaletteTable[palletStart],
-		ppu.PaletteTable[palletStart+1],
-		ppu.PaletteTable[palletStart+2],
+	if err := f.Console.SaveState(file); err != nil {
+		log.Println("save state:", err)
+		return
 	}
+	log.Println("saved state", slot)
 }
 
-type Rect struct {
-	x1 uint
-	y1 uint
-	x2 uint
-	y2 uint
-}
+func (f *Frame) loadState(slot int) {
+	file, err := os.Open(f.statePath(slot))
+	if err != nil {
+		log.Println("load state:", err)
+		return
+	}
+	defer file.Close()
 
-func NewRect(x1, y1, x2, y2 uint) *Rect {
-	return &Rect{
-		x1: x1,
-		y1: y1,
-		x2: x2,
-		y2: y2,
+	if err := f.Console.LoadState(file); err != nil {
+		log.Println("load state:", err)
+		return
 	}
+	log.Println("loaded state", slot)
 }
 
-func (f *Frame) RenderNameTable(ppu *nes.PPU, nametable []uint8, viewPort Rect, shiftX int, shiftY int) {
-	bank := ppu.ReadCTRLBackGroundTableAddress()
-	attributeTable := nametable[0x3c0:0x400]
-
-	for i := 0; i < 0x3c0; i++ {
-		tileColumn := uint(i % 32)
-		tileRow := uint(i / 32)
-		tileIndex := uint16(nametable[i])
-		tile := ppu.CharacterRom[(bank + tileIndex*16):(bank + tileIndex*16 + 15 + 1)]
-		palette := backgroundPallette(ppu, attributeTable, tileColumn, tileRow)
-
-		for y := uint(0); y < 8; y++ {
-			upper := tile[y]
-			lower := tile[y+8]
-
-			for x := 7; x >= 0; x-- {
-				value := (1&lower)<<1 | (1 & upper)
-				upper = upper >> 1
-				lower = lower >> 1
-				var rgb color.RGBA
-				switch value {
-				case 0:
-					rgb = nes.Palletes[ppu.PaletteTable[0]]
-				case 1:
-					rgb = nes.Palletes[palette[1]]
-				case 2:
-					rgb = nes.Palletes[palette[2]]
-				case 3:
-					rgb = nes.Palletes[palette[3]]
-				default:
-					panic("unknown value")
-				}
-				pixelX := tileColumn*8 + uint(x)
-				pixelY := tileRow*8 + y
+var keyBindings = map[glfw.Key]uint8{
+	glfw.KeyA:     nes.JOYPAD_A,
+	glfw.KeyS:     nes.JOYPAD_B,
+	glfw.KeySpace: nes.JOYPAD_SELECT,
+	glfw.KeyEnter: nes.JOYPAD_START,
+	glfw.KeyUp:    nes.JOYPAD_UP,
+	glfw.KeyDown:  nes.JOYPAD_DOWN,
+	glfw.KeyLeft:  nes.JOYPAD_LEFT,
+	glfw.KeyRight: nes.JOYPAD_RIGHT,
+}
 
-				if pixelX >= viewPort.x1 && pixelX < viewPort.x2 && pixelY >= viewPort.y1 && pixelY < viewPort.y2 {
-					f.renderPixel(uint(shiftX+int(pixelX)), uint(shiftY+int(pixelY)), rgb)
-				}
-			}
+// ReadKeys returns the buttons held on the keyboard as a bit mask for Joypad.SetButtons.
+func ReadKeys(window *glfw.Window) uint8 {
+	var mask uint8
+	for key, button := range keyBindings {
+		if window.GetKey(key) == glfw.Press {
+			mask |= 1 << button
 		}
 	}
+	return mask
 }
@@ -1,7 +1,9 @@
 package ui
 
 import (
+	"errors"
 	"go-nes/nes"
+	"os"
 	"unsafe"
 
 	"github.com/go-gl/gl/v4.1-core/gl"
@@ -38,38 +40,44 @@ var (
 	}
 )
 
-func Run(cpu *nes.CPU, bus *nes.Bus, window *glfw.Window, program *Program) error {
-	frame := NewFrame(bus.JoyPad1, bus.JoyPad2)
+func Run(frame *Frame, window *glfw.Window, program *Program) error {
+	console := frame.Console
 	VAO := CreateVAO()
 
 	window.SetKeyCallback(frame.OnKey)
+	go frame.ReadCommands(os.Stdin)
 
 	for !window.ShouldClose() {
-		cpu.Step()
-		if bus.RenderFlag {
-			glfw.PollEvents()
-			gl.Clear(gl.COLOR_BUFFER_BIT)
-			frame.Render(bus.PPU)
-
-			program.Use()
-
-			tex, err := NewTexture(frame.Front, gl.CLAMP_TO_EDGE, gl.CLAMP_TO_EDGE)
-			if err != nil {
+		// holding Backspace steps backwards one frame at a time
+		if window.GetKey(glfw.KeyBackspace) == glfw.Press && !frame.paused {
+			if err := console.RewindFrame(); err != nil && !errors.Is(err, nes.ErrRewindEmpty) {
 				return err
 			}
+		} else if err := frame.stepFrame(); err != nil {
+			return err
+		}
 
-			tex.Bind(gl.TEXTURE0)
-			//tex.SetUniform(shaderProgram.GetUniformLocation("ourTexture"))
-
-			gl.BindVertexArray(VAO)
-			gl.DrawElements(gl.TRIANGLES, 6, gl.UNSIGNED_INT, unsafe.Pointer(nil))
-			gl.BindVertexArray(0)
+		glfw.PollEvents()
+		frame.runCommands()
+		gl.Clear(gl.COLOR_BUFFER_BIT)
 
-			tex.UnBind()
+		program.Use()
 
-			bus.RenderFlag = false
-			window.SwapBuffers()
+		tex, err := NewTexture(frame.Image(), gl.CLAMP_TO_EDGE, gl.CLAMP_TO_EDGE)
+		if err != nil {
+			return err
 		}
+
+		tex.Bind(gl.TEXTURE0)
+		//tex.SetUniform(shaderProgram.GetUniformLocation("ourTexture"))
+
+		gl.BindVertexArray(VAO)
+		gl.DrawElements(gl.TRIANGLES, 6, gl.UNSIGNED_INT, unsafe.Pointer(nil))
+		gl.BindVertexArray(0)
+
+		tex.UnBind()
+
+		window.SwapBuffers()
 	}
 
 	return nil